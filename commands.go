@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+)
+
+var errMigrateUsage = errors.New("usage: mittai [-config file] migrate up | down [steps] | status")
+
+var errGrantAdminUsage = errors.New("usage: mittai [-config file] grant-admin <email>")
+
+// runCommand runs a command line subcommand instead of starting the server
+func runCommand(repo *db.Repository, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(repo, args[1:])
+	case "grant-admin":
+		return runGrantAdmin(repo, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// runMigrate applies, rolls back or lists the schema migrations
+func runMigrate(repo *db.Repository, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := repo.MigrateUp()
+		if err != nil {
+			return err
+		}
+		log.Printf("%d migrations applied", count)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errMigrateUsage
+			}
+			steps = n
+		}
+		count, err := repo.MigrateDown(steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d migrations rolled back", count)
+
+	case "status":
+		states, err := repo.MigrationStatus()
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-28s %s\n", state.Version, state.Name, applied)
+		}
+		return err
+
+	default:
+		return errMigrateUsage
+	}
+	return nil
+}
+
+// runGrantAdmin gives the admin role to the user registered with an email address.
+// It is how the first admin is made, since only admins can change roles over the API.
+func runGrantAdmin(repo *db.Repository, args []string) error {
+	if len(args) != 1 {
+		return errGrantAdminUsage
+	}
+
+	if _, err := repo.MigrateUp(); err != nil {
+		return err
+	}
+	users := store.NewSQLStores(repo).Users
+	user, err := users.GetByEmail(args[0])
+	if err == store.ErrNotFound {
+		return fmt.Errorf("no user is registered with %s", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	if err := users.SetRole(user.UserID, utils.RoleAdmin); err != nil {
+		return err
+	}
+	log.Printf("User %d (%s) is now an admin", user.UserID, user.Email)
+	return nil
+}
@@ -0,0 +1,348 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/notifications"
+	"github.com/gklps/mittai-backend/payments"
+	"gopkg.in/yaml.v3"
+)
+
+// minJWTSecretLength is the shortest JWT secret accepted at startup
+const minJWTSecretLength = 16
+
+// Config holds the settings of the backend. Values come from an optional YAML
+// file and are overridden by environment variables.
+type Config struct {
+	Server      ServerConfig              `yaml:"server"`
+	Database    DatabaseConfig            `yaml:"database"`
+	JWT         JWTConfig                 `yaml:"jwt"`
+	OTP         OTPConfig                 `yaml:"otp"`
+	Idempotency IdempotencyConfig         `yaml:"idempotency"`
+	Email       notifications.EmailConfig `yaml:"email"`
+	SMS         notifications.SMSConfig   `yaml:"sms"`
+	Payments    payments.Config           `yaml:"payments"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	// ListenAddr is the address the HTTP server listens on
+	ListenAddr string `yaml:"listen_addr"`
+	// CORSOrigins are the browser origins allowed to call the API; "*" allows any
+	CORSOrigins []string `yaml:"cors_origins"`
+	// PublicBaseURL is the externally reachable URL of the API, used in links sent to users
+	PublicBaseURL string `yaml:"public_base_url"`
+}
+
+// DatabaseConfig holds the database connection settings
+type DatabaseConfig struct {
+	// Driver is "sqlite3" or "postgres"
+	Driver string `yaml:"driver"`
+	// DSN is the SQLite file path or the PostgreSQL connection string
+	DSN string `yaml:"dsn"`
+}
+
+// dsnPasswordPattern matches the password of a key=value PostgreSQL connection string
+var dsnPasswordPattern = regexp.MustCompile(`password\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// RedactedDSN returns the DSN with any password replaced by "xxxxx", for logging
+func (d DatabaseConfig) RedactedDSN() string {
+	if db.Dialect(d.Driver) != db.DialectPostgres {
+		return d.DSN
+	}
+	u, err := url.Parse(d.DSN)
+	if err != nil || u.Scheme == "" {
+		return dsnPasswordPattern.ReplaceAllString(d.DSN, "password=xxxxx")
+	}
+	if query := u.Query(); query.Has("password") {
+		query.Set("password", "xxxxx")
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// JWTConfig holds the access token settings
+type JWTConfig struct {
+	// Secret signs access tokens and is required unless RandomSecret is set
+	Secret string `yaml:"secret"`
+	// RandomSecret lets development setups run without a secret by signing with a
+	// random per-process one, which logs everyone out on restart
+	RandomSecret bool          `yaml:"random_secret"`
+	Issuer       string        `yaml:"issuer"`
+	TTL          time.Duration `yaml:"ttl"`
+}
+
+// OTPConfig holds the one-time code settings
+type OTPConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// IdempotencyConfig holds the settings of Idempotency-Key handling
+type IdempotencyConfig struct {
+	// TTL is how long a response is kept for replay
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddr:    "0.0.0.0:8080",
+			CORSOrigins:   []string{"http://localhost:3000"},
+			PublicBaseURL: "http://localhost:8080",
+		},
+		Database: DatabaseConfig{
+			Driver: "sqlite3",
+			DSN:    "database.db",
+		},
+		JWT: JWTConfig{
+			Issuer: "mittai-backend",
+			TTL:    15 * time.Minute,
+		},
+		OTP: OTPConfig{
+			TTL: 10 * time.Minute,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: 24 * time.Hour,
+		},
+		Email: notifications.EmailConfig{
+			Provider:    notifications.EmailProviderOutbox,
+			FromName:    "Mittaitheruvu",
+			FromAddress: "otp-services@mittaitheruvu.com",
+			OutboxDir:   "outbox",
+		},
+		SMS: notifications.SMSConfig{
+			Provider: notifications.SMSProviderLog,
+		},
+		Payments: payments.Config{
+			Currency:  "INR",
+			Providers: []string{payments.ProviderCOD},
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path (if
+// path is not empty) and the environment, and validates the result
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the configuration with the environment variables that are set
+func (c *Config) applyEnv() error {
+	setString(&c.Server.ListenAddr, "LISTEN_ADDR")
+	setList(&c.Server.CORSOrigins, "CORS_ORIGINS")
+	setString(&c.Server.PublicBaseURL, "PUBLIC_BASE_URL")
+
+	setString(&c.Database.Driver, "DB_DRIVER")
+	setString(&c.Database.DSN, "DB_DSN")
+
+	setString(&c.JWT.Secret, "JWT_SECRET")
+	setString(&c.JWT.Issuer, "JWT_ISSUER")
+
+	setString(&c.Email.Provider, "EMAIL_PROVIDER")
+	setString(&c.Email.FromName, "EMAIL_FROM_NAME")
+	setString(&c.Email.FromAddress, "EMAIL_FROM_ADDRESS")
+	setString(&c.Email.BrevoAPIKey, "BREVO_API_KEY")
+	setString(&c.Email.SMTPHost, "SMTP_HOST")
+	setString(&c.Email.SMTPUsername, "SMTP_USERNAME")
+	setString(&c.Email.SMTPPassword, "SMTP_PASSWORD")
+	setString(&c.Email.OutboxDir, "EMAIL_OUTBOX_DIR")
+
+	setString(&c.SMS.Provider, "SMS_PROVIDER")
+
+	setString(&c.Payments.Currency, "PAYMENT_CURRENCY")
+	setList(&c.Payments.Providers, "PAYMENT_PROVIDERS")
+	setString(&c.Payments.FakeWebhookSecret, "FAKE_PAYMENT_WEBHOOK_SECRET")
+	setString(&c.Payments.RazorpayKeyID, "RAZORPAY_KEY_ID")
+	setString(&c.Payments.RazorpayKeySecret, "RAZORPAY_KEY_SECRET")
+	setString(&c.Payments.RazorpayWebhookSecret, "RAZORPAY_WEBHOOK_SECRET")
+
+	if err := setBool(&c.JWT.RandomSecret, "JWT_RANDOM_SECRET"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.JWT.TTL, "JWT_TTL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.OTP.TTL, "OTP_TTL"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Idempotency.TTL, "IDEMPOTENCY_TTL"); err != nil {
+		return err
+	}
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("SMTP_PORT: %w", err)
+		}
+		c.Email.SMTPPort = port
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once so that startup fails with a complete list
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Server.ListenAddr == "" {
+		problems = append(problems, "server.listen_addr is required")
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		problems = append(problems, "server.cors_origins needs at least one origin")
+	}
+	if u, err := url.Parse(c.Server.PublicBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "server.public_base_url must be an absolute http(s) URL")
+	}
+
+	switch db.Dialect(c.Database.Driver) {
+	case db.DialectSQLite, db.DialectPostgres:
+	default:
+		problems = append(problems, fmt.Sprintf("database.driver %q is not supported", c.Database.Driver))
+	}
+	if c.Database.DSN == "" {
+		problems = append(problems, "database.dsn is required")
+	}
+
+	if c.JWT.Secret == "" && !c.JWT.RandomSecret {
+		problems = append(problems, "jwt.secret is required; set jwt.random_secret to sign with a random secret in development")
+	}
+	if c.JWT.Secret != "" && len(c.JWT.Secret) < minJWTSecretLength {
+		problems = append(problems, fmt.Sprintf("jwt.secret must be at least %d characters", minJWTSecretLength))
+	}
+	if c.JWT.Issuer == "" {
+		problems = append(problems, "jwt.issuer is required")
+	}
+	if c.JWT.TTL <= 0 {
+		problems = append(problems, "jwt.ttl must be positive")
+	}
+	if c.OTP.TTL <= 0 {
+		problems = append(problems, "otp.ttl must be positive")
+	}
+	if c.Idempotency.TTL <= 0 {
+		problems = append(problems, "idempotency.ttl must be positive")
+	}
+
+	switch c.Email.Provider {
+	case notifications.EmailProviderBrevo:
+		if c.Email.BrevoAPIKey == "" {
+			problems = append(problems, "email.brevo_api_key is required for the brevo provider")
+		}
+	case notifications.EmailProviderSMTP:
+		if c.Email.SMTPHost == "" || c.Email.SMTPPort <= 0 {
+			problems = append(problems, "email.smtp_host and email.smtp_port are required for the smtp provider")
+		}
+	case notifications.EmailProviderOutbox:
+	default:
+		problems = append(problems, fmt.Sprintf("email.provider %q is not supported", c.Email.Provider))
+	}
+	if c.Email.FromAddress == "" {
+		problems = append(problems, "email.from_address is required")
+	}
+
+	if c.SMS.Provider != notifications.SMSProviderLog {
+		problems = append(problems, fmt.Sprintf("sms.provider %q is not supported", c.SMS.Provider))
+	}
+
+	if c.Payments.Currency == "" {
+		problems = append(problems, "payments.currency is required")
+	}
+	for _, provider := range c.Payments.Providers {
+		switch provider {
+		case payments.ProviderCOD:
+		case payments.ProviderFake:
+			if c.Payments.FakeWebhookSecret == "" {
+				problems = append(problems, "payments.fake_webhook_secret is required for the fake provider")
+			}
+		case payments.ProviderRazorpay:
+			if c.Payments.RazorpayKeyID == "" || c.Payments.RazorpayKeySecret == "" || c.Payments.RazorpayWebhookSecret == "" {
+				problems = append(problems, "payments.razorpay_key_id, payments.razorpay_key_secret and payments.razorpay_webhook_secret are required for the razorpay provider")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("payments provider %q is not supported", provider))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// setString overrides the value with the environment variable when it is set
+func setString(value *string, key string) {
+	if v := os.Getenv(key); v != "" {
+		*value = v
+	}
+}
+
+// setList overrides the value with a comma separated environment variable when it is set
+func setList(value *[]string, key string) {
+	v := os.Getenv(key)
+	if v == "" {
+		return
+	}
+
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*value = items
+}
+
+// setBool overrides the value with a boolean environment variable such as "true" when it is set
+func setBool(value *bool, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*value = b
+	return nil
+}
+
+// setDuration overrides the value with a duration environment variable such as "15m" when it is set
+func setDuration(value *time.Duration, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	*value = d
+	return nil
+}
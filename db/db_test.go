@@ -0,0 +1,147 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/db/dbtest"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		dialect     db.Dialect
+		query, want string
+	}{
+		{db.DialectSQLite, `SELECT * FROM t WHERE a = ? AND b = ?`, `SELECT * FROM t WHERE a = ? AND b = ?`},
+		{db.DialectPostgres, `SELECT * FROM t WHERE a = ? AND b = ?`, `SELECT * FROM t WHERE a = $1 AND b = $2`},
+		{db.DialectPostgres, `SELECT * FROM t`, `SELECT * FROM t`},
+		{db.DialectPostgres, `UPDATE t SET note = 'why?' WHERE id = ?`, `UPDATE t SET note = 'why?' WHERE id = $1`},
+		{db.DialectPostgres, `SELECT 'it''s ?', ? FROM t`, `SELECT 'it''s ?', $1 FROM t`},
+	}
+	for _, test := range tests {
+		if got := test.dialect.Rebind(test.query); got != test.want {
+			t.Errorf("%s Rebind(%q) = %q, want %q", test.dialect, test.query, got, test.want)
+		}
+	}
+}
+
+func TestDDL(t *testing.T) {
+	query := `CREATE TABLE t (id INTEGER PRIMARY KEY AUTOINCREMENT, at DATETIME, price FLOAT, active BOOLEAN NOT NULL DEFAULT 1)`
+	if got := db.DialectSQLite.DDL(query); got != query {
+		t.Errorf("SQLite DDL changed the query to %q", got)
+	}
+	want := `CREATE TABLE t (id SERIAL PRIMARY KEY, at TIMESTAMPTZ, price DOUBLE PRECISION, active BOOLEAN NOT NULL DEFAULT TRUE)`
+	if got := db.DialectPostgres.DDL(query); got != want {
+		t.Errorf("PostgreSQL DDL = %q, want %q", got, want)
+	}
+}
+
+func TestInsertReturningID(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, repo *db.Repository) {
+		_, err := repo.Exec(repo.Dialect.DDL(`CREATE TABLE things (thing_id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL)`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first, err := repo.InsertReturningID(`INSERT INTO things (name) VALUES (?)`, "thing_id", "first")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err := repo.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := tx.InsertReturningID(`INSERT INTO things (name) VALUES (?)`, "thing_id", "second")
+		if err != nil {
+			tx.Rollback()
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if first <= 0 || second <= first {
+			t.Fatalf("IDs = %d, %d, want increasing IDs", first, second)
+		}
+		var name string
+		if err := repo.QueryRow(`SELECT name FROM things WHERE thing_id = ?`, second).Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		if name != "second" {
+			t.Errorf("row %d is %q, want %q", second, name, "second")
+		}
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := db.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 || migration.Up == "" || migration.Down == "" {
+			t.Fatalf("migration %d is %04d_%s, want version %d with an up and a down script", i, migration.Version, migration.Name, i+1)
+		}
+	}
+
+	dbtest.Run(t, func(t *testing.T, repo *db.Repository) {
+		applied, err := repo.MigrateUp()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied != len(migrations) {
+			t.Fatalf("MigrateUp applied %d migrations, want %d", applied, len(migrations))
+		}
+		if applied, err := repo.MigrateUp(); err != nil || applied != 0 {
+			t.Fatalf("MigrateUp on an up to date database = %d, %v", applied, err)
+		}
+
+		// Roll every migration back one at a time, then forward again
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if rolledBack, err := repo.MigrateDown(1); err != nil || rolledBack != 1 {
+				t.Fatalf("rolling back %04d_%s = %d, %v", migrations[i].Version, migrations[i].Name, rolledBack, err)
+			}
+			expectApplied(t, repo, i)
+		}
+		if rolledBack, err := repo.MigrateDown(1); err != nil || rolledBack != 0 {
+			t.Fatalf("MigrateDown on an empty database = %d, %v", rolledBack, err)
+		}
+
+		// Every up script runs again on the schema its down script left behind
+		if applied, err := repo.MigrateUp(); err != nil || applied != len(migrations) {
+			t.Fatalf("MigrateUp after rolling back = %d, %v", applied, err)
+		}
+		expectApplied(t, repo, len(migrations))
+	})
+}
+
+func TestMigrationsRefuseNewerSchema(t *testing.T) {
+	dbtest.RunMigrated(t, func(t *testing.T, repo *db.Repository) {
+		_, err := repo.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, CURRENT_TIMESTAMP)`, 9999, "from_the_future")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.MigrateUp(); !errors.Is(err, db.ErrSchemaAhead) {
+			t.Errorf("MigrateUp = %v, want %v", err, db.ErrSchemaAhead)
+		}
+		if _, err := repo.MigrateDown(1); !errors.Is(err, db.ErrSchemaAhead) {
+			t.Errorf("MigrateDown = %v, want %v", err, db.ErrSchemaAhead)
+		}
+	})
+}
+
+// expectApplied fails the test unless exactly the first count migrations are applied
+func expectApplied(t *testing.T, repo *db.Repository, count int) {
+	t.Helper()
+	states, err := repo.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, state := range states {
+		if applied := state.AppliedAt != nil; applied != (i < count) {
+			t.Fatalf("migration %04d_%s applied = %v with %d migrations applied", state.Version, state.Name, applied, count)
+		}
+	}
+}
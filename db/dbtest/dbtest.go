@@ -0,0 +1,117 @@
+// Package dbtest opens throwaway databases for tests. Every test gets an in-memory
+// SQLite database, and a PostgreSQL schema of its own when TEST_POSTGRES_DSN is set.
+package dbtest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gklps/mittai-backend/db"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// PostgresDSNEnv names the environment variable holding the PostgreSQL database to test against
+const PostgresDSNEnv = "TEST_POSTGRES_DSN"
+
+// Run runs test once per available dialect, each time on an empty database
+func Run(t *testing.T, test func(t *testing.T, repo *db.Repository)) {
+	t.Run(string(db.DialectSQLite), func(t *testing.T) {
+		test(t, Open(t, db.DialectSQLite))
+	})
+
+	if os.Getenv(PostgresDSNEnv) == "" {
+		return
+	}
+	t.Run(string(db.DialectPostgres), func(t *testing.T) {
+		test(t, Open(t, db.DialectPostgres))
+	})
+}
+
+// RunMigrated runs test like Run on databases brought up to date with MigrateUp
+func RunMigrated(t *testing.T, test func(t *testing.T, repo *db.Repository)) {
+	Run(t, func(t *testing.T, repo *db.Repository) {
+		if _, err := repo.MigrateUp(); err != nil {
+			t.Fatal(err)
+		}
+		test(t, repo)
+	})
+}
+
+// Open returns an empty database of the dialect that is removed when the test ends.
+// PostgreSQL tests are skipped when TEST_POSTGRES_DSN is not set.
+func Open(t *testing.T, dialect db.Dialect) *db.Repository {
+	t.Helper()
+	name := "test_" + randomSuffix(t)
+
+	var dsn string
+	switch dialect {
+	case db.DialectSQLite:
+		// Each test has a database of its own that lives as long as a connection to it is open
+		dsn = fmt.Sprintf("file:%s?mode=memory&cache=shared", name)
+	case db.DialectPostgres:
+		dsn = os.Getenv(PostgresDSNEnv)
+		if dsn == "" {
+			t.Skipf("%s is not set", PostgresDSNEnv)
+		}
+		dsn = withSearchPath(dsn, createSchema(t, dsn, name))
+	default:
+		t.Fatalf("unknown dialect %q", dialect)
+	}
+
+	conn, err := sql.Open(string(dialect), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialect == db.DialectSQLite {
+		// Shared cache connections fail on each other's table locks instead of waiting,
+		// so a single connection is kept open and transactions take turns on it
+		conn.SetMaxOpenConns(1)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return db.NewRepository(conn, dialect)
+}
+
+// createSchema creates a schema for a single test and drops it again when the test ends
+func createSchema(t *testing.T, dsn, schema string) string {
+	t.Helper()
+	conn, err := sql.Open(string(db.DialectPostgres), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("CREATE SCHEMA " + schema); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := conn.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	})
+	return schema
+}
+
+// withSearchPath adds a search_path run-time parameter to a URL or key=value DSN
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+	return dsn + "?search_path=" + schema
+}
+
+func randomSuffix(t *testing.T) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
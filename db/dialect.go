@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL flavour spoken by the database. Its value is the
+// name of the database/sql driver used to open the connection.
+type Dialect string
+
+const (
+	// DialectSQLite is the embedded SQLite database used for development and small setups
+	DialectSQLite Dialect = "sqlite3"
+	// DialectPostgres is the PostgreSQL database used in production
+	DialectPostgres Dialect = "postgres"
+)
+
+// Rebind rewrites the ? placeholders used throughout the code base into the
+// placeholder style of the dialect. Question marks inside quoted strings are kept.
+func (d Dialect) Rebind(query string) string {
+	if d != DialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+			b.WriteByte(c)
+		case c == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// postgresTypes maps the SQLite column definitions used in the schema onto PostgreSQL
+var postgresTypes = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+	"DATETIME", "TIMESTAMPTZ",
+	"FLOAT", "DOUBLE PRECISION",
+	"STRING", "TEXT",
+	"BOOLEAN NOT NULL DEFAULT 0", "BOOLEAN NOT NULL DEFAULT FALSE",
+	"BOOLEAN NOT NULL DEFAULT 1", "BOOLEAN NOT NULL DEFAULT TRUE",
+)
+
+// DDL translates a schema statement written for SQLite into the dialect
+func (d Dialect) DDL(query string) string {
+	if d != DialectPostgres {
+		return query
+	}
+	return postgresTypes.Replace(query)
+}
+
+// execQueryer is the part of *sql.DB and *sql.Tx needed to insert a row
+type execQueryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// insertReturningID runs an INSERT statement and returns the generated value of idColumn.
+// PostgreSQL drivers do not support LastInsertId, so the value is read back with RETURNING.
+func insertReturningID(q execQueryer, dialect Dialect, query, idColumn string, args ...interface{}) (int64, error) {
+	if dialect == DialectPostgres {
+		var id int64
+		err := q.QueryRow(query+" RETURNING "+idColumn, args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS otp;
+DROP TABLE IF EXISTS wishlist;
+DROP TABLE IF EXISTS purchase_items;
+DROP TABLE IF EXISTS purchases;
+DROP TABLE IF EXISTS payment_mode;
+DROP TABLE IF EXISTS cart;
+DROP TABLE IF EXISTS addresses;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS product_weights;
+DROP TABLE IF EXISTS products;
@@ -0,0 +1,109 @@
+-- Tables as they existed before versioned migrations were introduced.
+-- IF NOT EXISTS lets databases created by the old CreateTables adopt this history.
+
+CREATE TABLE IF NOT EXISTS products (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL,
+	category TEXT NOT NULL,
+	ingredients TEXT NOT NULL,
+	nutritional_info TEXT NOT NULL,
+	image_urls TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS product_weights (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	product_id INTEGER NOT NULL,
+	weight FLOAT NOT NULL,
+	price FLOAT NOT NULL,
+	measurement STRING NOT NULL,
+	stock INTEGER NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (product_id) REFERENCES products (id)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	first_name TEXT NOT NULL,
+	last_name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	contact_number TEXT NOT NULL UNIQUE,
+	verified_account BOOLEAN NOT NULL DEFAULT 0,
+	hashed_password VARCHAR(100) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS addresses (
+	address_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	address_line1 TEXT NOT NULL,
+	address_line2 TEXT,
+	city TEXT NOT NULL,
+	state TEXT NOT NULL,
+	zip_code TEXT NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS cart (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	product_weight_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users (user_id),
+	FOREIGN KEY (product_weight_id) REFERENCES product_weights (id)
+);
+
+CREATE TABLE IF NOT EXISTS payment_mode (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	mode TEXT,
+	is_active BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS purchases (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	total_price REAL,
+	address_id INTEGER,
+	payment_id INTEGER,
+	created_at DATETIME,
+	updated_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES users (user_id),
+	FOREIGN KEY (address_id) REFERENCES addresses (address_id),
+	FOREIGN KEY (payment_id) REFERENCES payment_mode (id)
+);
+
+CREATE TABLE IF NOT EXISTS purchase_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER,
+	product_id INTEGER,
+	product_name TEXT,
+	product_price REAL,
+	quantity INTEGER,
+	total_price REAL,
+	product_weight_id INTEGER,
+	FOREIGN KEY (purchase_id) REFERENCES purchases (id),
+	FOREIGN KEY (product_id) REFERENCES products (id),
+	FOREIGN KEY (product_weight_id) REFERENCES product_weights (id)
+);
+
+CREATE TABLE IF NOT EXISTS wishlist (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	product_id INTEGER,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users (user_id),
+	FOREIGN KEY (product_id) REFERENCES products (id)
+);
+
+CREATE TABLE IF NOT EXISTS otp (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	otp_value TEXT NOT NULL,
+	generated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users (user_id)
+);
@@ -0,0 +1 @@
+-- The columns are part of the initial schema on new databases, so they are kept.
@@ -0,0 +1,7 @@
+-- Columns that were added to the CREATE TABLE statements after some databases
+-- had already been created, and so never reached them. On databases created
+-- with these columns the statements are skipped.
+
+ALTER TABLE product_weights ADD COLUMN measurement TEXT NOT NULL DEFAULT '';
+ALTER TABLE product_weights ADD COLUMN stock INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN hashed_password VARCHAR(100) NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+ALTER TABLE users DROP COLUMN otp_locked_until;
+ALTER TABLE users DROP COLUMN otp_failed_attempts;
+ALTER TABLE otp DROP COLUMN attempts;
+ALTER TABLE otp DROP COLUMN consumed_at;
+ALTER TABLE otp DROP COLUMN expires_at;
+ALTER TABLE otp DROP COLUMN purpose;
@@ -0,0 +1,6 @@
+ALTER TABLE otp ADD COLUMN purpose TEXT NOT NULL DEFAULT 'verify';
+ALTER TABLE otp ADD COLUMN expires_at DATETIME;
+ALTER TABLE otp ADD COLUMN consumed_at DATETIME;
+ALTER TABLE otp ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN otp_failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN otp_locked_until DATETIME;
@@ -0,0 +1,2 @@
+ALTER TABLE purchase_items DROP COLUMN measurement;
+ALTER TABLE purchase_items DROP COLUMN weight;
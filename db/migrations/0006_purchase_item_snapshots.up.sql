@@ -0,0 +1,8 @@
+-- Purchase items keep the weight and measurement they were bought in, so that
+-- later changes to a weight variant do not rewrite order history.
+
+ALTER TABLE purchase_items ADD COLUMN weight REAL;
+ALTER TABLE purchase_items ADD COLUMN measurement TEXT;
+UPDATE purchase_items SET
+	weight = (SELECT weight FROM product_weights WHERE product_weights.id = purchase_items.product_weight_id),
+	measurement = (SELECT measurement FROM product_weights WHERE product_weights.id = purchase_items.product_weight_id);
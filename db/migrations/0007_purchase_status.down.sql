@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS purchase_status_history;
+ALTER TABLE purchases DROP COLUMN status;
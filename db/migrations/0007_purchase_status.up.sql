@@ -0,0 +1,18 @@
+-- Purchases move through statuses and every move is recorded. Purchases placed
+-- before statuses existed count as delivered: they never took stock, so they must
+-- not be cancellable into putting stock back. actor_id is the user who made the
+-- change and is NULL for changes made by the system; it has no foreign key so
+-- that history outlives deleted staff accounts.
+
+ALTER TABLE purchases ADD COLUMN status TEXT NOT NULL DEFAULT 'delivered';
+
+CREATE TABLE IF NOT EXISTS purchase_status_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER NOT NULL,
+	from_status TEXT,
+	to_status TEXT NOT NULL,
+	actor_id INTEGER,
+	note TEXT,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (purchase_id) REFERENCES purchases (id)
+);
@@ -0,0 +1,12 @@
+-- Refunds owed to customers, such as for orders cancelled after payment.
+
+CREATE TABLE IF NOT EXISTS refunds (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER NOT NULL,
+	amount REAL NOT NULL,
+	status TEXT NOT NULL,
+	reason TEXT,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (purchase_id) REFERENCES purchases (id)
+);
@@ -0,0 +1,17 @@
+-- Responses to requests sent with an Idempotency-Key header, replayed when the
+-- request is retried. status_code is NULL while the request is being processed.
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	idempotency_key TEXT NOT NULL,
+	method TEXT NOT NULL,
+	path TEXT NOT NULL,
+	request_hash TEXT NOT NULL,
+	status_code INTEGER,
+	content_type TEXT,
+	response_body TEXT,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	UNIQUE (user_id, idempotency_key)
+);
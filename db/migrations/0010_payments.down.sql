@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS payments;
+ALTER TABLE payment_mode DROP COLUMN provider;
@@ -0,0 +1,21 @@
+-- Payments collected for purchases through the provider of their payment mode.
+
+-- Existing modes get no provider, so they cannot be paid with until an admin picks
+-- one, except those whose name clearly means cash on delivery.
+ALTER TABLE payment_mode ADD COLUMN provider TEXT NOT NULL DEFAULT '';
+UPDATE payment_mode SET provider = 'cod' WHERE LOWER(TRIM(mode)) IN ('cod', 'cash on delivery', 'cash');
+
+CREATE TABLE IF NOT EXISTS payments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER NOT NULL,
+	provider TEXT NOT NULL,
+	provider_order_id TEXT NOT NULL,
+	provider_payment_id TEXT,
+	amount REAL NOT NULL,
+	currency TEXT NOT NULL,
+	status TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	UNIQUE (provider, provider_order_id),
+	FOREIGN KEY (purchase_id) REFERENCES purchases (id)
+);
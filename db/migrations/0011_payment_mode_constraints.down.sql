@@ -0,0 +1,3 @@
+ALTER TABLE payment_mode DROP COLUMN allowed_pincodes;
+ALTER TABLE payment_mode DROP COLUMN max_order_value;
+ALTER TABLE payment_mode DROP COLUMN min_order_value;
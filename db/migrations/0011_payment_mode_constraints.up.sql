@@ -0,0 +1,6 @@
+-- Limits on the orders a payment mode can be used for. A zero order value is no
+-- limit and an empty pincode list allows every pincode.
+
+ALTER TABLE payment_mode ADD COLUMN min_order_value REAL NOT NULL DEFAULT 0;
+ALTER TABLE payment_mode ADD COLUMN max_order_value REAL NOT NULL DEFAULT 0;
+ALTER TABLE payment_mode ADD COLUMN allowed_pincodes TEXT NOT NULL DEFAULT '';
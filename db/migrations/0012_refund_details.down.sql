@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS refund_items;
+ALTER TABLE purchases DROP COLUMN refunded_amount;
+ALTER TABLE refunds DROP COLUMN provider_refund_id;
+ALTER TABLE refunds DROP COLUMN payment_id;
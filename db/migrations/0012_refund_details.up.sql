@@ -0,0 +1,24 @@
+-- Refunds are returned through a payment, optionally for specific purchase items,
+-- and purchases keep a running total of what was refunded.
+
+ALTER TABLE refunds ADD COLUMN payment_id INTEGER;
+ALTER TABLE refunds ADD COLUMN provider_refund_id TEXT;
+ALTER TABLE purchases ADD COLUMN refunded_amount REAL NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS refund_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	refund_id INTEGER NOT NULL,
+	purchase_item_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	amount REAL NOT NULL,
+	FOREIGN KEY (refund_id) REFERENCES refunds (id),
+	FOREIGN KEY (purchase_item_id) REFERENCES purchase_items (id)
+);
+
+-- Refunds made so far were owed for the captured payments of cancelled purchases
+UPDATE refunds SET payment_id = (
+	SELECT MIN(id) FROM payments WHERE payments.purchase_id = refunds.purchase_id AND payments.status = 'captured')
+WHERE payment_id IS NULL;
+
+UPDATE purchases SET refunded_amount = (
+	SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE refunds.purchase_id = purchases.id);
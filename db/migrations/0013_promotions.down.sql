@@ -0,0 +1,3 @@
+ALTER TABLE purchases DROP COLUMN discount;
+DROP TABLE IF EXISTS purchase_discounts;
+DROP TABLE IF EXISTS promotions;
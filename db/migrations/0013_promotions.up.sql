@@ -0,0 +1,32 @@
+-- Promotions customers apply with a discount code, and the discount lines of the
+-- purchases they were applied to. Purchase totals are what is paid after discounts.
+
+CREATE TABLE IF NOT EXISTS promotions (
+	promotion_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	discount_code TEXT NOT NULL UNIQUE,
+	product_id INTEGER NOT NULL DEFAULT 0,
+	category TEXT NOT NULL DEFAULT '',
+	discount_type TEXT NOT NULL,
+	discount_percentage REAL NOT NULL DEFAULT 0,
+	discount_amount REAL NOT NULL DEFAULT 0,
+	min_order_value REAL NOT NULL DEFAULT 0,
+	usage_limit_per_user INTEGER NOT NULL DEFAULT 0,
+	start_date DATETIME,
+	end_date DATETIME,
+	is_active BOOLEAN NOT NULL DEFAULT 1,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS purchase_discounts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER NOT NULL,
+	promotion_id INTEGER NOT NULL,
+	discount_code TEXT NOT NULL,
+	description TEXT NOT NULL,
+	amount REAL NOT NULL,
+	FOREIGN KEY (purchase_id) REFERENCES purchases (id),
+	FOREIGN KEY (promotion_id) REFERENCES promotions (promotion_id)
+);
+
+ALTER TABLE purchases ADD COLUMN discount REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS purchase_offers;
+DROP TABLE IF EXISTS offer_tiers;
+DROP TABLE IF EXISTS offers;
@@ -0,0 +1,38 @@
+-- Offers applied automatically to carts and orders, such as buy X get Y and tiered
+-- discounts, and the discount lines they gave purchases.
+
+CREATE TABLE IF NOT EXISTS offers (
+	offer_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	offer_type TEXT NOT NULL,
+	buy_product_weight_id INTEGER NOT NULL DEFAULT 0,
+	buy_quantity INTEGER NOT NULL DEFAULT 0,
+	get_product_weight_id INTEGER NOT NULL DEFAULT 0,
+	get_quantity INTEGER NOT NULL DEFAULT 0,
+	priority INTEGER NOT NULL DEFAULT 0,
+	stackable BOOLEAN NOT NULL DEFAULT 1,
+	start_date DATETIME,
+	end_date DATETIME,
+	is_active BOOLEAN NOT NULL DEFAULT 1,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS offer_tiers (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	offer_id INTEGER NOT NULL,
+	min_order_value REAL NOT NULL,
+	discount_percentage REAL NOT NULL DEFAULT 0,
+	discount_amount REAL NOT NULL DEFAULT 0,
+	FOREIGN KEY (offer_id) REFERENCES offers (offer_id)
+);
+
+CREATE TABLE IF NOT EXISTS purchase_offers (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER NOT NULL,
+	offer_id INTEGER NOT NULL,
+	description TEXT NOT NULL,
+	amount REAL NOT NULL,
+	FOREIGN KEY (purchase_id) REFERENCES purchases (id),
+	FOREIGN KEY (offer_id) REFERENCES offers (offer_id)
+);
@@ -0,0 +1,16 @@
+-- Product reviews by customers who received the product, one per product per user.
+
+CREATE TABLE IF NOT EXISTS reviews (
+	review_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	product_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	rating INTEGER NOT NULL,
+	review_text TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'published',
+	moderation_note TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	UNIQUE (product_id, user_id),
+	FOREIGN KEY (product_id) REFERENCES products (id),
+	FOREIGN KEY (user_id) REFERENCES users (user_id)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS stock_movements;
+ALTER TABLE product_weights DROP COLUMN supplier_id;
+ALTER TABLE product_weights DROP COLUMN reorder_threshold;
+DROP TABLE IF EXISTS suppliers;
@@ -0,0 +1,30 @@
+-- Suppliers, reorder thresholds of weight variants and a ledger of stock movements
+-- that explains the stock of every variant.
+
+CREATE TABLE IF NOT EXISTS suppliers (
+	supplier_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	contact_number TEXT NOT NULL DEFAULT '',
+	email TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+ALTER TABLE product_weights ADD COLUMN reorder_threshold INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE product_weights ADD COLUMN supplier_id INTEGER;
+
+-- Movements outlive the variants they moved, so they keep no foreign key to them
+CREATE TABLE IF NOT EXISTS stock_movements (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	product_weight_id INTEGER NOT NULL,
+	movement_type TEXT NOT NULL,
+	quantity INTEGER NOT NULL,
+	purchase_id INTEGER,
+	note TEXT NOT NULL DEFAULT '',
+	actor_id INTEGER,
+	created_at DATETIME NOT NULL
+);
+
+-- The stock held so far opens the ledger
+INSERT INTO stock_movements (product_weight_id, movement_type, quantity, note, created_at)
+SELECT id, 'adjustment', stock, 'Opening balance', CURRENT_TIMESTAMP FROM product_weights WHERE stock <> 0;
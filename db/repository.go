@@ -2,218 +2,81 @@ package db
 
 import (
 	"database/sql"
-	"log"
 )
 
 type Repository struct {
 	*sql.DB
+	Dialect Dialect
 }
 
-func NewRepository(db *sql.DB) *Repository {
+func NewRepository(db *sql.DB, dialect Dialect) *Repository {
 	return &Repository{
-		DB: db,
+		DB:      db,
+		Dialect: dialect,
 	}
 }
 
-// createProductTable creates the product table in the database if it doesn't exist or modifies the table structure
-func (r *Repository) createProductTable() error {
-	query := `CREATE TABLE IF NOT EXISTS products (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		description TEXT NOT NULL,
-		category TEXT NOT NULL,
-		ingredients TEXT NOT NULL,
-		nutritional_info TEXT NOT NULL,
-		image_urls TEXT NOT NULL,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);`
-
-	_, err := r.Exec(query)
-	if err != nil {
-		return err
-	}
-
-	// Create the product_weights table if it doesn't exist
-	query = `CREATE TABLE IF NOT EXISTS product_weights (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		product_id INTEGER NOT NULL,
-		weight FLOAT NOT NULL,
-		price FLOAT NOT NULL,
-		measurement STRING NOT NULL,
-		stock INTEGER NOT NULL, -- Modified field name
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL,
-		FOREIGN KEY (product_id) REFERENCES products (id)
-	);`
-
-	_, err = r.Exec(query)
-	if err != nil {
-		return err
-	}
-
-	return nil
+// Exec executes a query after rebinding its placeholders for the dialect
+func (r *Repository) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return r.DB.Exec(r.Dialect.Rebind(query), args...)
 }
 
-func (r *Repository) createWishlistTable() error {
-	query := `CREATE TABLE IF NOT EXISTS wishlist (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER,
-		product_id INTEGER,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL,
-		FOREIGN KEY (user_id) REFERENCES users(id),
-		FOREIGN KEY (product_id) REFERENCES products(id)
-	);`
-
-	_, err := r.Exec(query)
-	return err
+// Query runs a query after rebinding its placeholders for the dialect
+func (r *Repository) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return r.DB.Query(r.Dialect.Rebind(query), args...)
 }
 
-// createUserTable creates the user table in the database if it doesn't exist or modifies the table structure
-func (r *Repository) createUserTable() error {
-	query := `CREATE TABLE IF NOT EXISTS users (
-		user_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		first_name TEXT NOT NULL,
-		last_name TEXT NOT NULL,
-		email TEXT NOT NULL,
-		contact_number TEXT NOT NULL UNIQUE,
-		verified_account BOOLEAN NOT NULL DEFAULT 0,
-		hashed_password VARCHAR(100) NOT NULL
-	);`
-
-	_, err := r.Exec(query)
-	return err
+// QueryRow runs a single row query after rebinding its placeholders for the dialect
+func (r *Repository) QueryRow(query string, args ...interface{}) *sql.Row {
+	return r.DB.QueryRow(r.Dialect.Rebind(query), args...)
 }
 
-// CreateOTPTable creates the OTP table
-func (r *Repository) createOTPTable() error {
-	query := `CREATE TABLE IF NOT EXISTS otp (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER,
-		otp_value TEXT NOT NULL,
-		generated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users (user_id)
-	);`
-
-	_, err := r.DB.Exec(query)
-	return err
+// Prepare creates a prepared statement after rebinding its placeholders for the dialect
+func (r *Repository) Prepare(query string) (*sql.Stmt, error) {
+	return r.DB.Prepare(r.Dialect.Rebind(query))
 }
 
-// createAddressTable creates the address table in the database if it doesn't exist or modifies the table structure
-func (r *Repository) createAddressTable() error {
-	query := `CREATE TABLE IF NOT EXISTS addresses (
-		address_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		address_line1 TEXT NOT NULL,
-		address_line2 TEXT,
-		city TEXT NOT NULL,
-		state TEXT NOT NULL,
-		zip_code TEXT NOT NULL,
-		FOREIGN KEY (user_id) REFERENCES users (user_id)
-	);`
-
-	_, err := r.Exec(query)
-	return err
+// Begin starts a transaction whose statements are rebound for the dialect
+func (r *Repository) Begin() (*Tx, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: r.Dialect}, nil
 }
 
-// createCartTable creates the cart table in the database if it doesn't exist or modifies the table structure
-func (r *Repository) createCartTable() error {
-	query := `CREATE TABLE IF NOT EXISTS cart (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		product_weight_id INTEGER NOT NULL,
-		quantity INTEGER NOT NULL,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL,
-		FOREIGN KEY (user_id) REFERENCES users (id),
-		FOREIGN KEY (product_weight_id) REFERENCES product_weights (id)
-	);`
-
-	_, err := r.Exec(query)
-	return err
+// InsertReturningID runs an INSERT statement and returns the generated value of idColumn
+func (r *Repository) InsertReturningID(query, idColumn string, args ...interface{}) (int64, error) {
+	return insertReturningID(r, r.Dialect, query, idColumn, args...)
 }
 
-// createPaymentModeTable creates the cart table in the database if it doesn't exist or modifies the table structure
-func (r *Repository) createPaymentModeTable() error {
-	query := `CREATE TABLE IF NOT EXISTS payment_mode (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		mode TEXT,
-		is_active BOOLEAN
-	);`
-
-	_, err := r.Exec(query)
-	return err
+// Tx is a transaction that rebinds placeholders for the dialect
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
 }
 
-// createPurchasesTable creates the cart table in the database if it doesn't exist or modifies the table structure
-func (r *Repository) createPurchasesTable() error {
-	query := `CREATE TABLE IF NOT EXISTS purchases (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER,
-		total_price REAL,
-		address_id INTEGER,
-		payment_id INTEGER,
-		created_at DATETIME,
-		updated_at DATETIME,
-		FOREIGN KEY (user_id) REFERENCES users (id),
-		FOREIGN KEY (address_id) REFERENCES addresses (id),
-		FOREIGN KEY (payment_id) REFERENCES payment_mode (id)
-	);`
-
-	_, err := r.Exec(query)
-	return err
+// Exec executes a query within the transaction
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.Dialect.Rebind(query), args...)
 }
 
-// createPurchasesItemTable creates the cart table in the database if it doesn't exist or modifies the table structure
-func (r *Repository) createPurchasesItemTable() error {
-	query := `CREATE TABLE IF NOT EXISTS purchase_items (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		purchase_id INTEGER,
-		product_id INTEGER,
-		product_name TEXT,
-		product_price REAL,
-		quantity INTEGER,
-		total_price REAL,
-		product_weight_id INTEGER,
-		FOREIGN KEY (purchase_id) REFERENCES purchases (id),
-		FOREIGN KEY (product_id) REFERENCES products (id),
-		FOREIGN KEY (product_weight_id) REFERENCES product_weights (id)
-	);
-	`
+// Query runs a query within the transaction
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.Dialect.Rebind(query), args...)
+}
 
-	_, err := r.Exec(query)
-	return err
+// QueryRow runs a single row query within the transaction
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.Dialect.Rebind(query), args...)
 }
 
-// CreateTables creates or updates all necessary tables in the database
-func (r *Repository) CreateTables() {
-	if err := r.createProductTable(); err != nil {
-		log.Fatal(err)
-	}
-	if err := r.createUserTable(); err != nil {
-		log.Fatal(err)
-	}
-	if err := r.createAddressTable(); err != nil {
-		log.Fatal(err)
-	}
-	if err := r.createCartTable(); err != nil {
-		log.Fatal(err)
-	}
-	if err := r.createPaymentModeTable(); err != nil {
-		log.Fatal(err)
-	}
-	if err := r.createPurchasesTable(); err != nil {
-		log.Fatal(err)
-	}
-	if err := r.createPurchasesItemTable(); err != nil {
-		log.Fatal(err)
-	}
-	if err := r.createWishlistTable(); err != nil {
-		log.Fatal(err)
-	}
-	if err := r.createOTPTable(); err != nil {
-		log.Fatal(err)
-	}
+// Prepare creates a prepared statement within the transaction
+func (tx *Tx) Prepare(query string) (*sql.Stmt, error) {
+	return tx.Tx.Prepare(tx.Dialect.Rebind(query))
+}
 
+// InsertReturningID runs an INSERT statement within the transaction and returns the generated value of idColumn
+func (tx *Tx) InsertReturningID(query, idColumn string, args ...interface{}) (int64, error) {
+	return insertReturningID(tx, tx.Dialect, query, idColumn, args...)
 }
@@ -1,78 +1,124 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"flag"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"time"
 
+	"github.com/gklps/mittai-backend/config"
 	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/notifications"
+	"github.com/gklps/mittai-backend/payments"
 	"github.com/gklps/mittai-backend/services"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 func main() {
-	// Get the current directory path
-	dir, err := os.Getwd()
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to an optional YAML configuration file")
+	flag.Parse()
+
+	// Load and validate the configuration before touching anything else
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatal("Failed to get the current directory:", err)
+		log.Fatal("Failed to load configuration: ", err)
 	}
 
-	// Set the path of the database file
-	dbPath := filepath.Join(dir, "database.db")
+	if db.Dialect(cfg.Database.Driver) == db.DialectSQLite {
+		if _, err := os.Stat(cfg.Database.DSN); os.IsNotExist(err) {
+			log.Println("Database file does not exist. Creating a new database.")
+		} else {
+			log.Println("Database file found. Connecting to the existing database.")
+		}
+	}
 
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		// Create a new database file
-		log.Println("Database file does not exist. Creating a new database.")
+	// Open a connection to the database
+	dbConn, err := sql.Open(cfg.Database.Driver, cfg.Database.DSN)
+	if err != nil {
+		log.Fatal("Failed to connect to the database:", err)
+	}
+	defer dbConn.Close()
+
+	// Create a new instance of the repository
+	repo := db.NewRepository(dbConn, db.Dialect(cfg.Database.Driver))
 
-		// Create the database file
-		file, err := os.Create(dbPath)
-		if err != nil {
-			log.Fatal("Failed to create the database file:", err)
+	// Subcommands such as "migrate status" work on the database and exit
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(repo, args); err != nil {
+			log.Fatal(err)
 		}
-		file.Close()
+		return
+	}
+
+	// Bring the schema up to date; a database migrated by a newer binary is refused
+	if _, err := repo.MigrateUp(); err != nil {
+		log.Fatal("Failed to migrate the database: ", err)
+	}
 
-		// Run the database initialization code here
-		// ...
+	// Configure signing of access tokens
+	utils.ConfigureJWT(jwtSecret(cfg.JWT), cfg.JWT.Issuer, cfg.JWT.TTL)
 
-	} else {
-		log.Println("Database file found. Connecting to the existing database.")
+	// Set up outgoing email
+	emailSender, err := notifications.NewEmailSender(cfg.Email)
+	if err != nil {
+		log.Fatal("Failed to configure email:", err)
 	}
 
-	// Open a connection to the SQLite database
-	dbConn, err := sql.Open("sqlite3", dbPath)
+	// Set up outgoing text messages
+	smsSender, err := notifications.NewSMSSender(cfg.SMS)
 	if err != nil {
-		log.Fatal("Failed to connect to the database:", err)
+		log.Fatal("Failed to configure SMS:", err)
 	}
-	defer dbConn.Close()
 
-	// Create a new instance of the repository
-	repo := db.NewRepository(dbConn)
+	// Set up the payment providers
+	paymentProviders, err := payments.NewProviders(cfg.Payments)
+	if err != nil {
+		log.Fatal("Failed to configure payments:", err)
+	}
 
-	// Create necessary tables in the database
-	repo.CreateTables()
+	// Create the stores backing the services
+	stores := store.NewSQLStores(repo)
 
 	// Create instances of the services
-	productService := services.NewProductService(repo)
-	productWeightService := services.NewProductWeightService(repo)
-	userService := services.NewUserService(repo)
-	cartService := services.NewCartService(repo)
-	purchaseService := services.NewPurchaseService(repo, productService, cartService)
-	paymentService := services.NewPaymentService(repo)
-	addressService := services.NewAddressService(repo)
-	wishlistService := services.NewWishlistService(repo)
+	productService := services.NewProductService(stores)
+	productWeightService := services.NewProductWeightService(stores)
+	userService := services.NewUserService(stores, emailSender, smsSender)
+	userService.BaseURL = cfg.Server.PublicBaseURL
+	userService.OTP.TTL = cfg.OTP.TTL
+	cartService := services.NewCartService(stores)
+	purchaseService := services.NewPurchaseService(stores, emailSender)
+	paymentService := services.NewPaymentService(stores, paymentProviders)
+	paymentService.Currency = cfg.Payments.Currency
+	refundService := services.NewRefundService(stores, paymentProviders)
+	promotionService := services.NewPromotionService(stores)
+	offerService := services.NewOfferService(stores)
+	reviewService := services.NewReviewService(stores)
+	supplierService := services.NewSupplierService(stores)
+	inventoryService := services.NewInventoryService(stores)
+	addressService := services.NewAddressService(stores)
+	wishlistService := services.NewWishlistService(stores)
 	// Create more instances of services as needed
 
+	// Make retried mutating requests replay their first response
+	idempotency := services.NewIdempotency(stores, cfg.Idempotency.TTL)
+	go idempotency.PurgeExpired(time.Hour)
+
 	router := mux.NewRouter()
 	corsHandler := handlers.CORS(
-		handlers.AllowedOrigins([]string{"http://localhost:3000"}),
+		handlers.AllowedOrigins(cfg.Server.CORSOrigins),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", services.IdempotencyKeyHeader}),
 	)
+	router.Use(idempotency.Middleware)
 
 	// Register the routes for each service
 	productService.RegisterRoutes(router)
@@ -81,10 +127,15 @@ func main() {
 	cartService.RegisterRoutes(router)
 	purchaseService.RegisterRoutes(router)
 	paymentService.RegisterRoutes(router)
+	refundService.RegisterRoutes(router)
+	promotionService.RegisterRoutes(router)
+	offerService.RegisterRoutes(router)
+	reviewService.RegisterRoutes(router)
+	supplierService.RegisterRoutes(router)
+	inventoryService.RegisterRoutes(router)
 	addressService.RegisterRoutes(router)
 	wishlistService.RegisterRoutes(router)
-	http.Handle("/", corsHandler(router))
-	handler := corsMiddleware(router)
+	handler := corsHandler(router)
 	// Register more services' routes as needed
 
 	//router.Use(LoggingMiddleware)
@@ -101,35 +152,27 @@ func main() {
 	router.PathPrefix("/docs/").Handler(http.StripPrefix("/docs/", http.FileServer(http.Dir("./docs"))))
 
 	// Log URLs
-	log.Println("Swagger UI (API Documentation): http://localhost:8080/swagger/")
-	log.Println("Swagger JSON Specification: http://localhost:8080/docs" + swaggerURL)
-	log.Println("Database Path:", dbPath)
+	log.Println("Swagger UI (API Documentation): " + cfg.Server.PublicBaseURL + "/swagger/")
+	log.Println("Swagger JSON Specification: " + cfg.Server.PublicBaseURL + swaggerURL)
+	log.Println("Database:", cfg.Database.Driver, cfg.Database.RedactedDSN())
 
 	// Start the HTTP server
-	http.ListenAndServe("0.0.0.0:8080", handler)
+	log.Println("Listening on", cfg.Server.ListenAddr)
+	log.Fatal(http.ListenAndServe(cfg.Server.ListenAddr, handler))
 
 }
 
-// corsMiddleware is a middleware function to set the CORS headers in the response.
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set the Access-Control-Allow-Origin header to allow requests from http://localhost:3000
-		//	for key, values := range r.Header {
-		//		log.Printf("%s: %v\n", key, values)
-		//	}
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
-		// Optionally, you can set other CORS headers, such as Access-Control-Allow-Methods, etc.
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		// Allow preflight requests (OPTIONS method) by setting appropriate headers for preflight responses
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// jwtSecret returns the configured JWT signing secret. Without one, which the
+// configuration only allows with jwt.random_secret, a random per-process secret is used.
+func jwtSecret(jwt config.JWTConfig) []byte {
+	if jwt.Secret != "" {
+		return []byte(jwt.Secret)
+	}
 
-		// Call the next handler in the chain
-		next.ServeHTTP(w, r)
-	})
+	log.Println("JWT secret is not configured. Using a random secret; tokens will not survive a restart.")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal("Failed to generate JWT secret:", err)
+	}
+	return secret
 }
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request sent with an Idempotency-Key header
+type IdempotencyRecord struct {
+	ID int
+	// UserID is the authenticated caller, or zero for anonymous requests; keys are unique per user
+	UserID int
+	Key    string
+	Method string
+	Path   string
+	// RequestHash identifies the request so that a key reused for another request is refused
+	RequestHash string
+	// StatusCode is zero while the request is being processed
+	StatusCode   int
+	ContentType  string
+	ResponseBody string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
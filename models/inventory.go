@@ -1,9 +1,68 @@
 package models
 
+import "time"
+
 // Inventory represents the inventory for a specific product weight
 type Inventory struct {
 	ProductWeightID   int `json:"product_weight_id"`
 	AvailableQuantity int `json:"available_quantity"`
-	ReorderThreshold  int `json:"reorder_threshold"`
-	SupplierID        int `json:"supplier_id"`
+	// ReorderThreshold is the stock below which the variant needs reordering; zero never reorders
+	ReorderThreshold int `json:"reorder_threshold"`
+	// SupplierID is the supplier the variant is reordered from, or zero for none
+	SupplierID int `json:"supplier_id"`
+	// ProductID, ProductName, Weight and Measurement describe the variant
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Weight      int    `json:"weight"`
+	Measurement string `json:"measurement"`
+}
+
+// NeedsReorder reports whether the stock of the variant is below its reorder threshold
+func (i *Inventory) NeedsReorder() bool {
+	return i.AvailableQuantity < i.ReorderThreshold
+}
+
+// Stock movement types
+const (
+	// StockMovementReceipt is stock received from a supplier
+	StockMovementReceipt = "receipt"
+	// StockMovementSale is stock taken by an order
+	StockMovementSale = "sale"
+	// StockMovementAdjustment is a correction, such as after a stock count, or the
+	// stock a variant was created or edited with
+	StockMovementAdjustment = "adjustment"
+	// StockMovementReturn is stock put back, by a cancelled order or returned goods
+	StockMovementReturn = "return"
+)
+
+// IsValidStockMovementType reports whether movementType is one of the stock movement types
+func IsValidStockMovementType(movementType string) bool {
+	switch movementType {
+	case StockMovementReceipt, StockMovementSale, StockMovementAdjustment, StockMovementReturn:
+		return true
+	}
+	return false
+}
+
+// StockMovement is an entry of the stock ledger of a product weight. The quantities of
+// the movements of a variant add up to its stock.
+type StockMovement struct {
+	ID              int    `json:"id"`
+	ProductWeightID int    `json:"product_weight_id"`
+	MovementType    string `json:"movement_type"`
+	// Quantity is the change in stock, negative for stock going out
+	Quantity int `json:"quantity"`
+	// PurchaseID is the purchase the movement belongs to, or zero
+	PurchaseID int    `json:"purchase_id,omitempty"`
+	Note       string `json:"note"`
+	// ActorID is the user who recorded the movement, or zero for the system
+	ActorID   int       `json:"actor_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LowStockGroup lists the variants of a supplier that need reordering
+type LowStockGroup struct {
+	// Supplier is nil for the variants without a supplier
+	Supplier *Supplier    `json:"supplier"`
+	Items    []*Inventory `json:"items"`
 }
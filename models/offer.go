@@ -0,0 +1,161 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Offer types
+const (
+	// OfferTypeBuyXGetY gives GetQuantity of a weight variant free for every BuyQuantity
+	// of another, or the same, weight variant in the order
+	OfferTypeBuyXGetY = "buy_x_get_y"
+	// OfferTypeTiered takes a discount off orders whose subtotal reaches a tier
+	OfferTypeTiered = "tiered"
+)
+
+// Offer is a rule applied automatically to every cart and order it matches, unlike a
+// Promotion, which customers apply with a discount code
+type Offer struct {
+	OfferID int `json:"offer_id"`
+	// Name describes the offer on discount lines, such as "Buy 2 kg halwa, get 250 g free"
+	Name      string `json:"name"`
+	OfferType string `json:"offer_type"`
+	// BuyProductWeightID, BuyQuantity, GetProductWeightID and GetQuantity describe a
+	// buy X get Y offer. The free items must be in the order to be given.
+	BuyProductWeightID int `json:"buy_product_weight_id"`
+	BuyQuantity        int `json:"buy_quantity"`
+	GetProductWeightID int `json:"get_product_weight_id"`
+	GetQuantity        int `json:"get_quantity"`
+	// Tiers are the discounts of a tiered offer; the highest tier the subtotal reaches applies
+	Tiers []*OfferTier `json:"tiers"`
+	// Priority orders the offers, lowest first
+	Priority int `json:"priority"`
+	// Stackable offers combine with each other. An offer that is not stackable is only
+	// applied when no offer before it was, and no offer after it is.
+	Stackable bool `json:"stackable"`
+	// StartDate and EndDate bound when the offer runs; a zero time is open-ended
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OfferTier is a discount of a tiered offer, either a percentage or an amount off
+type OfferTier struct {
+	MinOrderValue      float64 `json:"min_order_value"`
+	DiscountPercentage float64 `json:"discount_percentage"`
+	DiscountAmount     float64 `json:"discount_amount"`
+}
+
+// RunsAt reports whether the offer is active and running at a time
+func (o *Offer) RunsAt(now time.Time) bool {
+	return o.IsActive && (o.StartDate.IsZero() || !now.Before(o.StartDate)) && (o.EndDate.IsZero() || !now.After(o.EndDate))
+}
+
+// discountOn returns the discount the offer gives on items, before rounding. remaining
+// is what is left to pay after the offers applied before it.
+func (o *Offer) discountOn(items []*PurchaseItem, subtotal, remaining float64) float64 {
+	switch o.OfferType {
+	case OfferTypeBuyXGetY:
+		if o.BuyQuantity <= 0 || o.GetQuantity <= 0 {
+			return 0
+		}
+		bought, available, price := 0, 0, 0.0
+		for _, item := range items {
+			if item.ProductWeightID == o.BuyProductWeightID {
+				bought += item.Quantity
+			}
+			if item.ProductWeightID == o.GetProductWeightID {
+				available += item.Quantity
+				price = item.ProductPrice
+			}
+		}
+		free := bought / o.BuyQuantity * o.GetQuantity
+		if o.BuyProductWeightID == o.GetProductWeightID {
+			// The free items come out of the same quantity as the ones paid for
+			free = bought / (o.BuyQuantity + o.GetQuantity) * o.GetQuantity
+		}
+		if free > available {
+			free = available
+		}
+		return price * float64(free)
+
+	case OfferTypeTiered:
+		var reached *OfferTier
+		for _, tier := range o.Tiers {
+			if subtotal >= tier.MinOrderValue && (reached == nil || tier.MinOrderValue > reached.MinOrderValue) {
+				reached = tier
+			}
+		}
+		if reached == nil {
+			return 0
+		}
+		if reached.DiscountPercentage > 0 {
+			return remaining * reached.DiscountPercentage / 100
+		}
+		return reached.DiscountAmount
+	}
+	return 0
+}
+
+// ApplyOffers evaluates offers against the items of a cart or order, reading only their
+// ProductWeightID, ProductPrice and Quantity, and returns the discount lines they give.
+// Offers are taken by priority and the discounts never exceed the subtotal.
+func ApplyOffers(offers []*Offer, items []*PurchaseItem) []*PurchaseDiscount {
+	sorted := make([]*Offer, len(offers))
+	copy(sorted, offers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		return sorted[i].OfferID < sorted[j].OfferID
+	})
+
+	subtotal := 0.0
+	for _, item := range items {
+		subtotal += item.ProductPrice * float64(item.Quantity)
+	}
+
+	var discounts []*PurchaseDiscount
+	remaining := subtotal
+	for _, offer := range sorted {
+		if !offer.Stackable && len(discounts) > 0 {
+			continue
+		}
+		amount := offer.discountOn(items, subtotal, remaining)
+		if amount > remaining {
+			amount = remaining
+		}
+		amount = math.Round(amount*100) / 100
+		if amount <= 0 {
+			continue
+		}
+
+		discounts = append(discounts, &PurchaseDiscount{
+			OfferID:     offer.OfferID,
+			Description: offer.Name,
+			Amount:      amount,
+		})
+		remaining -= amount
+		if !offer.Stackable {
+			break
+		}
+	}
+	return discounts
+}
+
+// TotalDiscount returns the total of the discount lines of an order, trimming the lines
+// that would take it beyond the subtotal
+func TotalDiscount(discounts []*PurchaseDiscount, subtotal float64) float64 {
+	total := 0.0
+	for _, discount := range discounts {
+		if discount.Amount > subtotal-total {
+			discount.Amount = math.Round((subtotal-total)*100) / 100
+		}
+		total += discount.Amount
+	}
+	return total
+}
@@ -1,5 +1,20 @@
 package models
 
+import "time"
+
 type VerifyOTPRequest struct {
 	OTP string `json:"otp"`
 }
+
+// OTP is a one-time code issued to a user for a purpose such as account verification
+type OTP struct {
+	ID          int
+	UserID      int
+	Value       string
+	Purpose     string
+	GeneratedAt time.Time
+	// ExpiresAt is zero for codes issued before codes expired; those are never accepted
+	ExpiresAt  time.Time
+	ConsumedAt *time.Time
+	Attempts   int
+}
@@ -1,8 +1,137 @@
 package models
 
+import (
+	"math"
+	"time"
+)
+
 // PaymentMode represents a payment mode
 type PaymentMode struct {
 	ID       int    `json:"id"`
 	Mode     string `json:"mode"`
 	IsActive bool   `json:"is_active"`
+	// Provider names the payments provider that collects payments made with this mode.
+	// It is empty for modes migrated without one, which cannot be paid with until set.
+	Provider string `json:"provider"`
+	// MinOrderValue and MaxOrderValue bound the order totals the mode accepts; zero is no limit
+	MinOrderValue float64 `json:"min_order_value"`
+	MaxOrderValue float64 `json:"max_order_value"`
+	// AllowedPincodes restricts the mode to deliveries to these pincodes; empty allows every pincode
+	AllowedPincodes []string `json:"allowed_pincodes"`
+}
+
+// Allows reports whether the mode accepts an order of total delivered to pincode.
+// An empty pincode is not checked.
+func (m *PaymentMode) Allows(total float64, pincode string) bool {
+	if m.MinOrderValue > 0 && total < m.MinOrderValue {
+		return false
+	}
+	if m.MaxOrderValue > 0 && total > m.MaxOrderValue {
+		return false
+	}
+	return m.AllowsPincode(pincode)
+}
+
+// AllowsPincode reports whether the mode accepts deliveries to pincode.
+// An empty pincode is not checked.
+func (m *PaymentMode) AllowsPincode(pincode string) bool {
+	if pincode == "" || len(m.AllowedPincodes) == 0 {
+		return true
+	}
+	for _, allowed := range m.AllowedPincodes {
+		if allowed == pincode {
+			return true
+		}
+	}
+	return false
+}
+
+// Payment statuses
+const (
+	// PaymentStatusCreated is awaiting capture by the gateway
+	PaymentStatusCreated = "created"
+	// PaymentStatusPending is collected offline, such as cash on delivery
+	PaymentStatusPending  = "pending"
+	PaymentStatusCaptured = "captured"
+	PaymentStatusFailed   = "failed"
+)
+
+// Payment is an attempt to collect the total of a purchase through a payments provider
+type Payment struct {
+	ID                int       `json:"id"`
+	PurchaseID        int       `json:"purchase_id"`
+	Provider          string    `json:"provider"`
+	ProviderOrderID   string    `json:"provider_order_id"`
+	ProviderPaymentID string    `json:"provider_payment_id,omitempty"`
+	Amount            float64   `json:"amount"`
+	Currency          string    `json:"currency"`
+	Status            string    `json:"status"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Refund statuses
+const (
+	// RefundStatusPending is owed to the customer and not yet sent to the payment provider
+	RefundStatusPending = "pending"
+	// RefundStatusProcessing is being sent to the payment provider
+	RefundStatusProcessing = "processing"
+	// RefundStatusProcessed was returned to the customer
+	RefundStatusProcessed = "processed"
+)
+
+// Refund is money owed back to a customer for a purchase
+type Refund struct {
+	ID         int `json:"id"`
+	PurchaseID int `json:"purchase_id"`
+	// PaymentID is the payment the refund is returned through
+	PaymentID        int       `json:"payment_id"`
+	ProviderRefundID string    `json:"provider_refund_id,omitempty"`
+	Amount           float64   `json:"amount"`
+	Status           string    `json:"status"`
+	Reason           string    `json:"reason"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	// Items are the purchase items refunded; empty when an amount was refunded instead
+	Items []*RefundItem `json:"items,omitempty"`
+}
+
+// RefundItem is a quantity of a purchase item returned in a refund
+type RefundItem struct {
+	PurchaseItemID int     `json:"purchase_item_id"`
+	Quantity       int     `json:"quantity"`
+	Amount         float64 `json:"amount"`
+}
+
+// RefundItemAmount returns what was paid for quantity units of a purchase item after
+// refunded units of it were returned. The discount of the purchase is shared across its
+// items in proportion to their price and each item's share across its units, in whole
+// paise, so that returning every unit refunds exactly what was paid.
+func RefundItemAmount(items []*PurchaseItem, discount float64, itemID, refunded, quantity int) float64 {
+	// Amounts are worked out in paise
+	subtotal := 0.0
+	for _, item := range items {
+		subtotal += math.Round(item.ProductPrice * float64(item.Quantity) * 100)
+	}
+
+	// The last item takes what rounding left of the discount
+	discount = math.Round(discount * 100)
+	discountLeft := discount
+	for i, item := range items {
+		price := math.Round(item.ProductPrice * float64(item.Quantity) * 100)
+		share := discountLeft
+		if i < len(items)-1 && subtotal > 0 {
+			share = math.Round(discount * price / subtotal)
+		}
+		discountLeft -= share
+		if item.ID != itemID || item.Quantity <= 0 {
+			continue
+		}
+
+		paid := price - share
+		before := math.Round(paid * float64(refunded) / float64(item.Quantity))
+		after := math.Round(paid * float64(refunded+quantity) / float64(item.Quantity))
+		return (after - before) / 100
+	}
+	return 0
 }
@@ -14,8 +14,11 @@ type Product struct {
 	NutritionalInfo string           `json:"nutritional_info"`
 	ImageURLs       []string         `json:"image_urls"`
 	Weights         []*ProductWeight `json:"weights"`
-	CreatedAt       time.Time        `json:"created_at"`
-	UpdatedAt       time.Time        `json:"updated_at"`
+	// AverageRating and ReviewCount cover the published reviews
+	AverageRating float64   `json:"average_rating"`
+	ReviewCount   int       `json:"review_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // ProductWeight represents a specific weight variant of a product
@@ -1,11 +1,82 @@
 package models
 
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Discount types of a promotion
+const (
+	DiscountTypePercentage = "percentage"
+	DiscountTypeFixed      = "fixed"
+)
+
 // Promotion represents a product promotion in the system
 type Promotion struct {
-	PromotionID        int     `json:"promotion_id"`
-	ProductID          int     `json:"product_id"`
-	DiscountCode       string  `json:"discount_code"`
-	StartDate          string  `json:"start_date"`
-	EndDate            string  `json:"end_date"`
+	PromotionID int `json:"promotion_id"`
+	// DiscountCode is the coupon customers enter; codes are stored in upper case
+	DiscountCode string `json:"discount_code"`
+	// ProductID and Category limit the promotion to some products; zero and empty apply to every product
+	ProductID int    `json:"product_id"`
+	Category  string `json:"category"`
+	// DiscountType is DiscountTypePercentage, taking DiscountPercentage off the eligible
+	// items, or DiscountTypeFixed, taking DiscountAmount off them
+	DiscountType       string  `json:"discount_type"`
 	DiscountPercentage float64 `json:"discount_percentage"`
+	DiscountAmount     float64 `json:"discount_amount"`
+	// MinOrderValue is the order subtotal needed to use the promotion; zero is no minimum
+	MinOrderValue float64 `json:"min_order_value"`
+	// UsageLimitPerUser is how many orders a customer may use the promotion on; zero is no limit
+	UsageLimitPerUser int `json:"usage_limit_per_user"`
+	// StartDate and EndDate bound when the promotion can be used; a zero time is open-ended
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NormalizeDiscountCode returns a discount code the way it is stored
+func NormalizeDiscountCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Applies reports whether the promotion covers an item of a product in a category
+func (p *Promotion) Applies(productID int, category string) bool {
+	return (p.ProductID == 0 || p.ProductID == productID) && (p.Category == "" || p.Category == category)
+}
+
+// DiscountOn returns the discount the promotion gives on the eligible part of an
+// order, rounded to two decimals and never more than that part
+func (p *Promotion) DiscountOn(eligible float64) float64 {
+	discount := p.DiscountAmount
+	if p.DiscountType == DiscountTypePercentage {
+		discount = eligible * p.DiscountPercentage / 100
+	}
+	if discount > eligible {
+		discount = eligible
+	}
+	return math.Round(discount*100) / 100
+}
+
+// Description describes the discount for invoices
+func (p *Promotion) Description() string {
+	if p.DiscountType == DiscountTypePercentage {
+		return fmt.Sprintf("%s: %g%% off", p.DiscountCode, p.DiscountPercentage)
+	}
+	return fmt.Sprintf("%s: %.2f off", p.DiscountCode, p.DiscountAmount)
+}
+
+// PurchaseDiscount is a discount line of a cart or purchase, given either by a promotion
+// through its discount code or by an offer
+type PurchaseDiscount struct {
+	ID           int     `json:"id,omitempty"`
+	PurchaseID   int     `json:"purchase_id,omitempty"`
+	PromotionID  int     `json:"promotion_id,omitempty"`
+	DiscountCode string  `json:"discount_code,omitempty"`
+	OfferID      int     `json:"offer_id,omitempty"`
+	Description  string  `json:"description"`
+	Amount       float64 `json:"amount"`
 }
@@ -4,14 +4,73 @@ import "time"
 
 // Purchase represents a purchase made by a user
 type Purchase struct {
-	ID         int             `json:"id"`
-	UserID     int             `json:"user_id"`
-	AddressID  int             `json:"address_id"`
-	PaymentID  int             `json:"payment_id"`
-	TotalPrice float64         `json:"total_price"`
-	CreatedAt  time.Time       `json:"created_at"`
-	UpdatedAt  time.Time       `json:"updated_at"`
-	Items      []*PurchaseItem `json:"items"`
+	ID        int `json:"id"`
+	UserID    int `json:"user_id"`
+	AddressID int `json:"address_id"`
+	PaymentID int `json:"payment_id"`
+	// TotalPrice is what is paid, after Discount is taken off the price of the items
+	TotalPrice float64 `json:"total_price"`
+	Discount   float64 `json:"discount"`
+	// RefundedAmount is the total of the refunds owed or made for the purchase
+	RefundedAmount float64         `json:"refunded_amount"`
+	Status         string          `json:"status"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Items          []*PurchaseItem `json:"items"`
+	// Discounts are the discount lines making up Discount
+	Discounts []*PurchaseDiscount `json:"discounts,omitempty"`
+	// DiscountCode is the coupon the buyer applies when placing the order
+	DiscountCode string `json:"-"`
+}
+
+// Purchase statuses
+const (
+	PurchaseStatusPendingPayment = "pending_payment"
+	PurchaseStatusConfirmed      = "confirmed"
+	PurchaseStatusPreparing      = "preparing"
+	PurchaseStatusShipped        = "shipped"
+	PurchaseStatusDelivered      = "delivered"
+	PurchaseStatusCancelled      = "cancelled"
+	PurchaseStatusRefunded       = "refunded"
+)
+
+// purchaseTransitions lists the statuses a purchase may move to from each status
+var purchaseTransitions = map[string][]string{
+	PurchaseStatusPendingPayment: {PurchaseStatusConfirmed, PurchaseStatusCancelled},
+	PurchaseStatusConfirmed:      {PurchaseStatusPreparing, PurchaseStatusCancelled},
+	PurchaseStatusPreparing:      {PurchaseStatusShipped, PurchaseStatusCancelled},
+	PurchaseStatusShipped:        {PurchaseStatusDelivered},
+	PurchaseStatusDelivered:      {PurchaseStatusRefunded},
+	PurchaseStatusCancelled:      {PurchaseStatusRefunded},
+	PurchaseStatusRefunded:       {},
+}
+
+// IsValidPurchaseStatus reports whether status is a known purchase status
+func IsValidPurchaseStatus(status string) bool {
+	_, ok := purchaseTransitions[status]
+	return ok
+}
+
+// CanTransitionPurchase reports whether a purchase may move from one status to another
+func CanTransitionPurchase(from, to string) bool {
+	for _, status := range purchaseTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PurchaseStatusChange records a purchase moving from one status to another
+type PurchaseStatusChange struct {
+	ID         int    `json:"id"`
+	PurchaseID int    `json:"purchase_id"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	// ActorID is the user who made the change, or zero for the system
+	ActorID   int       `json:"actor_id"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type CreatePurchase struct {
@@ -23,6 +82,7 @@ type CreatePurchase struct {
 
 // PurchaseItem represents a purchased item
 type PurchaseItem struct {
+	ID              int     `json:"id"`
 	ProductID       int     `json:"product_id"`
 	ProductName     string  `json:"product_name"`
 	ProductWeightID int     `json:"product_weight_id"`
@@ -39,6 +99,7 @@ type PurchaseRequest struct {
 	AddressID           int                   `json:"address_id"`
 	PaymentID           int                   `json:"payment_id"`
 	PurchaseItemRequest []PurchaseItemRequest `json:"purchase_items"`
+	DiscountCode        string                `json:"discount_code"`
 }
 
 type PurchaseItemRequest struct {
@@ -1,5 +1,18 @@
 package models
 
+import "time"
+
+// Review statuses. Reviews are published when posted and admins can hide them.
+const (
+	ReviewStatusPublished = "published"
+	ReviewStatusHidden    = "hidden"
+)
+
+// IsValidReviewStatus reports whether status is one of the review statuses
+func IsValidReviewStatus(status string) bool {
+	return status == ReviewStatusPublished || status == ReviewStatusHidden
+}
+
 // Review represents a product review in the system
 //sort:
 //category
@@ -7,10 +20,15 @@ package models
 //recently added
 
 type Review struct {
-	ReviewID   int    `json:"review_id"`
-	ProductID  int    `json:"product_id"`
-	UserID     int    `json:"user_id"`
+	ReviewID  int `json:"review_id"`
+	ProductID int `json:"product_id"`
+	UserID    int `json:"user_id"`
+	// Rating is from 1 to 5 stars
 	Rating     int    `json:"rating"`
 	ReviewText string `json:"review_text"`
-	ReviewDate string `json:"review_date"`
+	Status     string `json:"status"`
+	// ModerationNote is the reason an admin gave for hiding the review
+	ModerationNote string    `json:"moderation_note,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
@@ -1,9 +1,13 @@
 package models
 
+import "time"
+
 // Supplier represents a supplier in the system
 type Supplier struct {
-	SupplierID    int    `json:"supplier_id"`
-	Name          string `json:"name"`
-	ContactNumber string `json:"contact_number"`
-	Email         string `json:"email"`
+	SupplierID    int       `json:"supplier_id"`
+	Name          string    `json:"name"`
+	ContactNumber string    `json:"contact_number"`
+	Email         string    `json:"email"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
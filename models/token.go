@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RefreshToken is a stored refresh token. Only the hash of the token is kept.
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	// FamilyID groups every token rotated from the same login
+	FamilyID  string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+}
@@ -10,6 +10,7 @@ type User struct {
 	Address         *[]*Address `json:"address"`
 	VerifiedAccount bool        `json:"verifiedAccount"`
 	Password        string      `json:"password"`
+	Role            string      `json:"role"`
 	// isactive  		bool        `json:"isactive"`
 }
 
@@ -0,0 +1,76 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const brevoSendURL = "https://api.brevo.com/v3/smtp/email"
+
+// BrevoSender sends emails through the Brevo transactional email API
+type BrevoSender struct {
+	APIKey      string
+	FromName    string
+	FromAddress string
+	Client      *http.Client
+}
+
+// NewBrevoSender creates a new instance of BrevoSender
+func NewBrevoSender(apiKey, fromName, fromAddress string) *BrevoSender {
+	return &BrevoSender{
+		APIKey:      apiKey,
+		FromName:    fromName,
+		FromAddress: fromAddress,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send delivers the email through Brevo
+func (bs *BrevoSender) Send(email Email) error {
+	payload := map[string]interface{}{
+		"sender": map[string]string{
+			"name":  bs.FromName,
+			"email": bs.FromAddress,
+		},
+		"to": []map[string]string{
+			{
+				"email": email.To,
+			},
+		},
+		"subject":     email.Subject,
+		"htmlContent": email.HTML,
+	}
+	if email.Text != "" {
+		payload["textContent"] = email.Text
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, brevoSendURL, bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("api-key", bs.APIKey)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := bs.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		var errorResponse map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&errorResponse)
+		return fmt.Errorf("brevo returned status %d: %v", resp.StatusCode, errorResponse)
+	}
+
+	return nil
+}
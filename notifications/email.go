@@ -0,0 +1,75 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+)
+
+// Email represents a rendered email ready to be delivered
+type Email struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// EmailSender delivers emails through a provider
+type EmailSender interface {
+	Send(email Email) error
+}
+
+// Email providers selectable through EmailConfig.Provider
+const (
+	EmailProviderBrevo  = "brevo"
+	EmailProviderSMTP   = "smtp"
+	EmailProviderOutbox = "outbox"
+)
+
+// EmailConfig holds the settings needed to build an EmailSender
+type EmailConfig struct {
+	Provider    string `yaml:"provider"`
+	FromName    string `yaml:"from_name"`
+	FromAddress string `yaml:"from_address"`
+
+	BrevoAPIKey string `yaml:"brevo_api_key"`
+
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+
+	OutboxDir string `yaml:"outbox_dir"`
+}
+
+// NewEmailSender creates the EmailSender selected by the configuration
+func NewEmailSender(cfg EmailConfig) (EmailSender, error) {
+	switch cfg.Provider {
+	case EmailProviderBrevo:
+		if cfg.BrevoAPIKey == "" {
+			return nil, fmt.Errorf("brevo email provider requires an API key")
+		}
+		return NewBrevoSender(cfg.BrevoAPIKey, cfg.FromName, cfg.FromAddress), nil
+	case EmailProviderSMTP:
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("smtp email provider requires a host")
+		}
+		return NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.FromName, cfg.FromAddress), nil
+	case EmailProviderOutbox, "":
+		dir := cfg.OutboxDir
+		if dir == "" {
+			dir = "outbox"
+		}
+		log.Println("Emails are written to the outbox directory:", dir)
+		return NewOutboxSender(dir, cfg.FromName, cfg.FromAddress), nil
+	default:
+		return nil, fmt.Errorf("unknown email provider %q", cfg.Provider)
+	}
+}
+
+// formatAddress formats a display name and address for email headers
+func formatAddress(name, address string) string {
+	if name == "" {
+		return address
+	}
+	return fmt.Sprintf("%s <%s>", name, address)
+}
@@ -0,0 +1,42 @@
+package notifications
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+// OutboxSender writes emails to a directory instead of delivering them.
+// It is meant for development and tests, where no provider is reachable.
+type OutboxSender struct {
+	Dir         string
+	FromName    string
+	FromAddress string
+	counter     uint64
+}
+
+// NewOutboxSender creates a new instance of OutboxSender
+func NewOutboxSender(dir, fromName, fromAddress string) *OutboxSender {
+	return &OutboxSender{
+		Dir:         dir,
+		FromName:    fromName,
+		FromAddress: fromAddress,
+	}
+}
+
+// Send writes the email to a new .eml file in the outbox directory
+func (ob *OutboxSender) Send(email Email) error {
+	if err := os.MkdirAll(ob.Dir, 0o755); err != nil {
+		return err
+	}
+
+	n := atomic.AddUint64(&ob.counter, 1)
+	name := fmt.Sprintf("%s-%03d-%s.eml", time.Now().Format("20060102T150405.000"), n, unsafeFileChars.ReplaceAllString(email.To, "_"))
+	message := buildMessage(formatAddress(ob.FromName, ob.FromAddress), email)
+	return os.WriteFile(filepath.Join(ob.Dir, name), message, 0o644)
+}
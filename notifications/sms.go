@@ -0,0 +1,55 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// SMS represents a text message ready to be delivered
+type SMS struct {
+	To   string
+	Body string
+}
+
+// SMSSender delivers text messages through a provider
+type SMSSender interface {
+	Send(sms SMS) error
+}
+
+// SMSProviderLog selects the LogSMSSender
+const SMSProviderLog = "log"
+
+// SMSConfig holds the settings needed to build an SMSSender
+type SMSConfig struct {
+	Provider string `yaml:"provider"`
+}
+
+// NewSMSSender creates the SMSSender selected by the configuration
+func NewSMSSender(cfg SMSConfig) (SMSSender, error) {
+	switch cfg.Provider {
+	case SMSProviderLog, "":
+		log.Println("Text messages are written to the log")
+		return LogSMSSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", cfg.Provider)
+	}
+}
+
+// LogSMSSender writes text messages to the log instead of delivering them.
+// It is meant for development and tests, where no provider is available.
+type LogSMSSender struct{}
+
+// Send logs the text message
+func (LogSMSSender) Send(sms SMS) error {
+	log.Printf("SMS to %s: %s", sms.To, sms.Body)
+	return nil
+}
+
+// LoginOTPSMS renders the text message carrying a login code
+func LoginOTPSMS(to, otp string, ttl time.Duration) SMS {
+	return SMS{
+		To:   to,
+		Body: fmt.Sprintf("%s is your Mittaitheruvu login code. It expires in %d minutes. Do not share it with anyone.", otp, int(ttl.Minutes())),
+	}
+}
@@ -0,0 +1,69 @@
+package notifications
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPSender sends emails through an SMTP server
+type SMTPSender struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	FromName    string
+	FromAddress string
+}
+
+// NewSMTPSender creates a new instance of SMTPSender
+func NewSMTPSender(host string, port int, username, password, fromName, fromAddress string) *SMTPSender {
+	if port == 0 {
+		port = 587
+	}
+	return &SMTPSender{
+		Host:        host,
+		Port:        port,
+		Username:    username,
+		Password:    password,
+		FromName:    fromName,
+		FromAddress: fromAddress,
+	}
+}
+
+// Send delivers the email through the SMTP server
+func (ss *SMTPSender) Send(email Email) error {
+	var auth smtp.Auth
+	if ss.Username != "" {
+		auth = smtp.PlainAuth("", ss.Username, ss.Password, ss.Host)
+	}
+
+	addr := net.JoinHostPort(ss.Host, strconv.Itoa(ss.Port))
+	message := buildMessage(formatAddress(ss.FromName, ss.FromAddress), email)
+	return smtp.SendMail(addr, auth, ss.FromAddress, []string{email.To}, message)
+}
+
+// buildMessage renders the email as a MIME message with HTML and optional text parts
+func buildMessage(from string, email Email) []byte {
+	var buf bytes.Buffer
+	boundary := fmt.Sprintf("mittai-%d", time.Now().UnixNano())
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", email.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	if email.Text != "" {
+		fmt.Fprintf(&buf, "--%s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", boundary, email.Text)
+	}
+	fmt.Fprintf(&buf, "--%s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n", boundary, email.HTML)
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes()
+}
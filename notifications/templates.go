@@ -0,0 +1,166 @@
+package notifications
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// OTPEmailData holds the values rendered into account verification emails
+type OTPEmailData struct {
+	OTP        string
+	VerifyLink string
+}
+
+// PasswordResetEmailData holds the values rendered into password reset emails
+type PasswordResetEmailData struct {
+	OTP              string
+	ExpiresInMinutes int
+}
+
+// OrderEmailItem is a purchased item listed in order emails
+type OrderEmailItem struct {
+	Name        string
+	Weight      float64
+	Measurement string
+	Quantity    int
+	TotalPrice  float64
+}
+
+// OrderEmailDiscount is a discount line listed in order emails
+type OrderEmailDiscount struct {
+	Description string
+	Amount      float64
+}
+
+// OrderConfirmationEmailData holds the values rendered into order confirmation emails
+type OrderConfirmationEmailData struct {
+	CustomerName string
+	OrderID      int
+	Items        []OrderEmailItem
+	Discounts    []OrderEmailDiscount
+	TotalPrice   float64
+}
+
+// ShipmentEmailData holds the values rendered into shipment emails
+type ShipmentEmailData struct {
+	CustomerName   string
+	OrderID        int
+	Carrier        string
+	TrackingNumber string
+}
+
+// emailTemplate renders the subject and bodies of one kind of email
+type emailTemplate struct {
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+}
+
+func newEmailTemplate(name, subject, html, text string) *emailTemplate {
+	return &emailTemplate{
+		subject: texttemplate.Must(texttemplate.New(name + "-subject").Parse(subject)),
+		html:    htmltemplate.Must(htmltemplate.New(name + "-html").Parse(html)),
+		text:    texttemplate.Must(texttemplate.New(name + "-text").Parse(text)),
+	}
+}
+
+// render executes the templates for the recipient and data
+func (et *emailTemplate) render(to string, data interface{}) (Email, error) {
+	var subject, html, text bytes.Buffer
+	if err := et.subject.Execute(&subject, data); err != nil {
+		return Email{}, err
+	}
+	if err := et.html.Execute(&html, data); err != nil {
+		return Email{}, err
+	}
+	if err := et.text.Execute(&text, data); err != nil {
+		return Email{}, err
+	}
+
+	return Email{
+		To:      to,
+		Subject: subject.String(),
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
+
+var otpTemplate = newEmailTemplate("otp",
+	`Your Mittaitheruvu verification code`,
+	`<!DOCTYPE html><html><head><title>OTP Email</title></head><body>
+<h1>Your OTP is: {{.OTP}}</h1>
+<p>Click <a href="{{.VerifyLink}}">here</a> to confirm your account.</p>
+</body></html>`,
+	`Your OTP is: {{.OTP}}
+
+Confirm your account at {{.VerifyLink}}
+`)
+
+var passwordResetTemplate = newEmailTemplate("password-reset",
+	`Reset your Mittaitheruvu password`,
+	`<!DOCTYPE html><html><head><title>Password Reset</title></head><body>
+<h1>Your password reset code is: {{.OTP}}</h1>
+<p>The code expires in {{.ExpiresInMinutes}} minutes. If you did not ask to reset your password, you can ignore this email.</p>
+</body></html>`,
+	`Your password reset code is: {{.OTP}}
+
+The code expires in {{.ExpiresInMinutes}} minutes. If you did not ask to reset your password, you can ignore this email.
+`)
+
+var orderConfirmationTemplate = newEmailTemplate("order-confirmation",
+	`Your Mittaitheruvu order #{{.OrderID}} is confirmed`,
+	`<!DOCTYPE html><html><head><title>Order Confirmation</title></head><body>
+<h1>Thank you for your order, {{.CustomerName}}!</h1>
+<p>We have received order #{{.OrderID}}.</p>
+<table>
+<tr><th>Item</th><th>Weight</th><th>Quantity</th><th>Total</th></tr>
+{{range .Items}}<tr><td>{{.Name}}</td><td>{{.Weight}} {{.Measurement}}</td><td>{{.Quantity}}</td><td>₹{{printf "%.2f" .TotalPrice}}</td></tr>
+{{end}}{{range .Discounts}}<tr><td colspan="3">{{.Description}}</td><td>-₹{{printf "%.2f" .Amount}}</td></tr>
+{{end}}</table>
+<p><strong>Order total: ₹{{printf "%.2f" .TotalPrice}}</strong></p>
+</body></html>`,
+	`Thank you for your order, {{.CustomerName}}!
+
+We have received order #{{.OrderID}}.
+{{range .Items}}
+- {{.Name}} {{.Weight}} {{.Measurement}} x {{.Quantity}}: ₹{{printf "%.2f" .TotalPrice}}{{end}}{{range .Discounts}}
+- {{.Description}}: -₹{{printf "%.2f" .Amount}}{{end}}
+
+Order total: ₹{{printf "%.2f" .TotalPrice}}
+`)
+
+var shipmentTemplate = newEmailTemplate("shipment",
+	`Your Mittaitheruvu order #{{.OrderID}} has shipped`,
+	`<!DOCTYPE html><html><head><title>Order Shipped</title></head><body>
+<h1>Good news, {{.CustomerName}}!</h1>
+<p>Order #{{.OrderID}} is on its way.</p>
+{{if .TrackingNumber}}<p>Carrier: {{.Carrier}}<br>Tracking number: {{.TrackingNumber}}</p>{{end}}
+</body></html>`,
+	`Good news, {{.CustomerName}}!
+
+Order #{{.OrderID}} is on its way.
+{{if .TrackingNumber}}
+Carrier: {{.Carrier}}
+Tracking number: {{.TrackingNumber}}
+{{end}}`)
+
+// OTPEmail renders the account verification email
+func OTPEmail(to string, data OTPEmailData) (Email, error) {
+	return otpTemplate.render(to, data)
+}
+
+// PasswordResetEmail renders the password reset email
+func PasswordResetEmail(to string, data PasswordResetEmailData) (Email, error) {
+	return passwordResetTemplate.render(to, data)
+}
+
+// OrderConfirmationEmail renders the order confirmation email
+func OrderConfirmationEmail(to string, data OrderConfirmationEmailData) (Email, error) {
+	return orderConfirmationTemplate.render(to, data)
+}
+
+// ShipmentEmail renders the email sent when an order ships
+func ShipmentEmail(to string, data ShipmentEmailData) (Email, error) {
+	return shipmentTemplate.render(to, data)
+}
@@ -0,0 +1,39 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// CODProvider takes cash on delivery. Nothing is collected online, so it has no
+// webhooks and refunds are settled in person.
+type CODProvider struct{}
+
+// NewCODProvider creates a new instance of CODProvider
+func NewCODProvider() *CODProvider {
+	return &CODProvider{}
+}
+
+// Name returns the provider name
+func (CODProvider) Name() string {
+	return ProviderCOD
+}
+
+// CreateOrder returns an offline order for the purchase
+func (CODProvider) CreateOrder(purchaseID int, amount float64, currency string) (*Order, error) {
+	return &Order{
+		ID:      fmt.Sprintf("cod_%d", purchaseID),
+		Offline: true,
+	}, nil
+}
+
+// ParseWebhook always fails; cash on delivery has no webhooks
+func (CODProvider) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	return nil, errors.New("cash on delivery has no webhooks")
+}
+
+// Refund records nothing with a gateway; the cash is returned in person
+func (CODProvider) Refund(paymentID string, amount float64) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,116 @@
+// Package payments collects payments for purchases through payment gateways.
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Provider collects payments through a payment gateway
+type Provider interface {
+	// Name identifies the provider in payment modes, stored payments and webhook URLs
+	Name() string
+	// CreateOrder asks the gateway to collect amount for a purchase
+	CreateOrder(purchaseID int, amount float64, currency string) (*Order, error)
+	// ParseWebhook checks the signature of a webhook call and decodes its event.
+	// It returns ErrInvalidSignature when the call was not signed by the gateway.
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+	// Refund returns amount of a captured payment to the customer and returns the gateway's refund ID
+	Refund(paymentID string, amount float64) (string, error)
+}
+
+// Order is a gateway's request to collect a payment
+type Order struct {
+	// ID is the gateway's order ID, which the client passes to the gateway's checkout
+	ID string
+	// Offline is set when nothing is collected online, as with cash on delivery
+	Offline bool
+}
+
+// Webhook event types
+const (
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+)
+
+// Event is a payment update reported through a gateway webhook
+type Event struct {
+	Type      string
+	OrderID   string
+	PaymentID string
+	// Amount is the amount of the payment in currency units, such as rupees
+	Amount   float64
+	Currency string
+}
+
+// SameAmount reports whether two amounts are equal to the smallest currency unit
+func SameAmount(a, b float64) bool {
+	return toSubunits(a) == toSubunits(b)
+}
+
+// ErrInvalidSignature is returned for webhook calls whose signature does not match
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Payment providers selectable through Config.Providers
+const (
+	ProviderCOD      = "cod"
+	ProviderFake     = "fake"
+	ProviderRazorpay = "razorpay"
+)
+
+// Config holds the settings needed to build the payment providers
+type Config struct {
+	// Currency is the ISO code of the currency prices are in
+	Currency string `yaml:"currency"`
+	// Providers are the names of the enabled providers
+	Providers []string `yaml:"providers"`
+
+	FakeWebhookSecret string `yaml:"fake_webhook_secret"`
+
+	RazorpayKeyID         string `yaml:"razorpay_key_id"`
+	RazorpayKeySecret     string `yaml:"razorpay_key_secret"`
+	RazorpayWebhookSecret string `yaml:"razorpay_webhook_secret"`
+}
+
+// NewProviders creates the providers enabled by the configuration, keyed by name
+func NewProviders(cfg Config) (map[string]Provider, error) {
+	providers := map[string]Provider{}
+	for _, name := range cfg.Providers {
+		switch name {
+		case ProviderCOD:
+			providers[name] = NewCODProvider()
+		case ProviderFake:
+			if cfg.FakeWebhookSecret == "" {
+				return nil, fmt.Errorf("fake payment provider requires a webhook secret")
+			}
+			providers[name] = NewFakeProvider(cfg.FakeWebhookSecret)
+		case ProviderRazorpay:
+			if cfg.RazorpayKeyID == "" || cfg.RazorpayKeySecret == "" || cfg.RazorpayWebhookSecret == "" {
+				return nil, fmt.Errorf("razorpay payment provider requires a key ID, key secret and webhook secret")
+			}
+			providers[name] = NewRazorpayProvider(cfg.RazorpayKeyID, cfg.RazorpayKeySecret, cfg.RazorpayWebhookSecret)
+		default:
+			return nil, fmt.Errorf("unknown payment provider %q", name)
+		}
+	}
+	return providers, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the payload
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature checks a hex encoded HMAC-SHA256 signature of the payload in constant time
+func verifySignature(secret string, payload []byte, signature string) error {
+	if !hmac.Equal([]byte(sign(secret, payload)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package payments
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte("The quick brown fox jumps over the lazy dog")
+	// HMAC-SHA256 of payload with the key "key"
+	const signature = "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+
+	tests := []struct {
+		name      string
+		secret    string
+		payload   []byte
+		signature string
+		valid     bool
+	}{
+		{"matching", "key", payload, signature, true},
+		{"other secret", "other key", payload, signature, false},
+		{"changed payload", "key", []byte("The quick brown fox jumps over the lazy cat"), signature, false},
+		{"truncated", "key", payload, signature[:32], false},
+		{"missing", "key", payload, "", false},
+	}
+	for _, test := range tests {
+		err := verifySignature(test.secret, test.payload, test.signature)
+		if test.valid && err != nil {
+			t.Errorf("%s signature: %v", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s signature = %v, want %v", test.name, err, ErrInvalidSignature)
+		}
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	const secret = "webhook secret"
+	razorpayPayload := []byte(`{"event": "payment.captured", "payload": {"payment": {"entity": {"id": "pay_1", "order_id": "order_1", "amount": 19050, "currency": "INR"}}}}`)
+	fakePayload := []byte(`{"event": "payment.captured", "order_id": "order_1", "payment_id": "pay_1", "amount": 190.5, "currency": "INR"}`)
+
+	providers := []struct {
+		provider Provider
+		header   string
+		payload  []byte
+	}{
+		{NewRazorpayProvider("key_id", "key_secret", secret), RazorpaySignatureHeader, razorpayPayload},
+		{NewFakeProvider(secret), FakeSignatureHeader, fakePayload},
+	}
+	for _, p := range providers {
+		tests := []struct {
+			name      string
+			signature string
+			valid     bool
+		}{
+			{"good", sign(secret, p.payload), true},
+			{"bad", sign("another secret", p.payload), false},
+			{"missing", "", false},
+		}
+		for _, test := range tests {
+			header := http.Header{}
+			if test.signature != "" {
+				header.Set(p.header, test.signature)
+			}
+			event, err := p.provider.ParseWebhook(p.payload, header)
+			if !test.valid {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Errorf("%s webhook with a %s signature = %v, want %v", p.provider.Name(), test.name, err, ErrInvalidSignature)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s webhook with a %s signature: %v", p.provider.Name(), test.name, err)
+				continue
+			}
+			want := Event{Type: EventPaymentCaptured, OrderID: "order_1", PaymentID: "pay_1", Amount: 190.5, Currency: "INR"}
+			if *event != want {
+				t.Errorf("%s event = %+v, want %+v", p.provider.Name(), *event, want)
+			}
+		}
+	}
+}
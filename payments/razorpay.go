@@ -0,0 +1,137 @@
+package payments
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+const razorpayAPIURL = "https://api.razorpay.com/v1"
+
+// RazorpaySignatureHeader carries the signature of Razorpay webhook calls
+const RazorpaySignatureHeader = "X-Razorpay-Signature"
+
+// RazorpayProvider collects payments through Razorpay
+type RazorpayProvider struct {
+	KeyID         string
+	KeySecret     string
+	WebhookSecret string
+	Client        *http.Client
+}
+
+// NewRazorpayProvider creates a new instance of RazorpayProvider
+func NewRazorpayProvider(keyID, keySecret, webhookSecret string) *RazorpayProvider {
+	return &RazorpayProvider{
+		KeyID:         keyID,
+		KeySecret:     keySecret,
+		WebhookSecret: webhookSecret,
+		Client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the provider name
+func (rp *RazorpayProvider) Name() string {
+	return ProviderRazorpay
+}
+
+// CreateOrder creates a Razorpay order for the purchase
+func (rp *RazorpayProvider) CreateOrder(purchaseID int, amount float64, currency string) (*Order, error) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	err := rp.post("/orders", map[string]interface{}{
+		"amount":   toSubunits(amount),
+		"currency": currency,
+		"receipt":  fmt.Sprintf("purchase_%d", purchaseID),
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &Order{ID: response.ID}, nil
+}
+
+// razorpayWebhook is the part of Razorpay payment webhooks that is used
+type razorpayWebhook struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity struct {
+				ID      string `json:"id"`
+				OrderID string `json:"order_id"`
+				// Amount is in subunits, such as paise
+				Amount   int64  `json:"amount"`
+				Currency string `json:"currency"`
+			} `json:"entity"`
+		} `json:"payment"`
+	} `json:"payload"`
+}
+
+// ParseWebhook checks the signature in RazorpaySignatureHeader and decodes the event
+func (rp *RazorpayProvider) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := verifySignature(rp.WebhookSecret, payload, header.Get(RazorpaySignatureHeader)); err != nil {
+		return nil, err
+	}
+
+	var webhook razorpayWebhook
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil, err
+	}
+	return &Event{
+		Type:      webhook.Event,
+		OrderID:   webhook.Payload.Payment.Entity.OrderID,
+		PaymentID: webhook.Payload.Payment.Entity.ID,
+		Amount:    float64(webhook.Payload.Payment.Entity.Amount) / 100,
+		Currency:  webhook.Payload.Payment.Entity.Currency,
+	}, nil
+}
+
+// Refund refunds amount of a captured Razorpay payment
+func (rp *RazorpayProvider) Refund(paymentID string, amount float64) (string, error) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	err := rp.post("/payments/"+paymentID+"/refund", map[string]interface{}{
+		"amount": toSubunits(amount),
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+	return response.ID, nil
+}
+
+// post calls the Razorpay API and decodes its response
+func (rp *RazorpayProvider) post(path string, payload interface{}, response interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, razorpayAPIURL+path, bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(rp.KeyID, rp.KeySecret)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := rp.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		var errorResponse map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&errorResponse)
+		return fmt.Errorf("razorpay returned status %d: %v", resp.StatusCode, errorResponse)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// toSubunits converts an amount to the smallest currency unit, such as paise, that Razorpay expects
+func toSubunits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -6,30 +6,31 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/gklps/mittai-backend/db"
 	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
 	"github.com/gorilla/mux"
 )
 
 // AddressService represents a service for address-related operations
 type AddressService struct {
-	DB *db.Repository
+	Addresses store.AddressStore
 }
 
 // NewAddressService creates a new AddressService instance
-func NewAddressService(db *db.Repository) *AddressService {
+func NewAddressService(stores *store.Stores) *AddressService {
 	return &AddressService{
-		DB: db,
+		Addresses: stores.Addresses,
 	}
 }
 
 // RegisterRoutes registers the address service routes
 func (as *AddressService) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/addresses", as.CreateAddress).Methods("POST")
-	r.HandleFunc("/addresses/{id}", as.GetAddressByID).Methods("GET")
-	r.HandleFunc("/addresses/{id}", as.UpdateAddress).Methods("PUT")
-	r.HandleFunc("/addresses/{id}", as.DeleteAddress).Methods("DELETE")
-	r.HandleFunc("/users/{user_id}/addresses", as.GetAddressesByUserID).Methods("GET")
+	r.HandleFunc("/addresses", utils.AuthenticateFunc(as.CreateAddress)).Methods("POST")
+	r.HandleFunc("/addresses/{id}", utils.AuthenticateFunc(as.GetAddressByID)).Methods("GET")
+	r.HandleFunc("/addresses/{id}", utils.AuthenticateFunc(as.UpdateAddress)).Methods("PUT")
+	r.HandleFunc("/addresses/{id}", utils.AuthenticateFunc(as.DeleteAddress)).Methods("DELETE")
+	r.HandleFunc("/users/{user_id}/addresses", utils.AuthenticateFunc(as.GetAddressesByUserID)).Methods("GET")
 
 }
 
@@ -41,6 +42,7 @@ func (as *AddressService) RegisterRoutes(r *mux.Router) {
 // @Param address body models.Address true "Address object"
 // @Success 200 {object} CreateAddressResponse "Address created successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to create address"
 // @Router /addresses [post]
 func (as *AddressService) CreateAddress(w http.ResponseWriter, r *http.Request) {
@@ -52,8 +54,14 @@ func (as *AddressService) CreateAddress(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	userID, ok := utils.ActingUserID(w, r, address.UserID)
+	if !ok {
+		return
+	}
+	address.UserID = userID
+
 	// Save the address to the database and get the newly created address ID
-	addressID, err := as.saveAddress(&address)
+	err = as.Addresses.Create(&address)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to create address", http.StatusInternalServerError)
@@ -63,28 +71,11 @@ func (as *AddressService) CreateAddress(w http.ResponseWriter, r *http.Request)
 	// Send the response with the newly created address ID
 	w.Header().Set("Content-Type", "application/json")
 	response := CreateAddressResponse{
-		AddressID: addressID,
+		AddressID: address.AddressID,
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-func (as *AddressService) saveAddress(address *models.Address) (int, error) {
-	// Save the address to the 'addresses' table
-	query := `INSERT INTO addresses (user_id, address_line1, address_line2, city, state, zip_code) VALUES (?, ?, ?, ?, ?, ?)`
-	result, err := as.DB.Exec(query, address.UserID, address.AddressLine1, address.AddressLine2, address.City, address.State, address.ZipCode)
-	if err != nil {
-		return 0, err
-	}
-
-	// Get the auto-generated address ID
-	addressID, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(addressID), nil
-}
-
 // CreateAddressResponse represents the response model for the CreateAddress endpoint
 type CreateAddressResponse struct {
 	AddressID int `json:"address_id"`
@@ -97,16 +88,16 @@ type CreateAddressResponse struct {
 // @Produce json
 // @Param id path string true "Address ID"
 // @Success 200 {object} models.Address "Address retrieved successfully"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Address not found"
 // @Failure 500 {object} ErrorResponse "Failed to retrieve address"
 // @Router /addresses/{id} [get]
 func (as *AddressService) GetAddressByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	addressID := vars["id"]
 
-	address, err := as.getAddressByID(addressID)
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to retrieve address", http.StatusInternalServerError)
+	address := as.authorizeAddress(w, r, addressID)
+	if address == nil {
 		return
 	}
 
@@ -115,18 +106,30 @@ func (as *AddressService) GetAddressByID(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(address)
 }
 
-func (as *AddressService) getAddressByID(addressID string) (*models.Address, error) {
-	// Get the address from the 'addresses' table
-	query := `SELECT * FROM addresses WHERE address_id = ?`
-	row := as.DB.QueryRow(query, addressID)
+// authorizeAddress loads an address and checks that the caller may act on it.
+// It writes the error response and returns nil when the request must be rejected.
+func (as *AddressService) authorizeAddress(w http.ResponseWriter, r *http.Request, addressID string) *models.Address {
+	id, err := strconv.Atoi(addressID)
+	if err != nil {
+		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		return nil
+	}
 
-	address := &models.Address{}
-	err := row.Scan(&address.AddressID, &address.UserID, &address.AddressLine1, &address.AddressLine2, &address.City, &address.State, &address.ZipCode)
+	address, err := as.Addresses.Get(id)
+	if err == store.ErrNotFound {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		log.Println(err)
+		http.Error(w, "Failed to retrieve address", http.StatusInternalServerError)
+		return nil
 	}
 
-	return address, nil
+	if !utils.AuthorizeUser(w, r, address.UserID) {
+		return nil
+	}
+	return address
 }
 
 // UpdateAddress updates an address
@@ -138,12 +141,18 @@ func (as *AddressService) getAddressByID(addressID string) (*models.Address, err
 // @Param address body models.Address true "Address object"
 // @Success 200 {string} string "Address updated successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to update address"
 // @Router /addresses/{id} [put]
 func (as *AddressService) UpdateAddress(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	addressID := vars["id"]
 
+	current := as.authorizeAddress(w, r, addressID)
+	if current == nil {
+		return
+	}
+
 	var address models.Address
 	err := json.NewDecoder(r.Body).Decode(&address)
 	if err != nil {
@@ -153,7 +162,8 @@ func (as *AddressService) UpdateAddress(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Update the address in the database
-	err = as.updateAddress(addressID, &address)
+	address.AddressID = current.AddressID
+	err = as.Addresses.Update(&address)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to update address", http.StatusInternalServerError)
@@ -165,26 +175,24 @@ func (as *AddressService) UpdateAddress(w http.ResponseWriter, r *http.Request)
 	w.Write([]byte("Address updated successfully"))
 }
 
-func (as *AddressService) updateAddress(addressID string, address *models.Address) error {
-	// Update the address in the 'addresses' table
-	query := `UPDATE addresses SET address_line1 = ?, address_line2 = ?, city = ?, state = ?, zip_code = ? WHERE address_id = ?`
-	_, err := as.DB.Exec(query, address.AddressLine1, address.AddressLine2, address.City, address.State, address.ZipCode, addressID)
-	return err
-}
-
-// DeleteAddress deletes an address
 // DeleteAddress deletes an address
 // @Summary Delete an address
 // @Tags Addresses
 // @Param id path string true "Address ID"
 // @Success 200 {string} string "Address deleted successfully"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to delete address"
 // @Router /addresses/{id} [delete]
 func (as *AddressService) DeleteAddress(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	addressID := vars["id"]
 
-	err := as.deleteAddress(addressID)
+	address := as.authorizeAddress(w, r, addressID)
+	if address == nil {
+		return
+	}
+
+	err := as.Addresses.Delete(address.AddressID)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to delete address", http.StatusInternalServerError)
@@ -196,13 +204,6 @@ func (as *AddressService) DeleteAddress(w http.ResponseWriter, r *http.Request)
 	w.Write([]byte("Address deleted successfully"))
 }
 
-func (as *AddressService) deleteAddress(addressID string) error {
-	// Delete the address from the 'addresses' table
-	query := `DELETE FROM addresses WHERE address_id = ?`
-	_, err := as.DB.Exec(query, addressID)
-	return err
-}
-
 // GetAddressesByUserID fetches all addresses for a given user ID
 // @Summary Fetch all addresses for a given user ID
 // @Tags Addresses
@@ -211,6 +212,7 @@ func (as *AddressService) deleteAddress(addressID string) error {
 // @Param user_id path string true "User ID"
 // @Success 200 {array} models.Address "Addresses retrieved successfully"
 // @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to get addresses"
 // @Router /users/{user_id}/addresses [get]
 func (as *AddressService) GetAddressesByUserID(w http.ResponseWriter, r *http.Request) {
@@ -223,8 +225,12 @@ func (as *AddressService) GetAddressesByUserID(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if !utils.AuthorizeUser(w, r, userID) {
+		return
+	}
+
 	// Fetch the addresses from the database for the given user_id
-	addresses, err := as.getAddressesByUserID(userID)
+	addresses, err := as.Addresses.ListByUser(userID)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to get addresses", http.StatusInternalServerError)
@@ -235,25 +241,3 @@ func (as *AddressService) GetAddressesByUserID(w http.ResponseWriter, r *http.Re
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(addresses)
 }
-
-func (as *AddressService) getAddressesByUserID(userID int) ([]*models.Address, error) {
-	// Query the 'addresses' table to get all addresses associated with the given user_id
-	query := `SELECT address_id, address_line1, address_line2, city, state, zip_code FROM addresses WHERE user_id = ?`
-	rows, err := as.DB.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var addresses []*models.Address
-	for rows.Next() {
-		address := &models.Address{}
-		err := rows.Scan(&address.AddressID, &address.AddressLine1, &address.AddressLine2, &address.City, &address.State, &address.ZipCode)
-		if err != nil {
-			return nil, err
-		}
-		addresses = append(addresses, address)
-	}
-
-	return addresses, nil
-}
@@ -7,20 +7,22 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/gklps/mittai-backend/db"
 	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
 	"github.com/gorilla/mux"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 // CartService handles the cart related operations
 type CartService struct {
-	DB *db.Repository
+	Carts  store.CartStore
+	Offers store.OfferStore
 }
 
-func NewCartService(db *db.Repository) *CartService {
+func NewCartService(stores *store.Stores) *CartService {
 	return &CartService{
-		DB: db,
+		Carts:  stores.Carts,
+		Offers: stores.Offers,
 	}
 }
 
@@ -32,11 +34,11 @@ type AddToCartRequest struct {
 }
 
 func (cs *CartService) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/cart", cs.AddToCart).Methods(http.MethodPost)
-	r.HandleFunc("/cart/{userID}", cs.GetCartByUserID).Methods(http.MethodGet)
-	r.HandleFunc("/cart", cs.UpdateCartItem).Methods(http.MethodPut)
-	r.HandleFunc("/cart", cs.RemoveCartItem).Methods(http.MethodDelete)
-	r.HandleFunc("/cart/clear", cs.ClearCart).Methods(http.MethodDelete)
+	r.HandleFunc("/cart", utils.AuthenticateFunc(cs.AddToCart)).Methods(http.MethodPost)
+	r.HandleFunc("/cart/{userID}", utils.AuthenticateFunc(cs.GetCartByUserID)).Methods(http.MethodGet)
+	r.HandleFunc("/cart", utils.AuthenticateFunc(cs.UpdateCartItem)).Methods(http.MethodPut)
+	r.HandleFunc("/cart", utils.AuthenticateFunc(cs.RemoveCartItem)).Methods(http.MethodDelete)
+	r.HandleFunc("/cart/clear", utils.AuthenticateFunc(cs.ClearCart)).Methods(http.MethodDelete)
 }
 
 // AddToCart adds a product to the user's cart
@@ -47,6 +49,7 @@ func (cs *CartService) RegisterRoutes(r *mux.Router) {
 // @Param request body AddToCartRequest true "Add to cart request payload"
 // @Success 200 {object} ErrorResponse "Product added to cart successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request payload"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to add product to cart"
 // @Router /cart [post]
 func (cs *CartService) AddToCart(w http.ResponseWriter, r *http.Request) {
@@ -64,29 +67,19 @@ func (cs *CartService) AddToCart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//check if request.userid is valid if not return error
-	if request.UserID <= 0 {
+	if request.UserID < 0 {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	tx, err := cs.DB.Begin()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to add product to cart", http.StatusInternalServerError)
-		return
-	}
-
-	// Insert the cart item into the database
-	_, err = tx.Exec("INSERT INTO cart (user_id, product_weight_id, quantity, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
-		request.UserID, request.ProductWeightID, request.Quantity, time.Now(), time.Now())
-	if err != nil {
-		log.Println(err)
-		tx.Rollback()
-		http.Error(w, "Failed to add product to cart", http.StatusInternalServerError)
+	// Act on behalf of the authenticated user unless another user's cart is explicitly allowed
+	userID, ok := utils.ActingUserID(w, r, request.UserID)
+	if !ok {
 		return
 	}
+	request.UserID = userID
 
-	err = tx.Commit()
+	err = cs.Carts.AddItem(request.UserID, request.ProductWeightID, request.Quantity)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to add product to cart", http.StatusInternalServerError)
@@ -101,8 +94,14 @@ func (cs *CartService) AddToCart(w http.ResponseWriter, r *http.Request) {
 
 // GetCartResponse represents the response payload for retrieving the user's cart
 type GetCartResponse struct {
-	CartItems  []*models.CartItem `json:"cart_items"`
-	TotalPrice float64            `json:"total_price"`
+	CartItems []*models.CartItem `json:"cart_items"`
+	// Subtotal is the price of the items before discounts
+	Subtotal float64 `json:"subtotal"`
+	// Discounts are the offers the cart qualifies for, applied again at checkout
+	Discounts []*models.PurchaseDiscount `json:"discounts"`
+	Discount  float64                    `json:"discount"`
+	// TotalPrice is what the cart costs after Discount
+	TotalPrice float64 `json:"total_price"`
 }
 
 // GetCartItem represents a cart item
@@ -121,6 +120,7 @@ type GetCartItem struct {
 // @Param userID path string true "User ID"
 // @Success 200 {object} GetCartResponse "User's cart retrieved successfully"
 // @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to fetch cart"
 // @Router /cart/{userID} [get]
 func (cs *CartService) GetCartByUserID(w http.ResponseWriter, r *http.Request) {
@@ -134,88 +134,59 @@ func (cs *CartService) GetCartByUserID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := cs.DB.Query(`SELECT c.id, c.quantity,
-			p.id, p.name, p.description, p.category, p.ingredients, p.nutritional_info, p.image_urls,
-			w.id, w.weight, w.price, w.stock, w.created_at, w.updated_at, w.measurement
-		FROM cart AS c
-		INNER JOIN product_weights AS w ON c.product_weight_id = w.id
-		INNER JOIN products AS p ON w.product_id = p.id
-		WHERE c.user_id = ?`, userID)
+	if !utils.AuthorizeUser(w, r, userID) {
+		return
+	}
+
+	cartItems, err := cs.Carts.Items(userID)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var cartItems []*models.CartItem
+	// Calculate the total price
 	totalPrice := 0.0
+	for _, item := range cartItems {
+		totalPrice += float64(item.Quantity) * item.Product.Price
+	}
 
-	for rows.Next() {
-		var (
-			cartID           int
-			cartItemQuantity int
-			productID        int
-			productName      string
-			productDesc      string
-			productCat       string
-			productIng       string
-			productNutr      string
-			productImgURLs   string
-			weightID         int
-			weightVal        int
-			weightPrice      float64
-			weightStock      int
-			weightCreatedAt  time.Time
-			weightUpdatedAt  time.Time
-			measurement      string
-		)
-
-		err := rows.Scan(&cartID, &cartItemQuantity,
-			&productID, &productName, &productDesc, &productCat, &productIng, &productNutr, &productImgURLs,
-			&weightID, &weightVal, &weightPrice, &weightStock, &weightCreatedAt, &weightUpdatedAt, &measurement)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
-			return
-		}
-
-		// Create a new product weight
-		weight := &models.ProductWeight{
-			ID:                weightID,
-			ProductID:         productID,
-			Weight:            weightVal,
-			Price:             weightPrice,
-			StockAvailability: weightStock,
-			CreatedAt:         weightCreatedAt,
-			UpdatedAt:         weightUpdatedAt,
-			Measurement:       measurement,
-		}
-
-		// Create a new cart item
-		cartItem := &models.CartItem{
-			Product:   weight,
-			Quantity:  cartItemQuantity,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-
-		// Add the cart item to the list
-		cartItems = append(cartItems, cartItem)
-
-		// Calculate the total price
-		totalPrice += float64(cartItem.Quantity) * weight.Price
+	discounts, err := cs.Offers.Price(cartPurchaseItems(cartItems))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+		return
+	}
+	if discounts == nil {
+		discounts = []*models.PurchaseDiscount{}
 	}
 
 	response := GetCartResponse{
-		CartItems:  cartItems,
-		TotalPrice: totalPrice,
+		CartItems: cartItems,
+		Subtotal:  totalPrice,
+		Discounts: discounts,
+		Discount:  models.TotalDiscount(discounts, totalPrice),
 	}
+	response.TotalPrice = response.Subtotal - response.Discount
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// cartPurchaseItems prices the items of a cart the way an order of them would be
+func cartPurchaseItems(cartItems []*models.CartItem) []*models.PurchaseItem {
+	var items []*models.PurchaseItem
+	for _, cartItem := range cartItems {
+		items = append(items, &models.PurchaseItem{
+			ProductID:       cartItem.Product.ProductID,
+			ProductWeightID: cartItem.Product.ID,
+			ProductPrice:    cartItem.Product.Price,
+			Quantity:        cartItem.Quantity,
+		})
+	}
+	return items
+}
+
 // UpdateCartItemRequest represents the request payload for updating a cart item
 type UpdateCartItemRequest struct {
 	UserID          int `json:"user_id"`
@@ -231,6 +202,7 @@ type UpdateCartItemRequest struct {
 // @Param request body UpdateCartItemRequest true "Update cart item request payload"
 // @Success 200 {object} ErrorResponse "Cart item updated successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request payload"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to update cart item"
 // @Router /cart [put]
 func (cs *CartService) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
@@ -242,24 +214,13 @@ func (cs *CartService) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx, err := cs.DB.Begin()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to update cart item", http.StatusInternalServerError)
-		return
-	}
-
-	// Update the cart item quantity in the database
-	_, err = tx.Exec("UPDATE cart SET quantity = ? WHERE user_id = ? AND product_weight_id = ?",
-		request.Quantity, request.UserID, request.ProductWeightID)
-	if err != nil {
-		log.Println(err)
-		tx.Rollback()
-		http.Error(w, "Failed to update cart item", http.StatusInternalServerError)
+	userID, ok := utils.ActingUserID(w, r, request.UserID)
+	if !ok {
 		return
 	}
+	request.UserID = userID
 
-	err = tx.Commit()
+	err = cs.Carts.UpdateQuantity(request.UserID, request.ProductWeightID, request.Quantity)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to update cart item", http.StatusInternalServerError)
@@ -286,6 +247,7 @@ type RemoveCartItemRequest struct {
 // @Param request body RemoveCartItemRequest true "Remove cart item request payload"
 // @Success 200 {object} ErrorResponse "Cart item removed successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request payload"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to remove cart item"
 // @Router /cart [delete]
 func (cs *CartService) RemoveCartItem(w http.ResponseWriter, r *http.Request) {
@@ -297,24 +259,13 @@ func (cs *CartService) RemoveCartItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx, err := cs.DB.Begin()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to remove cart item", http.StatusInternalServerError)
-		return
-	}
-
-	// Delete the cart item from the database
-	_, err = tx.Exec("DELETE FROM cart WHERE user_id = ? AND product_weight_id = ?",
-		request.UserID, request.ProductWeightID)
-	if err != nil {
-		log.Println(err)
-		tx.Rollback()
-		http.Error(w, "Failed to remove cart item", http.StatusInternalServerError)
+	userID, ok := utils.ActingUserID(w, r, request.UserID)
+	if !ok {
 		return
 	}
+	request.UserID = userID
 
-	err = tx.Commit()
+	err = cs.Carts.RemoveItem(request.UserID, request.ProductWeightID)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to remove cart item", http.StatusInternalServerError)
@@ -340,6 +291,7 @@ type ClearCartRequest struct {
 // @Param request body ClearCartRequest true "Clear cart request payload"
 // @Success 200 {object} ErrorResponse "Cart cleared successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request payload"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to clear cart"
 // @Router /cart/clear [delete]
 func (cs *CartService) ClearCart(w http.ResponseWriter, r *http.Request) {
@@ -351,23 +303,13 @@ func (cs *CartService) ClearCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx, err := cs.DB.Begin()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to clear cart", http.StatusInternalServerError)
-		return
-	}
-
-	// Delete all cart items for the user from the database
-	_, err = tx.Exec("DELETE FROM cart WHERE user_id = ?", request.UserID)
-	if err != nil {
-		log.Println(err)
-		tx.Rollback()
-		http.Error(w, "Failed to clear cart", http.StatusInternalServerError)
+	userID, ok := utils.ActingUserID(w, r, request.UserID)
+	if !ok {
 		return
 	}
+	request.UserID = userID
 
-	err = tx.Commit()
+	err = cs.Carts.Clear(request.UserID)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to clear cart", http.StatusInternalServerError)
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gklps/mittai-backend/utils"
+)
+
+func TestCart(t *testing.T) {
+	s := newTestServer(t)
+	ashaID, asha := s.user("asha@example.com", utils.RoleCustomer)
+	_, ravi := s.user("ravi@example.com", utils.RoleCustomer)
+	product := s.product(10, 100, 190)
+	small, large := product.Weights[0].ID, product.Weights[1].ID
+
+	// The user is taken from the token when the request leaves it out
+	expectStatus(t, s.do(http.MethodPost, "/cart", asha, AddToCartRequest{ProductWeightID: small, Quantity: 2}), http.StatusOK)
+	// The quantity defaults to one
+	expectStatus(t, s.do(http.MethodPost, "/cart", asha, AddToCartRequest{UserID: ashaID, ProductWeightID: large}), http.StatusOK)
+
+	path := fmt.Sprintf("/cart/%d", ashaID)
+	w := s.do(http.MethodGet, path, asha, nil)
+	expectStatus(t, w, http.StatusOK)
+	var cart GetCartResponse
+	decode(t, w, &cart)
+	if len(cart.CartItems) != 2 || cart.Subtotal != 2*100+190 || cart.TotalPrice != cart.Subtotal {
+		t.Fatalf("cart = %+v", cart)
+	}
+
+	expectStatus(t, s.do(http.MethodPut, "/cart", asha, UpdateCartItemRequest{UserID: ashaID, ProductWeightID: small, Quantity: 1}), http.StatusOK)
+	expectStatus(t, s.do(http.MethodDelete, "/cart", asha, RemoveCartItemRequest{UserID: ashaID, ProductWeightID: large}), http.StatusOK)
+	w = s.do(http.MethodGet, path, asha, nil)
+	expectStatus(t, w, http.StatusOK)
+	cart = GetCartResponse{}
+	decode(t, w, &cart)
+	if len(cart.CartItems) != 1 || cart.Subtotal != 100 {
+		t.Fatalf("cart after changes = %+v", cart)
+	}
+
+	// Nobody else sees or changes the cart
+	expectStatus(t, s.do(http.MethodGet, path, "", nil), http.StatusUnauthorized)
+	expectStatus(t, s.do(http.MethodGet, path, ravi, nil), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodPost, "/cart", ravi, AddToCartRequest{UserID: ashaID, ProductWeightID: large}), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodDelete, "/cart/clear", ravi, ClearCartRequest{UserID: ashaID}), http.StatusForbidden)
+
+	expectStatus(t, s.do(http.MethodDelete, "/cart/clear", asha, ClearCartRequest{UserID: ashaID}), http.StatusOK)
+	items, err := s.stores.Carts.Items(ashaID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("cart has %d items after clearing it", len(items))
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+)
+
+// IdempotencyKeyHeader is the request header that makes a mutating request safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the keys clients may send
+const maxIdempotencyKeyLength = 255
+
+// Idempotency makes mutating requests sent with an Idempotency-Key header safe to
+// retry. The first response to a key is stored and replayed for retries of the
+// same request until it expires. Keys are scoped to the authenticated user, so
+// requests without a valid access token are passed through untouched.
+type Idempotency struct {
+	Keys store.IdempotencyStore
+	TTL  time.Duration
+}
+
+// NewIdempotency creates a new instance of Idempotency
+func NewIdempotency(stores *store.Stores, ttl time.Duration) *Idempotency {
+	return &Idempotency{
+		Keys: stores.Idempotency,
+		TTL:  ttl,
+	}
+}
+
+// Middleware applies idempotency to every authenticated POST, PUT, PATCH and DELETE
+// request carrying the header
+func (i *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Handlers authenticate for themselves, so the caller is identified from the token here.
+		// Anonymous callers cannot be told apart and would share each other's keys.
+		principal, ok := utils.PrincipalFromToken(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		// The body is read here to fingerprint the request and handed on unchanged
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		record := &models.IdempotencyRecord{
+			UserID:      principal.UserID,
+			Key:         key,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			RequestHash: hashRequest(r.Method, r.URL.RequestURI(), body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(i.TTL),
+		}
+
+		existing, err := i.Keys.Reserve(record)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Failed to process request", http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			replay(w, existing, record.RequestHash)
+			return
+		}
+
+		// A handler that panics leaves no response to keep, so the key is freed for a retry
+		defer func() {
+			if p := recover(); p != nil {
+				if err := i.Keys.Release(record.ID); err != nil {
+					log.Println(err)
+				}
+				panic(p)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// Server errors are not kept so that the request can be retried with the same key
+		if recorder.statusCode >= http.StatusInternalServerError {
+			if err := i.Keys.Release(record.ID); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+
+		record.StatusCode = recorder.statusCode
+		record.ContentType = recorder.Header().Get("Content-Type")
+		record.ResponseBody = recorder.body.String()
+		if err := i.Keys.Complete(record); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// PurgeExpired deletes expired records every interval. It does not return.
+func (i *Idempotency) PurgeExpired(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := i.Keys.DeleteExpired(time.Now()); err != nil {
+			log.Println("Failed to purge expired idempotency keys:", err)
+		}
+	}
+}
+
+// replay answers a retried request with the stored response
+func replay(w http.ResponseWriter, record *models.IdempotencyRecord, requestHash string) {
+	if record.RequestHash != requestHash {
+		http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if record.StatusCode == 0 {
+		http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+		return
+	}
+
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write([]byte(record.ResponseBody))
+}
+
+// isMutating reports whether requests with the method change state
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// hashRequest fingerprints a request by its method, URI and body
+func hashRequest(method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + uri + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping a copy of its status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if !rr.wroteHeader {
+		rr.statusCode = statusCode
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gklps/mittai-backend/store/memstore"
+	"github.com/gklps/mittai-backend/utils"
+)
+
+// countingHandler counts its calls and responds with the count, or panics while panics is above zero
+type countingHandler struct {
+	calls  int
+	panics int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	if h.panics > 0 {
+		h.panics--
+		panic("handler failed")
+	}
+	w.Write([]byte(strings.Repeat("x", h.calls)))
+}
+
+// serveIdempotent sends a POST with the idempotency key through middleware, returning
+// nil when the handler panicked
+func serveIdempotent(middleware http.Handler, token, key string) (w *httptest.ResponseRecorder) {
+	defer func() {
+		if recover() != nil {
+			w = nil
+		}
+	}()
+
+	r := httptest.NewRequest(http.MethodPost, "/checkout", strings.NewReader(`{}`))
+	r.Header.Set(IdempotencyKeyHeader, key)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w = httptest.NewRecorder()
+	middleware.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotencyReplays(t *testing.T) {
+	handler := &countingHandler{}
+	middleware := NewIdempotency(memstore.New(), time.Hour).Middleware(handler)
+	token, _, err := utils.GenerateAccessToken(1, utils.RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := utils.GenerateAccessToken(2, utils.RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := serveIdempotent(middleware, token, "key-1")
+	retry := serveIdempotent(middleware, token, "key-1")
+	if handler.calls != 1 || retry.Body.String() != first.Body.String() {
+		t.Errorf("handler ran %d times, retry got %q after %q", handler.calls, retry.Body.String(), first.Body.String())
+	}
+
+	// Keys belong to the user who sent them
+	serveIdempotent(middleware, other, "key-1")
+	if handler.calls != 2 {
+		t.Errorf("handler ran %d times, want the other user's request to run", handler.calls)
+	}
+}
+
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	handler := &countingHandler{panics: 1}
+	middleware := NewIdempotency(memstore.New(), time.Hour).Middleware(handler)
+	token, _, err := utils.GenerateAccessToken(1, utils.RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serveIdempotent(middleware, token, "key-1"); w != nil {
+		t.Fatal("the panic did not reach the server")
+	}
+
+	// The retry runs instead of waiting on a key that is never completed
+	w := serveIdempotent(middleware, token, "key-1")
+	if w == nil || w.Code != http.StatusOK || handler.calls != 2 {
+		t.Errorf("retry after a panic: handler ran %d times, response %+v", handler.calls, w)
+	}
+}
+
+func TestIdempotencySkipsAnonymousRequests(t *testing.T) {
+	handler := &countingHandler{}
+	middleware := NewIdempotency(memstore.New(), time.Hour).Middleware(handler)
+
+	// Anonymous callers cannot see each other's responses
+	first := serveIdempotent(middleware, "", "key-1")
+	second := serveIdempotent(middleware, "", "key-1")
+	if handler.calls != 2 || first.Body.String() == second.Body.String() {
+		t.Errorf("handler ran %d times for two anonymous requests", handler.calls)
+	}
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// InventoryService handles the stock settings, stock ledger and reordering of weight variants
+type InventoryService struct {
+	Inventory store.InventoryStore
+	Suppliers store.SupplierStore
+}
+
+// NewInventoryService creates a new instance of InventoryService
+func NewInventoryService(stores *store.Stores) *InventoryService {
+	return &InventoryService{
+		Inventory: stores.Inventory,
+		Suppliers: stores.Suppliers,
+	}
+}
+
+// RegisterRoutes registers the inventory routes
+func (is *InventoryService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/admin/inventory", utils.RequireRoleFunc(is.ListInventory, utils.RoleStaff)).Methods(http.MethodGet)
+	// Registered before /admin/inventory/{id} so that low-stock is not taken for an ID
+	r.HandleFunc("/admin/inventory/low-stock", utils.RequireRoleFunc(is.GetLowStock, utils.RoleStaff)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/inventory/{id}", utils.RequireRoleFunc(is.GetInventory, utils.RoleStaff)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/inventory/{id}", utils.RequireRoleFunc(is.UpdateInventory, utils.RoleStaff)).Methods(http.MethodPut)
+	r.HandleFunc("/admin/inventory/{id}/movements", utils.RequireRoleFunc(is.ListMovements, utils.RoleStaff)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/inventory/{id}/movements", utils.RequireRoleFunc(is.RecordMovement, utils.RoleStaff)).Methods(http.MethodPost)
+}
+
+// UpdateInventoryRequest represents the request body for changing the stock settings of a weight variant
+type UpdateInventoryRequest struct {
+	// ReorderThreshold is the stock below which the variant needs reordering; zero never reorders
+	ReorderThreshold int `json:"reorder_threshold"`
+	// SupplierID is the supplier the variant is reordered from; zero for none
+	SupplierID int `json:"supplier_id"`
+}
+
+// StockMovementRequest represents the request body for recording a stock movement
+type StockMovementRequest struct {
+	// MovementType is "receipt", "adjustment" or "return"; sales are recorded by checkout
+	MovementType string `json:"movement_type"`
+	// Quantity is positive for receipts and returns, and the signed change in stock for adjustments
+	Quantity int `json:"quantity"`
+	// PurchaseID optionally ties a return to its purchase, which must contain the weight variant
+	PurchaseID int    `json:"purchase_id"`
+	Note       string `json:"note"`
+}
+
+// ListInventory lists the inventory of every weight variant by product
+// @Summary List inventory
+// @Tags Inventory
+// @Produce json
+// @Success 200 {array} models.Inventory "Inventory"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch inventory"
+// @Router /admin/inventory [get]
+func (is *InventoryService) ListInventory(w http.ResponseWriter, r *http.Request) {
+	inventory, err := is.Inventory.List()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch inventory", http.StatusInternalServerError)
+		return
+	}
+	if inventory == nil {
+		inventory = []*models.Inventory{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inventory)
+}
+
+// GetLowStock reports the weight variants whose stock is below their reorder threshold,
+// grouped by the supplier to reorder them from. Variants without a supplier come first,
+// in a group with no supplier.
+// @Summary Get the low-stock report
+// @Tags Inventory
+// @Produce json
+// @Success 200 {array} models.LowStockGroup "Variants to reorder by supplier"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch low stock"
+// @Router /admin/inventory/low-stock [get]
+func (is *InventoryService) GetLowStock(w http.ResponseWriter, r *http.Request) {
+	inventory, err := is.Inventory.LowStock()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch low stock", http.StatusInternalServerError)
+		return
+	}
+
+	// The store orders the variants by supplier, so each supplier's variants are adjacent
+	groups := []*models.LowStockGroup{}
+	var group *models.LowStockGroup
+	for _, item := range inventory {
+		if group == nil || item.SupplierID != supplierIDOf(group) {
+			group = &models.LowStockGroup{}
+			if item.SupplierID != 0 {
+				group.Supplier, err = is.Suppliers.Get(item.SupplierID)
+				if err != nil {
+					log.Println(err)
+					http.Error(w, "Failed to fetch low stock", http.StatusInternalServerError)
+					return
+				}
+			}
+			groups = append(groups, group)
+		}
+		group.Items = append(group.Items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// supplierIDOf returns the ID of the supplier of a low-stock group, or zero for none
+func supplierIDOf(group *models.LowStockGroup) int {
+	if group.Supplier == nil {
+		return 0
+	}
+	return group.Supplier.SupplierID
+}
+
+// GetInventory retrieves the inventory of a weight variant
+// @Summary Get the inventory of a weight variant
+// @Tags Inventory
+// @Produce json
+// @Param id path int true "Product weight ID"
+// @Success 200 {object} models.Inventory "Inventory"
+// @Failure 400 {object} ErrorResponse "Invalid product weight ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Product weight not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch inventory"
+// @Router /admin/inventory/{id} [get]
+func (is *InventoryService) GetInventory(w http.ResponseWriter, r *http.Request) {
+	weightID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product weight ID", http.StatusBadRequest)
+		return
+	}
+
+	inventory, err := is.Inventory.Get(weightID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Product weight not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch inventory", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inventory)
+}
+
+// UpdateInventory sets the reorder threshold and supplier of a weight variant.
+// Stock is changed by recording movements.
+// @Summary Update the stock settings of a weight variant
+// @Tags Inventory
+// @Accept json
+// @Produce json
+// @Param id path int true "Product weight ID"
+// @Param request body UpdateInventoryRequest true "Stock settings"
+// @Success 200 {object} models.Inventory "Inventory updated"
+// @Failure 400 {object} ErrorResponse "Invalid stock settings"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Product weight not found"
+// @Failure 500 {object} ErrorResponse "Failed to update inventory"
+// @Router /admin/inventory/{id} [put]
+func (is *InventoryService) UpdateInventory(w http.ResponseWriter, r *http.Request) {
+	weightID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product weight ID", http.StatusBadRequest)
+		return
+	}
+
+	var request UpdateInventoryRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if request.ReorderThreshold < 0 {
+		http.Error(w, "Reorder threshold cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if request.SupplierID < 0 {
+		http.Error(w, "Supplier not found", http.StatusBadRequest)
+		return
+	}
+	if request.SupplierID != 0 {
+		_, err := is.Suppliers.Get(request.SupplierID)
+		if err == store.ErrNotFound {
+			http.Error(w, "Supplier not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = is.Inventory.UpdateSettings(&models.Inventory{
+		ProductWeightID:  weightID,
+		ReorderThreshold: request.ReorderThreshold,
+		SupplierID:       request.SupplierID,
+	})
+	if err == store.ErrNotFound {
+		http.Error(w, "Product weight not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
+		return
+	}
+
+	inventory, err := is.Inventory.Get(weightID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch inventory", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inventory)
+}
+
+// ListMovements lists the stock ledger of a weight variant, oldest first
+// @Summary List the stock movements of a weight variant
+// @Tags Inventory
+// @Produce json
+// @Param id path int true "Product weight ID"
+// @Success 200 {array} models.StockMovement "Stock movements"
+// @Failure 400 {object} ErrorResponse "Invalid product weight ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch stock movements"
+// @Router /admin/inventory/{id}/movements [get]
+func (is *InventoryService) ListMovements(w http.ResponseWriter, r *http.Request) {
+	weightID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product weight ID", http.StatusBadRequest)
+		return
+	}
+
+	movements, err := is.Inventory.Movements(weightID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch stock movements", http.StatusInternalServerError)
+		return
+	}
+	if movements == nil {
+		movements = []*models.StockMovement{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movements)
+}
+
+// RecordMovement records a receipt, adjustment or return and changes the stock of the
+// weight variant by it
+// @Summary Record a stock movement
+// @Tags Inventory
+// @Accept json
+// @Produce json
+// @Param id path int true "Product weight ID"
+// @Param request body StockMovementRequest true "Stock movement"
+// @Success 200 {object} models.StockMovement "Stock movement recorded"
+// @Failure 400 {object} ErrorResponse "Invalid stock movement"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Product weight not found"
+// @Failure 409 {object} ErrorResponse "Not enough stock"
+// @Failure 500 {object} ErrorResponse "Failed to record stock movement"
+// @Router /admin/inventory/{id}/movements [post]
+func (is *InventoryService) RecordMovement(w http.ResponseWriter, r *http.Request) {
+	weightID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product weight ID", http.StatusBadRequest)
+		return
+	}
+
+	var request StockMovementRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	switch request.MovementType {
+	case models.StockMovementReceipt, models.StockMovementReturn:
+		if request.Quantity <= 0 {
+			http.Error(w, "Quantity must be positive", http.StatusBadRequest)
+			return
+		}
+	case models.StockMovementAdjustment:
+		if request.Quantity == 0 {
+			http.Error(w, "Quantity cannot be zero", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Movement type must be receipt, adjustment or return", http.StatusBadRequest)
+		return
+	}
+	if request.PurchaseID < 0 {
+		http.Error(w, "Invalid purchase ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, _ := utils.PrincipalFromRequest(r)
+	movement := &models.StockMovement{
+		ProductWeightID: weightID,
+		MovementType:    request.MovementType,
+		Quantity:        request.Quantity,
+		PurchaseID:      request.PurchaseID,
+		Note:            strings.TrimSpace(request.Note),
+		ActorID:         principal.UserID,
+	}
+	err = is.Inventory.RecordMovement(movement)
+	if err == store.ErrNotFound {
+		http.Error(w, "Product weight not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrOutOfStock) {
+		http.Error(w, "Not enough stock for this adjustment", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, store.ErrInvalidItem) {
+		http.Error(w, "Purchase does not contain this product weight", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to record stock movement", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movement)
+}
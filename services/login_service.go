@@ -1,12 +1,15 @@
 package services
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,11 +21,15 @@ type LoginRequest struct {
 
 // LoginResponse represents the response for user login
 type LoginResponse struct {
-	UserID int `json:"user_id"`
-	// Add other necessary fields if needed.
+	UserID                int       `json:"user_id"`
+	AccessToken           string    `json:"access_token"`
+	TokenType             string    `json:"token_type"`
+	ExpiresAt             time.Time `json:"expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
 }
 
-// Login logs in a user and returns the user_id if the password is correct
+// Login checks a user's email and password and issues an access token with a refresh token
 // @Summary User login
 // @Tags Users
 // @Accept json
@@ -31,13 +38,8 @@ type LoginResponse struct {
 // @Success 200 {object} LoginResponse "Login successful"
 // @Failure 400 {object} ErrorResponse "Invalid request body"
 // @Failure 401 {object} ErrorResponse "Invalid email or password"
+// @Failure 500 {object} ErrorResponse "Failed to log in"
 // @Router /login [post]
-// Login logs in a user and returns the user_id if the password is correct
-// Login logs in a user and returns the user_id if the password is correct
-// Login logs in a user and returns the user_id if the password is correct
-// Login logs in a user and returns the user_id if the password is correct
-// Login logs in a user and returns the user_id if the password is correct
-// Login logs in a user and returns the user_id if the password is correct
 func (us *UserService) Login(w http.ResponseWriter, r *http.Request) {
 	var loginReq LoginRequest
 	err := json.NewDecoder(r.Body).Decode(&loginReq)
@@ -48,45 +50,96 @@ func (us *UserService) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve the user by email from the database
-	user, err := us.getUserByEmail(loginReq.Email)
+	user, err := us.Users.GetByEmail(loginReq.Email)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	// Log the stored password and input password for debugging
-	log.Println("Stored Password:", user.Password)
-	log.Println("Input Password:", loginReq.Password)
-
-	// Compare the provided plain text password with the stored password
-	if user.Password != loginReq.Password {
-		log.Println("Invalid password")
+	// Compare the provided password with the stored hash
+	if err := us.verifyPassword(user, loginReq.Password); err != nil {
+		log.Println(err)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	// If the password is correct, respond with the user_id
-	response := LoginResponse{
-		UserID: user.UserID,
+	// If the password is correct, respond with the user_id and a fresh token pair
+	response, err := us.issueTokens(user.UserID, "")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// getUserByEmail retrieves a user by email from the database
-func (us *UserService) getUserByEmail(email string) (*models.User, error) {
-	query := `SELECT user_id, first_name, last_name, email, contact_number, verified_account, hashed_password FROM users WHERE email = ?`
-	row := us.DB.QueryRow(query, email)
+// issueTokens builds the login response carrying a fresh access and refresh token for the user.
+// An empty familyID starts a new refresh token family, as on a fresh login.
+func (us *UserService) issueTokens(userID int, familyID string) (*LoginResponse, error) {
+	// The role is read on every issue so that grants and revocations apply on the next refresh
+	role, err := us.Users.Role(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, expiresAt, err := utils.GenerateAccessToken(userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if familyID == "" {
+		familyID, err = randomToken()
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	user := &models.User{}
-	err := row.Scan(&user.UserID, &user.FirstName, &user.LastName, &user.Email, &user.ContactNumber, &user.VerifiedAccount, &user.Password)
+	refreshToken, refreshExpiresAt, err := us.saveRefreshToken(userID, familyID)
 	if err != nil {
 		return nil, err
 	}
 
-	return user, nil
+	return &LoginResponse{
+		UserID:                userID,
+		AccessToken:           accessToken,
+		TokenType:             "Bearer",
+		ExpiresAt:             expiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// verifyPassword checks the provided password against the user's stored password.
+// Accounts created before passwords were hashed still hold the plain text password;
+// those are compared as is and re-hashed on the first successful login.
+func (us *UserService) verifyPassword(user *models.User, providedPassword string) error {
+	// Rows migrated from databases without a password column have no password to match
+	if user.Password == "" {
+		return errors.New("account has no password")
+	}
+
+	if isPasswordHash(user.Password) {
+		return us.comparePasswords(user.Password, providedPassword)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(user.Password), []byte(providedPassword)) != 1 {
+		return errors.New("invalid password")
+	}
+
+	// Upgrade the legacy row; a failure here must not block the login
+	if err := us.updatePassword(user.UserID, providedPassword); err != nil {
+		log.Println("Failed to upgrade legacy password hash:", err)
+	}
+	return nil
+}
+
+// isPasswordHash reports whether a stored password is a bcrypt hash rather than legacy plain text
+func isPasswordHash(password string) bool {
+	_, err := bcrypt.Cost([]byte(password))
+	return err == nil
 }
 
 // comparePasswords compares the provided password with the hashed password
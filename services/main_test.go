@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/notifications"
+	"github.com/gklps/mittai-backend/payments"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/store/memstore"
+	"github.com/gklps/mittai-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// testWebhookSecret signs the webhooks of the fake payment provider
+const testWebhookSecret = "whsecret-0123456789"
+
+func TestMain(m *testing.M) {
+	utils.ConfigureJWT([]byte("test-secret-0123456789"), "test", time.Hour)
+	os.Exit(m.Run())
+}
+
+// outbox records the messages sent by the services instead of delivering them
+type outbox struct {
+	mu     sync.Mutex
+	emails []notifications.Email
+	texts  []notifications.SMS
+}
+
+func (o *outbox) Send(email notifications.Email) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.emails = append(o.emails, email)
+	return nil
+}
+
+// smsOutbox records text messages in the outbox it points to
+type smsOutbox struct{ *outbox }
+
+func (o smsOutbox) Send(sms notifications.SMS) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.texts = append(o.texts, sms)
+	return nil
+}
+
+var otpPattern = regexp.MustCompile(`\b\d{6}\b`)
+
+// lastOTP returns the code in the last email sent to address
+func (o *outbox) lastOTP(t *testing.T, address string) string {
+	t.Helper()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.emails) - 1; i >= 0; i-- {
+		if o.emails[i].To == address {
+			if otp := otpPattern.FindString(o.emails[i].Text); otp != "" {
+				return otp
+			}
+		}
+	}
+	t.Fatalf("no OTP was emailed to %s", address)
+	return ""
+}
+
+// testServer serves every route on in-memory stores, wired as main does
+type testServer struct {
+	t         *testing.T
+	stores    *store.Stores
+	providers map[string]payments.Provider
+	router    *mux.Router
+	outbox    *outbox
+}
+
+func newTestServer(t *testing.T) *testServer {
+	stores := memstore.New()
+	sent := &outbox{}
+
+	providers, err := payments.NewProviders(payments.Config{
+		Providers:         []string{payments.ProviderCOD, payments.ProviderFake},
+		FakeWebhookSecret: testWebhookSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(NewIdempotency(stores, time.Hour).Middleware)
+	NewProductService(stores).RegisterRoutes(router)
+	NewUserService(stores, sent, smsOutbox{sent}).RegisterRoutes(router)
+	NewProductWeightService(stores).RegisterRoutes(router)
+	NewCartService(stores).RegisterRoutes(router)
+	NewPurchaseService(stores, sent).RegisterRoutes(router)
+	NewPaymentService(stores, providers).RegisterRoutes(router)
+	NewRefundService(stores, providers).RegisterRoutes(router)
+	NewInventoryService(stores).RegisterRoutes(router)
+	NewAddressService(stores).RegisterRoutes(router)
+
+	return &testServer{t: t, stores: stores, providers: providers, router: router, outbox: sent}
+}
+
+// do serves a request with body encoded as JSON, authenticated with token when it is not empty
+func (s *testServer) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	return s.doWithHeaders(method, path, token, body, nil)
+}
+
+func (s *testServer) doWithHeaders(method, path, token string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, path, &payload)
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+// token returns an access token for the user with role
+func (s *testServer) token(userID int, role string) string {
+	s.t.Helper()
+	token, _, err := utils.GenerateAccessToken(userID, role)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return token
+}
+
+// user stores a verified user with role and returns their ID and an access token
+func (s *testServer) user(email, role string) (int, string) {
+	s.t.Helper()
+	user := &models.User{
+		FirstName:       "Test",
+		Email:           email,
+		ContactNumber:   email,
+		VerifiedAccount: true,
+	}
+	if err := s.stores.Users.Create(user); err != nil {
+		s.t.Fatal(err)
+	}
+	if role != utils.RoleCustomer {
+		if err := s.stores.Users.SetRole(user.UserID, role); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	return user.UserID, s.token(user.UserID, role)
+}
+
+// product stores a product with one weight variant per price, each with stock in hand
+func (s *testServer) product(stock int, prices ...float64) *models.Product {
+	s.t.Helper()
+	now := time.Now()
+	product := &models.Product{Name: "Laddu", CreatedAt: now, UpdatedAt: now}
+	for i, price := range prices {
+		product.Weights = append(product.Weights, &models.ProductWeight{
+			Weight:            250 * (i + 1),
+			Price:             price,
+			StockAvailability: stock,
+			Measurement:       "g",
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		})
+	}
+	if err := s.stores.Products.Create(product); err != nil {
+		s.t.Fatal(err)
+	}
+	return product
+}
+
+// checkoutSetup stores an address of userID and an active cash on delivery mode
+func (s *testServer) checkoutSetup(userID int) (addressID, paymentID int) {
+	s.t.Helper()
+	address := &models.Address{UserID: userID, AddressLine1: "1 Main Road", City: "Chennai", ZipCode: "600001"}
+	if err := s.stores.Addresses.Create(address); err != nil {
+		s.t.Fatal(err)
+	}
+	mode := &models.PaymentMode{Mode: "COD", Provider: payments.ProviderCOD, IsActive: true}
+	if err := s.stores.Payments.CreateMode(mode); err != nil {
+		s.t.Fatal(err)
+	}
+	return address.AddressID, mode.ID
+}
+
+// decode decodes the JSON body of a response into v
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+// expectStatus fails the test when the response does not have status code
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, code int) {
+	t.Helper()
+	if w.Code != code {
+		t.Fatalf("status = %d (%s), want %d", w.Code, w.Body.String(), code)
+	}
+}
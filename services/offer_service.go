@@ -0,0 +1,306 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// OfferService handles the management of the offers applied automatically to carts
+type OfferService struct {
+	Offers store.OfferStore
+}
+
+// NewOfferService creates a new instance of OfferService
+func NewOfferService(stores *store.Stores) *OfferService {
+	return &OfferService{
+		Offers: stores.Offers,
+	}
+}
+
+// RegisterRoutes registers the offer routes
+func (ofs *OfferService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/admin/offers", utils.RequireRoleFunc(ofs.ListOffers, utils.RoleAdmin)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/offers", utils.RequireRoleFunc(ofs.CreateOffer, utils.RoleAdmin)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/offers/{id}", utils.RequireRoleFunc(ofs.GetOffer, utils.RoleAdmin)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/offers/{id}", utils.RequireRoleFunc(ofs.UpdateOffer, utils.RoleAdmin)).Methods(http.MethodPut)
+	r.HandleFunc("/admin/offers/{id}", utils.RequireRoleFunc(ofs.DeleteOffer, utils.RoleAdmin)).Methods(http.MethodDelete)
+}
+
+// OfferRequest represents the request body for creating or changing an offer
+type OfferRequest struct {
+	Name string `json:"name"`
+	// OfferType is "buy_x_get_y" or "tiered"
+	OfferType string `json:"offer_type"`
+	// A buy X get Y offer gives get_quantity of get_product_weight_id free for every
+	// buy_quantity of buy_product_weight_id in the cart
+	BuyProductWeightID int `json:"buy_product_weight_id"`
+	BuyQuantity        int `json:"buy_quantity"`
+	GetProductWeightID int `json:"get_product_weight_id"`
+	GetQuantity        int `json:"get_quantity"`
+	// Tiers of a tiered offer each take a percentage or an amount off orders reaching min_order_value
+	Tiers []*models.OfferTier `json:"tiers"`
+	// Priority orders the offers, lowest first
+	Priority int `json:"priority"`
+	// Stackable offers combine; one that is not is only ever applied alone
+	Stackable bool `json:"stackable"`
+	// StartDate and EndDate are RFC 3339 times; leave them out for no bound
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	IsActive  bool      `json:"is_active"`
+}
+
+// offer validates the request and returns the offer it describes
+func (ofs *OfferService) offer(request *OfferRequest) (*models.Offer, string) {
+	offer := &models.Offer{
+		Name:      strings.TrimSpace(request.Name),
+		OfferType: request.OfferType,
+		Priority:  request.Priority,
+		Stackable: request.Stackable,
+		StartDate: request.StartDate,
+		EndDate:   request.EndDate,
+		IsActive:  request.IsActive,
+		Tiers:     []*models.OfferTier{},
+	}
+	if offer.Name == "" {
+		return nil, "Offer name is required"
+	}
+
+	switch offer.OfferType {
+	case models.OfferTypeBuyXGetY:
+		if request.BuyProductWeightID <= 0 || request.GetProductWeightID <= 0 {
+			return nil, "Buy and get product weights are required"
+		}
+		if request.BuyQuantity <= 0 || request.GetQuantity <= 0 {
+			return nil, "Buy and get quantities must be positive"
+		}
+		offer.BuyProductWeightID = request.BuyProductWeightID
+		offer.BuyQuantity = request.BuyQuantity
+		offer.GetProductWeightID = request.GetProductWeightID
+		offer.GetQuantity = request.GetQuantity
+	case models.OfferTypeTiered:
+		if len(request.Tiers) == 0 {
+			return nil, "At least one tier is required"
+		}
+		for _, tier := range request.Tiers {
+			if tier == nil || tier.MinOrderValue < 0 {
+				return nil, "Tier minimum order value cannot be negative"
+			}
+			percentage, amount := tier.DiscountPercentage > 0, tier.DiscountAmount > 0
+			if percentage == amount || tier.DiscountPercentage < 0 || tier.DiscountAmount < 0 {
+				return nil, "Each tier needs either a discount percentage or a discount amount"
+			}
+			if tier.DiscountPercentage > 100 {
+				return nil, "Discount percentage must be between 0 and 100"
+			}
+			offer.Tiers = append(offer.Tiers, tier)
+		}
+	default:
+		return nil, "Offer type must be buy_x_get_y or tiered"
+	}
+
+	if !offer.StartDate.IsZero() && !offer.EndDate.IsZero() && offer.EndDate.Before(offer.StartDate) {
+		return nil, "End date is before the start date"
+	}
+	return offer, ""
+}
+
+// ListOffers lists every offer by priority
+// @Summary List offers
+// @Tags Offers
+// @Produce json
+// @Success 200 {array} models.Offer "Offers"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch offers"
+// @Router /admin/offers [get]
+func (ofs *OfferService) ListOffers(w http.ResponseWriter, r *http.Request) {
+	offers, err := ofs.Offers.List()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch offers", http.StatusInternalServerError)
+		return
+	}
+	if offers == nil {
+		offers = []*models.Offer{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offers)
+}
+
+// GetOffer retrieves an offer
+// @Summary Get an offer
+// @Tags Offers
+// @Produce json
+// @Param id path int true "Offer ID"
+// @Success 200 {object} models.Offer "Offer"
+// @Failure 400 {object} ErrorResponse "Invalid offer ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Offer not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch offer"
+// @Router /admin/offers/{id} [get]
+func (ofs *OfferService) GetOffer(w http.ResponseWriter, r *http.Request) {
+	offerID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid offer ID", http.StatusBadRequest)
+		return
+	}
+
+	offer, err := ofs.Offers.Get(offerID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch offer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offer)
+}
+
+// CreateOffer adds an offer
+// @Summary Create an offer
+// @Tags Offers
+// @Accept json
+// @Produce json
+// @Param request body OfferRequest true "Offer"
+// @Success 200 {object} models.Offer "Offer created"
+// @Failure 400 {object} ErrorResponse "Invalid offer"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to save offer"
+// @Router /admin/offers [post]
+func (ofs *OfferService) CreateOffer(w http.ResponseWriter, r *http.Request) {
+	var request OfferRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	offer, problem := ofs.offer(&request)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	offer.CreatedAt = time.Now()
+	offer.UpdatedAt = offer.CreatedAt
+	err = ofs.Offers.Create(offer)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save offer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offer)
+}
+
+// UpdateOffer replaces an offer. Purchases already discounted keep their discount lines.
+// @Summary Update an offer
+// @Tags Offers
+// @Accept json
+// @Produce json
+// @Param id path int true "Offer ID"
+// @Param request body OfferRequest true "Offer"
+// @Success 200 {object} models.Offer "Offer updated"
+// @Failure 400 {object} ErrorResponse "Invalid offer"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Offer not found"
+// @Failure 500 {object} ErrorResponse "Failed to save offer"
+// @Router /admin/offers/{id} [put]
+func (ofs *OfferService) UpdateOffer(w http.ResponseWriter, r *http.Request) {
+	offerID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid offer ID", http.StatusBadRequest)
+		return
+	}
+
+	var request OfferRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	offer, problem := ofs.offer(&request)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	existing, err := ofs.Offers.Get(offerID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save offer", http.StatusInternalServerError)
+		return
+	}
+	offer.OfferID = existing.OfferID
+	offer.CreatedAt = existing.CreatedAt
+	offer.UpdatedAt = time.Now()
+
+	err = ofs.Offers.Update(offer)
+	if err == store.ErrNotFound {
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save offer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offer)
+}
+
+// DeleteOffer removes an offer no purchase was discounted with.
+// Offers in use can be deactivated instead.
+// @Summary Delete an offer
+// @Tags Offers
+// @Param id path int true "Offer ID"
+// @Success 200 {string} string "Offer deleted successfully"
+// @Failure 400 {object} ErrorResponse "Invalid offer ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Offer not found"
+// @Failure 409 {object} ErrorResponse "Offer is in use"
+// @Failure 500 {object} ErrorResponse "Failed to delete offer"
+// @Router /admin/offers/{id} [delete]
+func (ofs *OfferService) DeleteOffer(w http.ResponseWriter, r *http.Request) {
+	offerID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid offer ID", http.StatusBadRequest)
+		return
+	}
+
+	err = ofs.Offers.Delete(offerID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return
+	}
+	if err == store.ErrOfferInUse {
+		http.Error(w, "Offer is in use; deactivate it instead", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to delete offer", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Offer deleted successfully"))
+}
@@ -1,85 +1,195 @@
 package services
 
 import (
-	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"math/big"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/notifications"
+	"github.com/gklps/mittai-backend/store"
 	"github.com/gorilla/mux"
 )
 
-func (us *UserService) saveOTP(userID int, otp string) error {
-	query := `INSERT INTO otp (user_id, otp_value) VALUES (?, ?)`
-	_, err := us.DB.Exec(query, userID, otp)
-	return err
+// OTP purposes keep codes issued for one flow from being accepted by another
+const (
+	otpPurposeVerify        = "verify"
+	otpPurposePasswordReset = "password_reset"
+	otpPurposeLogin         = "login"
+)
+
+// maxOTPAttempts is the number of wrong guesses after which a code is invalidated
+const maxOTPAttempts = 5
+
+var errOTPLocked = errors.New("too many failed OTP attempts")
+
+// OTPPolicy controls how account verification codes are issued and checked
+type OTPPolicy struct {
+	// TTL is how long a verification code stays valid
+	TTL time.Duration
+	// MaxFailures is the number of failed checks, across codes, before the user is locked out
+	MaxFailures int
+	// Lockout is how long OTP checks are refused after MaxFailures
+	Lockout time.Duration
+	// ResendInterval is the minimum time between two codes sent to the same user
+	ResendInterval time.Duration
+	// MaxSendsPerHour caps how many codes a user can be sent in an hour
+	MaxSendsPerHour int
 }
 
-func generateOTP() string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("%06d", rand.Intn(1000000))
+// DefaultOTPPolicy is the OTP policy used unless configured otherwise
+var DefaultOTPPolicy = OTPPolicy{
+	TTL:             10 * time.Minute,
+	MaxFailures:     10,
+	Lockout:         15 * time.Minute,
+	ResendInterval:  time.Minute,
+	MaxSendsPerHour: 5,
 }
 
-func (us *UserService) sendOTPEmail(email, otp string, userid int) error {
-	client := &http.Client{}
+// issueOTP generates a single-use code for the given purpose, invalidating any
+// code previously issued to the user for the same purpose
+func (us *UserService) issueOTP(userID int, purpose string, ttl time.Duration) (string, error) {
+	value, err := generateOTP()
+	if err != nil {
+		return "", err
+	}
 
-	// Construct the verification link with user ID and OTP
-	verifyLink := fmt.Sprintf("http://swagger.mittaitheruvu.com/verify-otp/%d", userid)
-	// Construct the HTML email content
-	htmlContent := fmt.Sprintf(
-		"<!DOCTYPE html><html><head><title>OTP Email</title></head><body>"+
-			"<h1>Your OTP is: %s</h1>"+
-			"<p>Click <a href=\"%s\">here</a> to confirm your account.</p>"+
-			"</body></html>", otp, verifyLink)
-
-	payload := map[string]interface{}{
-		"sender": map[string]string{
-			"name":  "Mittaitheruvu",
-			"email": "otp-services@mittaitheruvu.com",
-		},
-		"params": map[string]string{
-			"OTP": otp,
-		},
-		"to": []map[string]string{
-			{
-				"email": email,
-			},
-		},
-		"subject":     "OTP Email",
-		"htmlContent": htmlContent,
-	}
-
-	payloadJSON, err := json.Marshal(payload)
+	now := time.Now()
+	err = us.OTPs.Issue(&models.OTP{
+		UserID:      userID,
+		Value:       value,
+		Purpose:     purpose,
+		GeneratedAt: now,
+		ExpiresAt:   now.Add(ttl),
+	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.brevo.com/v3/smtp/email", bytes.NewBuffer(payloadJSON))
+	return value, nil
+}
+
+// consumeOTP checks a code against the latest one issued to the user for the purpose
+// and marks it used on success. Every guess is counted before the comparison and the
+// code is refused once it has had maxOTPAttempts guesses.
+func (us *UserService) consumeOTP(userID int, purpose, otp string) (bool, error) {
+	stored, err := us.OTPs.Latest(userID, purpose)
+	if err == store.ErrNotFound {
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	if stored.ExpiresAt.IsZero() || time.Now().After(stored.ExpiresAt) {
+		return false, nil
 	}
 
-	req.Header.Add("api-key", "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")
-	req.Header.Add("Content-Type", "application/json")
+	counted, err := us.OTPs.CountAttempt(stored.ID, maxOTPAttempts)
+	if err != nil || !counted {
+		return false, err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.Value), []byte(otp)) != 1 {
+		return false, nil
+	}
 
-	resp, err := client.Do(req)
+	// Guard against the same code being redeemed twice concurrently
+	return us.OTPs.Consume(stored.ID)
+}
+
+// verifyOTP checks a code for the user on top of consumeOTP's per-code limit, counting
+// failures per user and refusing checks with errOTPLocked while the user is locked out.
+// Each check counts as a failure until it succeeds, so concurrent wrong guesses cannot
+// get past MaxFailures.
+func (us *UserService) verifyOTP(userID int, purpose, otp string) (bool, error) {
+	now := time.Now()
+	failures, err := us.OTPs.CountCheck(userID, us.OTP.MaxFailures, now, now.Add(us.OTP.Lockout))
+	if err == store.ErrNotFound {
+		return false, nil
+	}
+	if err == store.ErrLockedOut {
+		return false, errOTPLocked
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer resp.Body.Close()
 
-	var emailResponse map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&emailResponse)
+	valid, err := us.consumeOTP(userID, purpose, otp)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	log.Printf("Email response: %v", emailResponse)
+	if valid {
+		err = us.OTPs.ClearFailures(userID)
+		return err == nil, err
+	}
+
+	if failures >= us.OTP.MaxFailures {
+		log.Printf("Locking OTP checks for user %d after %d failed attempts", userID, failures)
+	}
+	return false, nil
+}
+
+// canSendOTP reports whether another code may be sent to the user for the purpose
+// without exceeding the resend interval or the hourly limit
+func (us *UserService) canSendOTP(userID int, purpose string) (bool, error) {
+	sentAt, err := us.OTPs.SendTimes(userID, purpose, us.OTP.MaxSendsPerHour)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	if len(sentAt) > 0 && now.Sub(sentAt[0]) < us.OTP.ResendInterval {
+		return false, nil
+	}
+	if len(sentAt) >= us.OTP.MaxSendsPerHour && now.Sub(sentAt[len(sentAt)-1]) < time.Hour {
+		return false, nil
+	}
 
-	return nil
+	return true, nil
+}
+
+// generateOTP returns a random six digit code
+func generateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func (us *UserService) sendOTPEmail(email, otp string, userid int) error {
+	// Construct the verification link with user ID and OTP
+	verifyLink := fmt.Sprintf("%s/verify-otp/%d", strings.TrimRight(us.BaseURL, "/"), userid)
+
+	message, err := notifications.OTPEmail(email, notifications.OTPEmailData{
+		OTP:        otp,
+		VerifyLink: verifyLink,
+	})
+	if err != nil {
+		return err
+	}
+	return us.Email.Send(message)
+}
+
+// sendPasswordResetEmail emails a password reset code to the user
+func (us *UserService) sendPasswordResetEmail(email, otp string) error {
+	message, err := notifications.PasswordResetEmail(email, notifications.PasswordResetEmailData{
+		OTP:              otp,
+		ExpiresInMinutes: int(passwordResetOTPTTL.Minutes()),
+	})
+	if err != nil {
+		return err
+	}
+	return us.Email.Send(message)
 }
 
 // VerifyOTP verifies the provided OTP and updates verified_account
@@ -92,26 +202,42 @@ func (us *UserService) sendOTPEmail(email, otp string, userid int) error {
 // @Success 200 {string} string "OTP verified and account updated successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request body"
 // @Failure 401 {string} string "Invalid OTP"
+// @Failure 429 {string} string "Too many failed attempts"
 // @Failure 500 {object} ErrorResponse "Failed to update user"
 // @Router /verify-otp/{id} [post]
 func (us *UserService) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	userID := vars["id"]
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
 
 	var input struct {
 		OTP string `json:"otp"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&input)
+	err = json.NewDecoder(r.Body).Decode(&input)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if us.verifyOTP(userID, input.OTP) {
+	valid, err := us.verifyOTP(id, otpPurposeVerify, input.OTP)
+	if err == errOTPLocked {
+		http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	if valid {
 		// Update verified_account to true
-		err := us.updateVerifiedAccount(userID, true)
+		err := us.Users.SetVerified(id, true)
 		if err != nil {
 			log.Println(err)
 			http.Error(w, "Failed to update user", http.StatusInternalServerError)
@@ -125,21 +251,66 @@ func (us *UserService) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (us *UserService) verifyOTP(userID, otp string) bool {
-	query := `SELECT otp_value FROM otp WHERE user_id = ? AND otp_value = ? AND generated_at >= ?`
-	row := us.DB.QueryRow(query, userID, otp, time.Now().Add(-12*time.Hour))
+// ResendOTP sends a new verification code, invalidating the previous ones
+// @Summary Resend the account verification OTP
+// @Tags Users
+// @Param id path string true "User ID"
+// @Success 200 {string} string "OTP sent successfully"
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "Account already verified"
+// @Failure 429 {object} ErrorResponse "OTP requested too often"
+// @Failure 500 {object} ErrorResponse "Failed to send OTP"
+// @Router /resend-otp/{id} [post]
+func (us *UserService) ResendOTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
 
-	var storedOTP string
-	err := row.Scan(&storedOTP)
+	user, err := us.Users.Get(userID)
+	if err == store.ErrNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		return false
+		log.Println(err)
+		http.Error(w, "Failed to send OTP", http.StatusInternalServerError)
+		return
 	}
 
-	return storedOTP == otp
-}
+	if user.VerifiedAccount {
+		http.Error(w, "Account already verified", http.StatusConflict)
+		return
+	}
+
+	allowed, err := us.canSendOTP(user.UserID, otpPurposeVerify)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to send OTP", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "OTP requested too often, try again later", http.StatusTooManyRequests)
+		return
+	}
 
-func (us *UserService) updateVerifiedAccount(userID string, verified bool) error {
-	query := `UPDATE users SET verified_account = ? WHERE user_id = ?`
-	_, err := us.DB.Exec(query, verified, userID)
-	return err
+	otp, err := us.issueOTP(user.UserID, otpPurposeVerify, us.OTP.TTL)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to send OTP", http.StatusInternalServerError)
+		return
+	}
+
+	err = us.sendOTPEmail(user.Email, otp, user.UserID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to send OTP", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OTP sent successfully"))
 }
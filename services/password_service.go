@@ -0,0 +1,150 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+// passwordResetOTPTTL is how long an emailed password reset code stays valid
+var passwordResetOTPTTL = 15 * time.Minute
+
+// ForgotPasswordRequest represents the request body for requesting a password reset code
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest represents the request body for resetting a password with a code
+type ResetPasswordRequest struct {
+	Email       string `json:"email"`
+	OTP         string `json:"otp"`
+	NewPassword string `json:"new_password"`
+}
+
+// ForgotPassword emails a password reset code to the account with the given email.
+// The response is the same whether or not the account exists.
+// @Summary Request a password reset code
+// @Tags Users
+// @Accept json
+// @Param request body ForgotPasswordRequest true "Account email"
+// @Success 200 {string} string "If the account exists, a reset code has been sent"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 500 {object} ErrorResponse "Failed to start password reset"
+// @Router /password/forgot [post]
+func (us *UserService) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var request ForgotPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := us.Users.GetByEmail(request.Email)
+	if err != nil && err != store.ErrNotFound {
+		log.Println(err)
+		http.Error(w, "Failed to start password reset", http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil {
+		us.sendPasswordResetCode(user)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("If the account exists, a reset code has been sent"))
+}
+
+// sendPasswordResetCode issues and emails a reset code when the resend limits allow it.
+// Failures are only logged so the response does not reveal whether the account exists.
+func (us *UserService) sendPasswordResetCode(user *models.User) {
+	allowed, err := us.canSendOTP(user.UserID, otpPurposePasswordReset)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if !allowed {
+		log.Printf("Password reset code for user %d requested too often", user.UserID)
+		return
+	}
+
+	otp, err := us.issueOTP(user.UserID, otpPurposePasswordReset, passwordResetOTPTTL)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := us.sendPasswordResetEmail(user.Email, otp); err != nil {
+		log.Println(err)
+	}
+}
+
+// ResetPassword sets a new password using an emailed reset code. All refresh
+// tokens of the user are revoked so existing sessions have to log in again.
+// @Summary Reset password with a reset code
+// @Tags Users
+// @Accept json
+// @Param request body ResetPasswordRequest true "Reset code and new password"
+// @Success 200 {string} string "Password reset successfully"
+// @Failure 400 {object} ErrorResponse "Invalid or expired reset code"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts"
+// @Failure 500 {object} ErrorResponse "Failed to reset password"
+// @Router /password/reset [post]
+func (us *UserService) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var request ResetPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Email == "" || request.OTP == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.NewPassword == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := us.Users.GetByEmail(request.Email)
+	if err == store.ErrNotFound {
+		http.Error(w, "Invalid or expired reset code", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	valid, err := us.verifyOTP(user.UserID, otpPurposePasswordReset, request.OTP)
+	if err == errOTPLocked {
+		http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid or expired reset code", http.StatusBadRequest)
+		return
+	}
+
+	err = us.updatePassword(user.UserID, request.NewPassword)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	err = us.RefreshTokens.RevokeUser(user.UserID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Password reset successfully"))
+}
@@ -2,57 +2,546 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/gklps/mittai-backend/db"
 	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/payments"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
 	"github.com/gorilla/mux"
-	_ "github.com/mattn/go-sqlite3"
 )
 
-// PaymentService handles the payment mode related operations
+// maxWebhookSize bounds the webhook payloads read from payment gateways
+const maxWebhookSize = 1 << 20
+
+// PaymentService handles the payment mode and payment related operations
 type PaymentService struct {
-	DB *db.Repository
+	Payments  store.PaymentStore
+	Orders    store.OrderStore
+	Carts     store.CartStore
+	Addresses store.AddressStore
+	// Providers are the enabled payment providers by name
+	Providers map[string]payments.Provider
+	// Currency is the ISO code of the currency prices are in
+	Currency string
 }
 
 // NewPaymentService creates a new instance of PaymentService
-func NewPaymentService(db *db.Repository) *PaymentService {
+func NewPaymentService(stores *store.Stores, providers map[string]payments.Provider) *PaymentService {
 	return &PaymentService{
-		DB: db,
+		Payments:  stores.Payments,
+		Orders:    stores.Orders,
+		Carts:     stores.Carts,
+		Addresses: stores.Addresses,
+		Providers: providers,
+		Currency:  "INR",
 	}
 }
 
-// RegisterRoutes registers the payment mode routes
+// RegisterRoutes registers the payment routes
 func (ps *PaymentService) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/payment/modes", ps.GetPaymentModes).Methods(http.MethodGet)
+	r.HandleFunc("/payments", utils.AuthenticateFunc(ps.CreatePayment)).Methods(http.MethodPost)
+	r.HandleFunc("/payments/webhook/{provider}", ps.HandleWebhook).Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/payment/modes", utils.RequireRoleFunc(ps.ListAllPaymentModes, utils.RoleAdmin)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/payment/modes", utils.RequireRoleFunc(ps.CreatePaymentMode, utils.RoleAdmin)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/payment/modes/{id}", utils.RequireRoleFunc(ps.UpdatePaymentMode, utils.RoleAdmin)).Methods(http.MethodPut)
+	r.HandleFunc("/admin/payment/modes/{id}", utils.RequireRoleFunc(ps.DeletePaymentMode, utils.RoleAdmin)).Methods(http.MethodDelete)
 }
 
-// GetPaymentModes retrieves all payment modes
+// GetPaymentModes lists the active payment modes whose provider is enabled. When the caller
+// is signed in, modes whose order value limits exclude the total of their cart are
+// left out. Passing a pincode, or an address_id of the caller, also leaves out modes
+// that do not deliver there.
+// @Summary List the payment modes available for checkout
+// @Tags Payments
+// @Produce json
+// @Param pincode query string false "Delivery pincode"
+// @Param address_id query int false "Delivery address of the caller"
+// @Success 200 {array} models.PaymentMode "Available payment modes"
+// @Failure 400 {object} ErrorResponse "Invalid address ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Address not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch payment modes"
+// @Router /payment/modes [get]
 func (ps *PaymentService) GetPaymentModes(w http.ResponseWriter, r *http.Request) {
-	rows, err := ps.DB.Query("SELECT id, mode, is_active FROM payment_mode")
+	principal, signedIn := utils.PrincipalFromToken(r)
+
+	pincode := strings.TrimSpace(r.URL.Query().Get("pincode"))
+	if addressIDStr := r.URL.Query().Get("address_id"); addressIDStr != "" {
+		addressID, err := strconv.Atoi(addressIDStr)
+		if err != nil {
+			http.Error(w, "Invalid address ID", http.StatusBadRequest)
+			return
+		}
+		if !signedIn {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		address, err := ps.Addresses.Get(addressID)
+		if err == store.ErrNotFound {
+			http.Error(w, "Address not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Failed to fetch payment modes", http.StatusInternalServerError)
+			return
+		}
+		if address.UserID != principal.UserID {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		pincode = address.ZipCode
+	}
+
+	total := 0.0
+	if signedIn {
+		items, err := ps.Carts.Items(principal.UserID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Failed to fetch payment modes", http.StatusInternalServerError)
+			return
+		}
+		cart := models.Cart{Items: items}
+		total = cart.GetTotalPrice()
+	}
+
+	paymentModes, err := ps.Payments.ListModes()
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to fetch payment modes", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var paymentModes []*models.PaymentMode
+	available := []*models.PaymentMode{}
+	for _, mode := range paymentModes {
+		if _, ok := ps.Providers[mode.Provider]; !mode.IsActive || !ok {
+			continue
+		}
+		if signedIn && !mode.Allows(total, pincode) || !mode.AllowsPincode(pincode) {
+			continue
+		}
+		available = append(available, mode)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(available)
+}
 
-	for rows.Next() {
-		var paymentMode models.PaymentMode
+// PaymentModeRequest represents the request body for creating or changing a payment mode
+type PaymentModeRequest struct {
+	Mode     string `json:"mode"`
+	IsActive bool   `json:"is_active"`
+	// Provider must be one of the enabled payment providers
+	Provider string `json:"provider"`
+	// MinOrderValue and MaxOrderValue bound the order totals the mode accepts; zero is no limit
+	MinOrderValue float64 `json:"min_order_value"`
+	MaxOrderValue float64 `json:"max_order_value"`
+	// AllowedPincodes restricts the mode to deliveries to these pincodes; empty allows every pincode
+	AllowedPincodes []string `json:"allowed_pincodes"`
+}
 
-		err := rows.Scan(&paymentMode.ID, &paymentMode.Mode, &paymentMode.IsActive)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Failed to fetch payment modes", http.StatusInternalServerError)
-			return
+// paymentMode validates the request and returns the payment mode it describes
+func (ps *PaymentService) paymentMode(request *PaymentModeRequest) (*models.PaymentMode, string) {
+	mode := &models.PaymentMode{
+		Mode:            strings.TrimSpace(request.Mode),
+		IsActive:        request.IsActive,
+		Provider:        request.Provider,
+		MinOrderValue:   request.MinOrderValue,
+		MaxOrderValue:   request.MaxOrderValue,
+		AllowedPincodes: []string{},
+	}
+	if mode.Mode == "" {
+		return nil, "Mode is required"
+	}
+	if _, ok := ps.Providers[mode.Provider]; !ok {
+		return nil, "Unknown payment provider"
+	}
+	if mode.MinOrderValue < 0 || mode.MaxOrderValue < 0 {
+		return nil, "Order value limits cannot be negative"
+	}
+	if mode.MaxOrderValue > 0 && mode.MaxOrderValue < mode.MinOrderValue {
+		return nil, "Maximum order value is below the minimum"
+	}
+	for _, pincode := range request.AllowedPincodes {
+		pincode = strings.TrimSpace(pincode)
+		if pincode == "" || strings.Contains(pincode, ",") {
+			return nil, "Invalid pincode"
 		}
+		mode.AllowedPincodes = append(mode.AllowedPincodes, pincode)
+	}
+	return mode, ""
+}
 
-		paymentModes = append(paymentModes, &paymentMode)
+// ListAllPaymentModes lists every payment mode, including inactive ones
+// @Summary List all payment modes
+// @Tags Payments
+// @Produce json
+// @Success 200 {array} models.PaymentMode "Payment modes"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch payment modes"
+// @Router /admin/payment/modes [get]
+func (ps *PaymentService) ListAllPaymentModes(w http.ResponseWriter, r *http.Request) {
+	paymentModes, err := ps.Payments.ListModes()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch payment modes", http.StatusInternalServerError)
+		return
+	}
+	if paymentModes == nil {
+		paymentModes = []*models.PaymentMode{}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(paymentModes)
 }
+
+// CreatePaymentMode adds a payment mode
+// @Summary Create a payment mode
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param request body PaymentModeRequest true "Payment mode"
+// @Success 200 {object} models.PaymentMode "Payment mode created"
+// @Failure 400 {object} ErrorResponse "Invalid payment mode"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to create payment mode"
+// @Router /admin/payment/modes [post]
+func (ps *PaymentService) CreatePaymentMode(w http.ResponseWriter, r *http.Request) {
+	var request PaymentModeRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	mode, problem := ps.paymentMode(&request)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	err = ps.Payments.CreateMode(mode)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to create payment mode", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mode)
+}
+
+// UpdatePaymentMode replaces a payment mode
+// @Summary Update a payment mode
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param id path int true "Payment mode ID"
+// @Param request body PaymentModeRequest true "Payment mode"
+// @Success 200 {object} models.PaymentMode "Payment mode updated"
+// @Failure 400 {object} ErrorResponse "Invalid payment mode"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Payment mode not found"
+// @Failure 500 {object} ErrorResponse "Failed to update payment mode"
+// @Router /admin/payment/modes/{id} [put]
+func (ps *PaymentService) UpdatePaymentMode(w http.ResponseWriter, r *http.Request) {
+	modeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid payment mode ID", http.StatusBadRequest)
+		return
+	}
+
+	var request PaymentModeRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	mode, problem := ps.paymentMode(&request)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+	mode.ID = modeID
+
+	err = ps.Payments.UpdateMode(mode)
+	if err == store.ErrNotFound {
+		http.Error(w, "Payment mode not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to update payment mode", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mode)
+}
+
+// DeletePaymentMode removes a payment mode that no purchase was made with.
+// Modes in use can be deactivated instead.
+// @Summary Delete a payment mode
+// @Tags Payments
+// @Param id path int true "Payment mode ID"
+// @Success 200 {string} string "Payment mode deleted successfully"
+// @Failure 400 {object} ErrorResponse "Invalid payment mode ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Payment mode not found"
+// @Failure 409 {object} ErrorResponse "Payment mode is in use"
+// @Failure 500 {object} ErrorResponse "Failed to delete payment mode"
+// @Router /admin/payment/modes/{id} [delete]
+func (ps *PaymentService) DeletePaymentMode(w http.ResponseWriter, r *http.Request) {
+	modeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid payment mode ID", http.StatusBadRequest)
+		return
+	}
+
+	err = ps.Payments.DeleteMode(modeID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Payment mode not found", http.StatusNotFound)
+		return
+	}
+	if err == store.ErrModeInUse {
+		http.Error(w, "Payment mode is in use; deactivate it instead", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to delete payment mode", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Payment mode deleted successfully"))
+}
+
+// CreatePaymentRequest represents the request body for paying for a purchase
+type CreatePaymentRequest struct {
+	PurchaseID int `json:"purchase_id"`
+}
+
+// CreatePayment starts paying for a purchase with the provider of its payment mode.
+// Online payments are completed through the provider's checkout with the returned
+// provider order ID and confirmed by its webhook; cash on delivery confirms the
+// purchase at once. Paying again while a payment awaits capture returns that payment.
+// @Summary Pay for a purchase
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param request body CreatePaymentRequest true "Purchase to pay for"
+// @Success 200 {object} models.Payment "Payment created"
+// @Failure 400 {object} ErrorResponse "Invalid request or payment mode not available"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Purchase not found"
+// @Failure 409 {object} ErrorResponse "Purchase is not awaiting payment"
+// @Failure 500 {object} ErrorResponse "Failed to create payment"
+// @Failure 502 {object} ErrorResponse "Payment provider failed"
+// @Router /payments [post]
+func (ps *PaymentService) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	var request CreatePaymentRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	purchase, err := ps.Orders.Get(request.PurchaseID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Purchase not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+
+	if !utils.AuthorizeUser(w, r, purchase.UserID) {
+		return
+	}
+	if purchase.Status != models.PurchaseStatusPendingPayment {
+		http.Error(w, "Purchase is not awaiting payment", http.StatusConflict)
+		return
+	}
+
+	provider, ok := ps.provider(purchase)
+	if !ok {
+		http.Error(w, "Payment mode is not available", http.StatusBadRequest)
+		return
+	}
+
+	// A customer retrying the checkout pays the order they were already given
+	open, err := ps.openPayment(purchase.ID, provider.Name())
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+	if open != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(open)
+		return
+	}
+
+	order, err := provider.CreateOrder(purchase.ID, purchase.TotalPrice, ps.Currency)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Payment provider failed", http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	payment := &models.Payment{
+		PurchaseID:      purchase.ID,
+		Provider:        provider.Name(),
+		ProviderOrderID: order.ID,
+		Amount:          purchase.TotalPrice,
+		Currency:        ps.Currency,
+		Status:          models.PaymentStatusCreated,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if order.Offline {
+		payment.Status = models.PaymentStatusPending
+	}
+
+	// A concurrent request may have stored a payment since; Create then returns that one
+	_, err = ps.Payments.Create(payment)
+	if errors.Is(err, store.ErrInvalidTransition) {
+		http.Error(w, "Purchase is not awaiting payment", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
+
+// openPayment returns the latest payment of a purchase with the provider that awaits
+// capture, or nil when there is none
+func (ps *PaymentService) openPayment(purchaseID int, provider string) (*models.Payment, error) {
+	existing, err := ps.Payments.ListByPurchase(purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(existing) - 1; i >= 0; i-- {
+		if existing[i].Provider == provider && existing[i].Status == models.PaymentStatusCreated {
+			return existing[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// provider returns the enabled provider of the purchase's payment mode. The mode must
+// still be active and allow the purchase's total and pincode, as its limits may have
+// changed since the order was placed.
+func (ps *PaymentService) provider(purchase *models.Purchase) (payments.Provider, bool) {
+	mode, err := ps.Payments.GetMode(purchase.PaymentID)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Println(err)
+		}
+		return nil, false
+	}
+	if !mode.IsActive {
+		return nil, false
+	}
+	address, err := ps.Addresses.Get(purchase.AddressID)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Println(err)
+		}
+		return nil, false
+	}
+	if !mode.Allows(purchase.TotalPrice, address.ZipCode) {
+		return nil, false
+	}
+
+	provider, ok := ps.Providers[mode.Provider]
+	return provider, ok
+}
+
+// HandleWebhook receives payment updates from a provider. Calls must be signed by the provider.
+// @Summary Receive a payment provider webhook
+// @Tags Payments
+// @Accept json
+// @Param provider path string true "Provider name"
+// @Success 200 "Webhook processed"
+// @Failure 400 "Invalid webhook or captured amount does not match the payment"
+// @Failure 401 "Invalid signature"
+// @Failure 404 "Unknown provider"
+// @Failure 500 "Failed to process webhook"
+// @Router /payments/webhook/{provider} [post]
+func (ps *PaymentService) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	providerName := mux.Vars(r)["provider"]
+	provider, ok := ps.Providers[providerName]
+	if !ok {
+		http.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, "Invalid webhook", http.StatusBadRequest)
+		return
+	}
+
+	event, err := provider.ParseWebhook(payload, r.Header)
+	if err == payments.ErrInvalidSignature {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Invalid webhook", http.StatusBadRequest)
+		return
+	}
+
+	// Gateways report on every order of the account, so unknown orders are acknowledged and ignored
+	payment, err := ps.Payments.GetByProviderOrder(providerName, event.OrderID)
+	if err == store.ErrNotFound {
+		log.Printf("Ignoring %s webhook for unknown %s order %q", event.Type, providerName, event.OrderID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to process webhook", http.StatusInternalServerError)
+		return
+	}
+
+	// Gateways retry webhooks, so updates that were already applied are skipped
+	switch event.Type {
+	case payments.EventPaymentCaptured:
+		// A capture for another amount is left for an admin to look into rather than confirming the purchase
+		if !payments.SameAmount(event.Amount, payment.Amount) || (event.Currency != "" && event.Currency != payment.Currency) {
+			log.Printf("Rejecting capture of %.2f %s for payment %d of %.2f %s", event.Amount, event.Currency, payment.ID, payment.Amount, payment.Currency)
+			http.Error(w, "Captured amount does not match the payment", http.StatusBadRequest)
+			return
+		}
+		_, err = ps.Payments.Capture(payment.ID, event.PaymentID)
+	case payments.EventPaymentFailed:
+		_, err = ps.Payments.Fail(payment.ID)
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to process webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
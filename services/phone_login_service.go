@@ -0,0 +1,136 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/notifications"
+	"github.com/gklps/mittai-backend/store"
+)
+
+// PhoneOTPRequest represents the request body for requesting a login code by phone
+type PhoneOTPRequest struct {
+	ContactNumber string `json:"contact_number"`
+}
+
+// PhoneOTPVerifyRequest represents the request body for logging in with a phone code
+type PhoneOTPVerifyRequest struct {
+	ContactNumber string `json:"contact_number"`
+	OTP           string `json:"otp"`
+}
+
+// RequestLoginOTP sends a login code by SMS to the account with the given contact number.
+// The response is the same whether or not the account exists.
+// @Summary Request a login code by SMS
+// @Tags Users
+// @Accept json
+// @Param request body PhoneOTPRequest true "Contact number"
+// @Success 200 {string} string "If the account exists, a login code has been sent"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 500 {object} ErrorResponse "Failed to send login code"
+// @Router /login/otp/request [post]
+func (us *UserService) RequestLoginOTP(w http.ResponseWriter, r *http.Request) {
+	var request PhoneOTPRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.ContactNumber == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := us.Users.GetByContactNumber(request.ContactNumber)
+	if err != nil && err != store.ErrNotFound {
+		log.Println(err)
+		http.Error(w, "Failed to send login code", http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil {
+		us.sendLoginCode(user)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("If the account exists, a login code has been sent"))
+}
+
+// sendLoginCode issues and texts a login code when the resend limits allow it.
+// Failures are only logged so the response does not reveal whether the account exists.
+func (us *UserService) sendLoginCode(user *models.User) {
+	allowed, err := us.canSendOTP(user.UserID, otpPurposeLogin)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if !allowed {
+		log.Printf("Login code for user %d requested too often", user.UserID)
+		return
+	}
+
+	otp, err := us.issueOTP(user.UserID, otpPurposeLogin, us.OTP.TTL)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := us.SMS.Send(notifications.LoginOTPSMS(user.ContactNumber, otp, us.OTP.TTL)); err != nil {
+		log.Println(err)
+	}
+}
+
+// VerifyLoginOTP logs a user in with a code sent to their phone
+// @Summary Log in with an SMS code
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param request body PhoneOTPVerifyRequest true "Contact number and code"
+// @Success 200 {object} LoginResponse "Login successful"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 401 {object} ErrorResponse "Invalid or expired code"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts"
+// @Failure 500 {object} ErrorResponse "Failed to log in"
+// @Router /login/otp/verify [post]
+func (us *UserService) VerifyLoginOTP(w http.ResponseWriter, r *http.Request) {
+	var request PhoneOTPVerifyRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.ContactNumber == "" || request.OTP == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := us.Users.GetByContactNumber(request.ContactNumber)
+	if err == store.ErrNotFound {
+		http.Error(w, "Invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	valid, err := us.verifyOTP(user.UserID, otpPurposeLogin, request.OTP)
+	if err == errOTPLocked {
+		http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+
+	response, err := us.issueTokens(user.UserID, "")
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -7,18 +7,19 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/gklps/mittai-backend/db"
 	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
 	"github.com/gorilla/mux"
 )
 
 type ProductWeightService struct {
-	DB *db.Repository
+	Products store.ProductStore
 }
 
-func NewProductWeightService(db *db.Repository) *ProductWeightService {
+func NewProductWeightService(stores *store.Stores) *ProductWeightService {
 	return &ProductWeightService{
-		DB: db,
+		Products: stores.Products,
 	}
 }
 
@@ -40,8 +41,8 @@ type UpdateProductWeightRequest struct {
 
 // DefineRoutes sets up the routes for the ProductWeightService
 func (ps *ProductWeightService) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/productweight/{productID}/weights", ps.AddProductWeight).Methods("POST")
-	router.HandleFunc("/productweight/{productID}/weights/{weightID}", ps.UpdateProductWeight).Methods("PUT")
+	router.HandleFunc("/productweight/{productID}/weights", utils.RequireRoleFunc(ps.AddProductWeight, utils.RoleStaff)).Methods("POST")
+	router.HandleFunc("/productweight/{productID}/weights/{weightID}", utils.RequireRoleFunc(ps.UpdateProductWeight, utils.RoleStaff)).Methods("PUT")
 	router.HandleFunc("/productweight/weights/{weightID}", ps.FetchProductWeight).Methods("GET") // New Route
 }
 
@@ -53,6 +54,7 @@ func (ps *ProductWeightService) RegisterRoutes(router *mux.Router) {
 // @Produce json
 // @Success 200 {object} SuccessResponse "Weight added successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request body or product ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to add weight"
 // @Router /productweight/{productID}/weights [post]
 func (ps *ProductWeightService) AddProductWeight(w http.ResponseWriter, r *http.Request) {
@@ -89,7 +91,7 @@ func (ps *ProductWeightService) AddProductWeight(w http.ResponseWriter, r *http.
 	}
 
 	// Save the weight to the database
-	err = ps.saveProductWeight(newWeight)
+	err = ps.Products.CreateWeight(newWeight)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to add weight", http.StatusInternalServerError)
@@ -118,18 +120,27 @@ func (ps *ProductWeightService) AddProductWeight(w http.ResponseWriter, r *http.
 // @Param weight body UpdateProductWeightRequest true "Product weight details"
 // @Success 200 "Weight updated successfully"
 // @Failure 400 "Invalid request body or product/weight ID"
+// @Failure 403 "Forbidden"
+// @Failure 404 "Weight not found"
 // @Failure 500 "Failed to update weight"
 // @Router /productweight/{productID}/weights/{weightID} [put]
 func (ps *ProductWeightService) UpdateProductWeight(w http.ResponseWriter, r *http.Request) {
 	// Retrieve the product ID and weight ID from the path parameters
 	vars := mux.Vars(r)
-	productID := vars["productID"]
-	weightID := vars["weightID"]
-	measurement := vars["measurement"]
+	productID, err := strconv.Atoi(vars["productID"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	weightID, err := strconv.Atoi(vars["weightID"])
+	if err != nil {
+		http.Error(w, "Invalid weight ID", http.StatusBadRequest)
+		return
+	}
 
 	// Parse the request body
 	var weight UpdateProductWeightRequest
-	err := json.NewDecoder(r.Body).Decode(&weight)
+	err = json.NewDecoder(r.Body).Decode(&weight)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -137,7 +148,19 @@ func (ps *ProductWeightService) UpdateProductWeight(w http.ResponseWriter, r *ht
 	}
 
 	// Update the product weight in the database
-	err = ps.updateProductWeight(productID, weightID, weight, measurement)
+	err = ps.Products.UpdateWeight(&models.ProductWeight{
+		ID:                weightID,
+		ProductID:         productID,
+		Weight:            weight.Weight,
+		Price:             weight.Price,
+		StockAvailability: weight.StockAvailability,
+		Measurement:       weight.Measurement,
+		UpdatedAt:         time.Now(),
+	})
+	if err == store.ErrNotFound {
+		http.Error(w, "Weight not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to update weight", http.StatusInternalServerError)
@@ -156,6 +179,7 @@ func (ps *ProductWeightService) UpdateProductWeight(w http.ResponseWriter, r *ht
 // @Produce json
 // @Success 200 {object} models.ProductWeight "Successfully fetched weight details"
 // @Failure 400 "Invalid weight ID"
+// @Failure 404 "Weight not found"
 // @Failure 500 "Failed to fetch weight details"
 // @Router /productweight/weights/{weightID} [get]
 func (ps *ProductWeightService) FetchProductWeight(w http.ResponseWriter, r *http.Request) {
@@ -170,7 +194,11 @@ func (ps *ProductWeightService) FetchProductWeight(w http.ResponseWriter, r *htt
 		return
 	}
 
-	productWeight, err := ps.getProductWeight(weightID)
+	productWeight, err := ps.Products.GetWeight(weightID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Weight not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to fetch weight details", http.StatusInternalServerError)
@@ -185,36 +213,3 @@ func (ps *ProductWeightService) FetchProductWeight(w http.ResponseWriter, r *htt
 		return
 	}
 }
-
-// getProductWeight fetches a weight variant details from the database based on weightID
-func (ps *ProductWeightService) getProductWeight(weightID int) (*models.ProductWeight, error) {
-	query := `SELECT * FROM product_weights WHERE id = ?`
-	row := ps.DB.QueryRow(query, weightID)
-
-	var weight models.ProductWeight
-	err := row.Scan(&weight.ID, &weight.ProductID, &weight.Weight, &weight.Price, &weight.StockAvailability, &weight.CreatedAt, &weight.UpdatedAt, &weight.Measurement)
-	if err != nil {
-		return nil, err
-	}
-	return &weight, nil
-}
-
-// saveProductWeight saves a weight variant for a product to the database
-func (ps *ProductWeightService) saveProductWeight(weight *models.ProductWeight) error {
-	query := `INSERT INTO product_weights (product_id, weight, price, stock, created_at, updated_at, measurement) VALUES (?, ?, ?, ?, ?, ?,?)`
-	_, err := ps.DB.Exec(query, weight.ProductID, weight.Weight, weight.Price, weight.StockAvailability, weight.CreatedAt, weight.UpdatedAt, weight.Measurement)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// updateProductWeight updates an existing weight variant for a product in the database
-func (ps *ProductWeightService) updateProductWeight(productID string, weightID string, weight UpdateProductWeightRequest, measurement string) error {
-	query := `UPDATE product_weights SET weight = ?, price = ?, stock = ?, updated_at = ?, measurement = ? WHERE product_id = ? AND id = ?`
-	_, err := ps.DB.Exec(query, weight.Weight, weight.Price, weight.StockAvailability, time.Now(), weight.Measurement, productID, weightID)
-	if err != nil {
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// PromotionService handles the promotion and discount code related operations
+type PromotionService struct {
+	Promotions store.PromotionStore
+	Offers     store.OfferStore
+	Carts      store.CartStore
+}
+
+// NewPromotionService creates a new instance of PromotionService
+func NewPromotionService(stores *store.Stores) *PromotionService {
+	return &PromotionService{
+		Promotions: stores.Promotions,
+		Offers:     stores.Offers,
+		Carts:      stores.Carts,
+	}
+}
+
+// RegisterRoutes registers the promotion routes
+func (ps *PromotionService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/cart/coupon", utils.AuthenticateFunc(ps.ApplyCoupon)).Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/promotions", utils.RequireRoleFunc(ps.ListPromotions, utils.RoleAdmin)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/promotions", utils.RequireRoleFunc(ps.CreatePromotion, utils.RoleAdmin)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/promotions/{id}", utils.RequireRoleFunc(ps.GetPromotion, utils.RoleAdmin)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/promotions/{id}", utils.RequireRoleFunc(ps.UpdatePromotion, utils.RoleAdmin)).Methods(http.MethodPut)
+	r.HandleFunc("/admin/promotions/{id}", utils.RequireRoleFunc(ps.DeletePromotion, utils.RoleAdmin)).Methods(http.MethodDelete)
+}
+
+// ApplyCouponRequest represents the request body for trying a discount code on the cart
+type ApplyCouponRequest struct {
+	UserID       int    `json:"user_id"`
+	DiscountCode string `json:"discount_code"`
+}
+
+// ApplyCouponResponse represents what the cart would cost with a discount code
+type ApplyCouponResponse struct {
+	Subtotal float64 `json:"subtotal"`
+	// Offers are the discounts the cart gets without a code
+	Offers     []*models.PurchaseDiscount `json:"offers"`
+	Discount   *models.PurchaseDiscount   `json:"discount"`
+	TotalPrice float64                    `json:"total_price"`
+}
+
+// ApplyCoupon checks a discount code against the user's cart and returns the discount
+// it gives. The code is applied for real by passing it to checkout.
+// @Summary Try a discount code on the cart
+// @Tags Promotions
+// @Accept json
+// @Produce json
+// @Param request body ApplyCouponRequest true "Discount code"
+// @Success 200 {object} ApplyCouponResponse "Discount for the cart"
+// @Failure 400 {object} ErrorResponse "Empty cart or discount code cannot be applied"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to apply discount code"
+// @Router /cart/coupon [post]
+func (ps *PromotionService) ApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	var request ApplyCouponRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || strings.TrimSpace(request.DiscountCode) == "" {
+		http.Error(w, "A discount code is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := utils.ActingUserID(w, r, request.UserID)
+	if !ok {
+		return
+	}
+
+	cartItems, err := ps.Carts.Items(userID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to apply discount code", http.StatusInternalServerError)
+		return
+	}
+	if len(cartItems) == 0 {
+		http.Error(w, "Cart is empty", http.StatusBadRequest)
+		return
+	}
+
+	response := ApplyCouponResponse{}
+	items := cartPurchaseItems(cartItems)
+	for _, item := range items {
+		response.Subtotal += item.ProductPrice * float64(item.Quantity)
+	}
+
+	response.Discount, err = ps.Promotions.Quote(userID, request.DiscountCode, items)
+	if errors.Is(err, store.ErrInvalidPromotion) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		response.Offers, err = ps.Offers.Price(items)
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to apply discount code", http.StatusInternalServerError)
+		return
+	}
+	if response.Offers == nil {
+		response.Offers = []*models.PurchaseDiscount{}
+	}
+
+	// The code is applied after the offers, as at checkout
+	discounts := append(response.Offers, response.Discount)
+	response.TotalPrice = response.Subtotal - models.TotalDiscount(discounts, response.Subtotal)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PromotionRequest represents the request body for creating or changing a promotion
+type PromotionRequest struct {
+	DiscountCode string `json:"discount_code"`
+	// ProductID and Category limit the promotion to some products; leave them out to apply to every product
+	ProductID int    `json:"product_id"`
+	Category  string `json:"category"`
+	// DiscountType is "percentage" or "fixed"
+	DiscountType       string  `json:"discount_type"`
+	DiscountPercentage float64 `json:"discount_percentage"`
+	DiscountAmount     float64 `json:"discount_amount"`
+	MinOrderValue      float64 `json:"min_order_value"`
+	UsageLimitPerUser  int     `json:"usage_limit_per_user"`
+	// StartDate and EndDate are RFC 3339 times; leave them out for no bound
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	IsActive  bool      `json:"is_active"`
+}
+
+// promotion validates the request and returns the promotion it describes
+func (ps *PromotionService) promotion(request *PromotionRequest) (*models.Promotion, string) {
+	promotion := &models.Promotion{
+		DiscountCode:      models.NormalizeDiscountCode(request.DiscountCode),
+		ProductID:         request.ProductID,
+		Category:          strings.TrimSpace(request.Category),
+		DiscountType:      request.DiscountType,
+		MinOrderValue:     request.MinOrderValue,
+		UsageLimitPerUser: request.UsageLimitPerUser,
+		StartDate:         request.StartDate,
+		EndDate:           request.EndDate,
+		IsActive:          request.IsActive,
+	}
+	if promotion.DiscountCode == "" || strings.ContainsAny(promotion.DiscountCode, " \t\n") {
+		return nil, "Discount code is required and cannot contain spaces"
+	}
+
+	switch promotion.DiscountType {
+	case models.DiscountTypePercentage:
+		if request.DiscountPercentage <= 0 || request.DiscountPercentage > 100 {
+			return nil, "Discount percentage must be between 0 and 100"
+		}
+		promotion.DiscountPercentage = request.DiscountPercentage
+	case models.DiscountTypeFixed:
+		if request.DiscountAmount <= 0 {
+			return nil, "Discount amount must be positive"
+		}
+		promotion.DiscountAmount = request.DiscountAmount
+	default:
+		return nil, "Discount type must be percentage or fixed"
+	}
+
+	if promotion.ProductID < 0 || promotion.MinOrderValue < 0 || promotion.UsageLimitPerUser < 0 {
+		return nil, "Product, minimum order value and usage limit cannot be negative"
+	}
+	if !promotion.StartDate.IsZero() && !promotion.EndDate.IsZero() && promotion.EndDate.Before(promotion.StartDate) {
+		return nil, "End date is before the start date"
+	}
+	return promotion, ""
+}
+
+// checkCodeAvailable writes a 409 response and returns false when another promotion has the code
+func (ps *PromotionService) checkCodeAvailable(w http.ResponseWriter, promotion *models.Promotion) bool {
+	existing, err := ps.Promotions.GetByCode(promotion.DiscountCode)
+	if err == store.ErrNotFound {
+		return true
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save promotion", http.StatusInternalServerError)
+		return false
+	}
+	if existing.PromotionID != promotion.PromotionID {
+		http.Error(w, "Discount code already exists", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// ListPromotions lists every promotion
+// @Summary List promotions
+// @Tags Promotions
+// @Produce json
+// @Success 200 {array} models.Promotion "Promotions"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch promotions"
+// @Router /admin/promotions [get]
+func (ps *PromotionService) ListPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := ps.Promotions.List()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch promotions", http.StatusInternalServerError)
+		return
+	}
+	if promotions == nil {
+		promotions = []*models.Promotion{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotions)
+}
+
+// GetPromotion retrieves a promotion
+// @Summary Get a promotion
+// @Tags Promotions
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Success 200 {object} models.Promotion "Promotion"
+// @Failure 400 {object} ErrorResponse "Invalid promotion ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Promotion not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch promotion"
+// @Router /admin/promotions/{id} [get]
+func (ps *PromotionService) GetPromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	promotion, err := ps.Promotions.Get(promotionID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Promotion not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotion)
+}
+
+// CreatePromotion adds a promotion
+// @Summary Create a promotion
+// @Tags Promotions
+// @Accept json
+// @Produce json
+// @Param request body PromotionRequest true "Promotion"
+// @Success 200 {object} models.Promotion "Promotion created"
+// @Failure 400 {object} ErrorResponse "Invalid promotion"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 409 {object} ErrorResponse "Discount code already exists"
+// @Failure 500 {object} ErrorResponse "Failed to save promotion"
+// @Router /admin/promotions [post]
+func (ps *PromotionService) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	var request PromotionRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	promotion, problem := ps.promotion(&request)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+	if !ps.checkCodeAvailable(w, promotion) {
+		return
+	}
+
+	promotion.CreatedAt = time.Now()
+	promotion.UpdatedAt = promotion.CreatedAt
+	err = ps.Promotions.Create(promotion)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotion)
+}
+
+// UpdatePromotion replaces a promotion. Purchases already discounted keep their discount lines.
+// @Summary Update a promotion
+// @Tags Promotions
+// @Accept json
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Param request body PromotionRequest true "Promotion"
+// @Success 200 {object} models.Promotion "Promotion updated"
+// @Failure 400 {object} ErrorResponse "Invalid promotion"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Promotion not found"
+// @Failure 409 {object} ErrorResponse "Discount code already exists"
+// @Failure 500 {object} ErrorResponse "Failed to save promotion"
+// @Router /admin/promotions/{id} [put]
+func (ps *PromotionService) UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	var request PromotionRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	promotion, problem := ps.promotion(&request)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	existing, err := ps.Promotions.Get(promotionID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Promotion not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save promotion", http.StatusInternalServerError)
+		return
+	}
+	promotion.PromotionID = existing.PromotionID
+	promotion.CreatedAt = existing.CreatedAt
+	promotion.UpdatedAt = time.Now()
+	if !ps.checkCodeAvailable(w, promotion) {
+		return
+	}
+
+	err = ps.Promotions.Update(promotion)
+	if err == store.ErrNotFound {
+		http.Error(w, "Promotion not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotion)
+}
+
+// DeletePromotion removes a promotion no purchase was discounted with.
+// Promotions in use can be deactivated instead.
+// @Summary Delete a promotion
+// @Tags Promotions
+// @Param id path int true "Promotion ID"
+// @Success 200 {string} string "Promotion deleted successfully"
+// @Failure 400 {object} ErrorResponse "Invalid promotion ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Promotion not found"
+// @Failure 409 {object} ErrorResponse "Promotion is in use"
+// @Failure 500 {object} ErrorResponse "Failed to delete promotion"
+// @Router /admin/promotions/{id} [delete]
+func (ps *PromotionService) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	err = ps.Promotions.Delete(promotionID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Promotion not found", http.StatusNotFound)
+		return
+	}
+	if err == store.ErrPromotionInUse {
+		http.Error(w, "Promotion is in use; deactivate it instead", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to delete promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Promotion deleted successfully"))
+}
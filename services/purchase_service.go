@@ -2,150 +2,245 @@ package services
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
-	"github.com/gklps/mittai-backend/db"
 	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/notifications"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
 	"github.com/gorilla/mux"
 )
 
 // PurchaseService handles the purchase related operations
 type PurchaseService struct {
-	DB              *db.Repository
-	ProductService  *ProductService
-	RecentPurchases map[string]time.Time
-	CartService     *CartService
-	Mutex           sync.Mutex
+	Orders store.OrderStore
+	Users  store.UserStore
+	Email  notifications.EmailSender
 }
 
 // NewPurchaseService creates a new instance of PurchaseService
-func NewPurchaseService(db *db.Repository, prodService *ProductService, cartService *CartService) *PurchaseService {
+func NewPurchaseService(stores *store.Stores, email notifications.EmailSender) *PurchaseService {
 	return &PurchaseService{
-		DB:              db,
-		ProductService:  prodService,
-		RecentPurchases: make(map[string]time.Time),
-		CartService:     cartService,
+		Orders: stores.Orders,
+		Users:  stores.Users,
+		Email:  email,
 	}
 }
 
 // RegisterRoutes registers the purchase routes
 func (ps *PurchaseService) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/purchase", ps.CreatePurchase).Methods(http.MethodPost)
-	r.HandleFunc("/purchase/{userID}", ps.GetPurchasesByUserID).Methods(http.MethodGet)
+	r.HandleFunc("/purchase", utils.AuthenticateFunc(ps.CreatePurchase)).Methods(http.MethodPost)
+	r.HandleFunc("/checkout", utils.AuthenticateFunc(ps.Checkout)).Methods(http.MethodPost)
+	r.HandleFunc("/purchase/{userID}", utils.AuthenticateFunc(ps.GetPurchasesByUserID)).Methods(http.MethodGet)
+	r.HandleFunc("/purchase/{id}/cancel", utils.AuthenticateFunc(ps.CancelPurchase)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/purchases", utils.RequireRoleFunc(ps.ListPurchases, utils.RoleStaff)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/purchases/{id}/status", utils.RequireRoleFunc(ps.UpdatePurchaseStatus, utils.RoleStaff)).Methods(http.MethodPut)
+	r.HandleFunc("/admin/purchases/{id}/history", utils.RequireRoleFunc(ps.GetPurchaseHistory, utils.RoleStaff)).Methods(http.MethodGet)
 }
 
+// CreatePurchase places an order. Prices and totals are computed from the current
+// product weights and the ordered quantities are taken out of stock.
 // @Summary Create a new purchase
 // @Tags Purchases
 // @Accept json
 // @Produce json
 // @Param purchase body models.PurchaseRequest true "Purchase payload"
-// @Success 200 {string} string "Purchase created successfully"
-// @Failure 400 "Bad request"
-// @Failure 500 "Failed to create purchase"
+// @Param Idempotency-Key header string false "Replays the first response when the request is retried"
+// @Success 200 {object} models.Purchase "Purchase created successfully"
+// @Failure 400 {object} ErrorResponse "Bad request, invalid item, address, payment mode or discount code"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 409 {object} ErrorResponse "Item out of stock"
+// @Failure 500 {object} ErrorResponse "Failed to create purchase"
 // @Router /purchase [post]
 func (ps *PurchaseService) CreatePurchase(w http.ResponseWriter, r *http.Request) {
 	// Parse and decode the request body into the struct
-	var purchase models.CreatePurchase
-	err := json.NewDecoder(r.Body).Decode(&purchase)
+	var request models.PurchaseRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	// Convert the purchase request to a string to use as a key for the map
-	purchaseKey, err := json.Marshal(purchase)
-	if err != nil {
-		http.Error(w, "Failed to process request", http.StatusInternalServerError)
+	if len(request.PurchaseItemRequest) == 0 {
+		http.Error(w, "No items to purchase", http.StatusBadRequest)
 		return
 	}
-
-	ps.Mutex.Lock()
-
-	// Check if the same request has been processed recently
-	if timestamp, exists := ps.RecentPurchases[string(purchaseKey)]; exists {
-		if time.Since(timestamp) <= time.Duration(1.5*float64(time.Second)) {
-			http.Error(w, "Duplicate request", http.StatusTooManyRequests)
-			ps.Mutex.Unlock() // Don't forget to unlock before returning
+	for _, item := range request.PurchaseItemRequest {
+		if item.Quantity <= 0 {
+			http.Error(w, "Quantity must be positive", http.StatusBadRequest)
 			return
 		}
 	}
 
+	userID, ok := utils.ActingUserID(w, r, request.UserID)
+	if !ok {
+		return
+	}
+	request.UserID = userID
+
 	// Store the purchase in the database
-	err = ps.storePurchaseInDB(purchase)
+	purchase, err := ps.storePurchaseInDB(request)
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to create purchase", http.StatusInternalServerError)
+		writeOrderError(w, err, "Failed to create purchase")
 		return
 	}
 
-	// Update the map with the current request and timestamp
-	ps.RecentPurchases[string(purchaseKey)] = time.Now()
-	ps.Mutex.Unlock()
+	// The confirmation email must not hold up or fail the purchase
+	go ps.sendOrderConfirmation(purchase.ID, purchase.UserID)
 
 	// Send the response
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Purchase created successfully"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(purchase)
 }
 
-func (ps *PurchaseService) storePurchaseInDB(purchase models.CreatePurchase) error {
-	// Begin a transaction
-	tx, err := ps.DB.Begin()
-	if err != nil {
-		return err
+// storePurchaseInDB stores the purchase; the store prices the items and reserves their stock
+func (ps *PurchaseService) storePurchaseInDB(request models.PurchaseRequest) (*models.Purchase, error) {
+	now := time.Now()
+	purchase := &models.Purchase{
+		UserID:    request.UserID,
+		AddressID: request.AddressID,
+		PaymentID: request.PaymentID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		// Applied by the store along with the order
+		DiscountCode: request.DiscountCode,
+	}
+
+	for _, item := range request.PurchaseItemRequest {
+		purchase.Items = append(purchase.Items, &models.PurchaseItem{
+			ProductID:       item.ProductID,
+			ProductWeightID: item.ProductWeightID,
+			Quantity:        item.Quantity,
+		})
 	}
 
-	// Insert into purchase table
-	query := `INSERT INTO purchases (address_id, payment_id, user_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
-	result, err := tx.Exec(query, purchase.AddressID, purchase.PaymentID, purchase.UserID, time.Now(), time.Now())
+	if err := ps.Orders.Create(purchase); err != nil {
+		return nil, err
+	}
+	return purchase, nil
+}
+
+// CheckoutRequest represents the request body for checking out the cart
+type CheckoutRequest struct {
+	UserID    int `json:"user_id"`
+	AddressID int `json:"address_id"`
+	PaymentID int `json:"payment_id"`
+	// DiscountCode is an optional coupon to apply
+	DiscountCode string `json:"discount_code"`
+}
+
+// Checkout turns the user's cart into a purchase and empties the cart
+// @Summary Check out the cart
+// @Tags Purchases
+// @Accept json
+// @Produce json
+// @Param request body CheckoutRequest true "Delivery address and payment mode"
+// @Param Idempotency-Key header string false "Replays the first response when the request is retried"
+// @Success 200 {object} models.Purchase "Purchase created successfully"
+// @Failure 400 {object} ErrorResponse "Empty cart, invalid item, address, payment mode or discount code"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 409 {object} ErrorResponse "Item out of stock"
+// @Failure 500 {object} ErrorResponse "Failed to check out"
+// @Router /checkout [post]
+func (ps *PurchaseService) Checkout(w http.ResponseWriter, r *http.Request) {
+	var request CheckoutRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		tx.Rollback()
-		return err
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := utils.ActingUserID(w, r, request.UserID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	purchase := &models.Purchase{
+		UserID:    userID,
+		AddressID: request.AddressID,
+		PaymentID: request.PaymentID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		// Applied by the store along with the order
+		DiscountCode: request.DiscountCode,
 	}
 
-	// Get the last inserted ID of the purchase
-	purchaseID, err := result.LastInsertId()
+	// The cart is emptied along with the order, so a repeated checkout finds it empty
+	err = ps.Orders.Checkout(purchase)
 	if err != nil {
-		tx.Rollback()
-		return err
+		writeOrderError(w, err, "Failed to check out")
+		return
 	}
 
-	// Insert purchase items
-	for _, item := range purchase.PurchaseItems {
-		product, err := ps.ProductService.GetProductByID(strconv.Itoa(item.ProductID))
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+	go ps.sendOrderConfirmation(purchase.ID, purchase.UserID)
 
-		var weight *models.ProductWeight
-		for _, w := range product.Weights {
-			if w.ID == item.ProductWeightID {
-				weight = w
-				break
-			}
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(purchase)
+}
 
-		if weight == nil {
-			tx.Rollback()
-			return fmt.Errorf("Weight not found for Product ID: %d, Weight ID: %d", item.ProductID, item.ProductWeightID)
-		}
+// writeOrderError responds to an order the store turned down, or with message on other failures
+func writeOrderError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, store.ErrEmptyCart), errors.Is(err, store.ErrInvalidAddress),
+		errors.Is(err, store.ErrInvalidPayment), errors.Is(err, store.ErrInvalidItem),
+		errors.Is(err, store.ErrInvalidPromotion):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrOutOfStock):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Println(err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
 
-		itemTotalPrice := weight.Price * float64(item.Quantity)
-		query := `INSERT INTO purchase_items (purchase_id, product_id, product_name, product_weight_id, product_price, quantity, total_price) VALUES (?, ?, ?, ?, ?, ?, ?)`
-		_, err = tx.Exec(query, purchaseID, item.ProductID, product.Name, item.ProductWeightID, weight.Price, item.Quantity, itemTotalPrice)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+// sendOrderConfirmation emails the customer a summary of their purchase
+func (ps *PurchaseService) sendOrderConfirmation(purchaseID int, userID int) {
+	user, err := ps.Users.Get(userID)
+	if err != nil {
+		log.Println("Failed to load customer for order confirmation:", err)
+		return
 	}
-	_, err = tx.Exec("DELETE FROM cart WHERE user_id = ?", purchase.UserID)
 
-	return tx.Commit()
+	purchase, err := ps.Orders.Get(purchaseID)
+	if err != nil {
+		log.Println("Failed to load purchase for order confirmation:", err)
+		return
+	}
+
+	data := notifications.OrderConfirmationEmailData{
+		CustomerName: user.FirstName,
+		OrderID:      purchaseID,
+		TotalPrice:   purchase.TotalPrice,
+	}
+	for _, item := range purchase.Items {
+		data.Items = append(data.Items, notifications.OrderEmailItem{
+			Name:        item.ProductName,
+			Weight:      item.Weight,
+			Measurement: item.Measurement,
+			Quantity:    item.Quantity,
+			TotalPrice:  item.TotalPrice,
+		})
+	}
+	for _, discount := range purchase.Discounts {
+		data.Discounts = append(data.Discounts, notifications.OrderEmailDiscount{
+			Description: discount.Description,
+			Amount:      discount.Amount,
+		})
+	}
+
+	message, err := notifications.OrderConfirmationEmail(user.Email, data)
+	if err == nil {
+		err = ps.Email.Send(message)
+	}
+	if err != nil {
+		log.Println("Failed to send order confirmation:", err)
+	}
 }
 
 // GetPurchasesByUserID retrieves purchases made by a specific user
@@ -155,6 +250,7 @@ func (ps *PurchaseService) storePurchaseInDB(purchase models.CreatePurchase) err
 // @Produce json
 // @Success 200 {array} models.Purchase "Purchases retrieved successfully"
 // @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to fetch purchases"
 // @Router /purchase/{userID} [get]
 func (ps *PurchaseService) GetPurchasesByUserID(w http.ResponseWriter, r *http.Request) {
@@ -168,82 +264,262 @@ func (ps *PurchaseService) GetPurchasesByUserID(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	rows, err := ps.DB.Query("SELECT id, address_id, payment_id, created_at, updated_at FROM purchases WHERE user_id = ? ORDER BY id DESC", userID)
+	if !utils.AuthorizeUser(w, r, userID) {
+		return
+	}
+
+	purchases, err := ps.Orders.ListByUser(userID)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to fetch purchases", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var purchases []*models.Purchase
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(purchases)
+}
 
-	for rows.Next() {
-		var purchase models.Purchase
+// CancelPurchaseRequest represents the request body for cancelling a purchase
+type CancelPurchaseRequest struct {
+	Reason string `json:"reason"`
+}
 
-		err := rows.Scan(&purchase.ID, &purchase.AddressID, &purchase.PaymentID, &purchase.CreatedAt, &purchase.UpdatedAt)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Failed to fetch purchases", http.StatusInternalServerError)
-			return
-		}
+// CancelPurchaseResponse represents the response for a cancelled purchase
+type CancelPurchaseResponse struct {
+	Purchase *models.Purchase `json:"purchase"`
+	// Refunds are owed for the payments captured for the purchase
+	Refunds []*models.Refund `json:"refunds,omitempty"`
+}
 
-		// Retrieve purchase items for each purchase
-		items, err := ps.getPurchaseItemsByPurchaseID(purchase.ID)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, "Failed to fetch purchases", http.StatusInternalServerError)
-			return
-		}
+// CancelPurchase lets a customer cancel their purchase until it ships. The items
+// go back in stock and a refund is recorded for every payment made for it.
+// @Summary Cancel a purchase
+// @Tags Purchases
+// @Accept json
+// @Produce json
+// @Param id path int true "Purchase ID"
+// @Param request body CancelPurchaseRequest true "Reason for cancelling"
+// @Param Idempotency-Key header string false "Replays the first response when the request is retried"
+// @Success 200 {object} CancelPurchaseResponse "Purchase cancelled successfully"
+// @Failure 400 {object} ErrorResponse "Invalid purchase ID or missing reason"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Purchase not found"
+// @Failure 409 {object} ErrorResponse "Purchase can no longer be cancelled"
+// @Failure 500 {object} ErrorResponse "Failed to cancel purchase"
+// @Router /purchase/{id}/cancel [post]
+func (ps *PurchaseService) CancelPurchase(w http.ResponseWriter, r *http.Request) {
+	purchaseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase ID", http.StatusBadRequest)
+		return
+	}
 
-		purchase.Items = items
-		purchases = append(purchases, &purchase)
+	var request CancelPurchaseRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || strings.TrimSpace(request.Reason) == "" {
+		http.Error(w, "A reason for cancelling is required", http.StatusBadRequest)
+		return
+	}
+
+	purchase, err := ps.Orders.Get(purchaseID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Purchase not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to cancel purchase", http.StatusInternalServerError)
+		return
+	}
+
+	if !utils.AuthorizeUser(w, r, purchase.UserID) {
+		return
+	}
+
+	principal, _ := utils.PrincipalFromRequest(r)
+	change := &models.PurchaseStatusChange{
+		PurchaseID: purchaseID,
+		ActorID:    principal.UserID,
+		Note:       request.Reason,
+	}
+
+	refunds, err := ps.Orders.Cancel(change)
+	if errors.Is(err, store.ErrInvalidTransition) {
+		http.Error(w, "Purchase can no longer be cancelled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to cancel purchase", http.StatusInternalServerError)
+		return
+	}
+
+	purchase.Status = change.ToStatus
+	purchase.UpdatedAt = change.CreatedAt
+	for _, refund := range refunds {
+		purchase.RefundedAmount += refund.Amount
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CancelPurchaseResponse{
+		Purchase: purchase,
+		Refunds:  refunds,
+	})
+}
+
+// ListPurchases lists every purchase, optionally only those in one status
+// @Summary List purchases
+// @Tags Purchases
+// @Param status query string false "Only purchases in this status"
+// @Produce json
+// @Success 200 {array} models.Purchase "Purchases retrieved successfully"
+// @Failure 400 {object} ErrorResponse "Invalid status"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch purchases"
+// @Router /admin/purchases [get]
+func (ps *PurchaseService) ListPurchases(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !models.IsValidPurchaseStatus(status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	purchases, err := ps.Orders.List(status)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch purchases", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(purchases)
 }
 
-// getPurchaseItemsByPurchaseID retrieves purchase items for a specific purchase ID
-func (ps *PurchaseService) getPurchaseItemsByPurchaseID(purchaseID int) ([]*models.PurchaseItem, error) {
-	// Adjusting the SQL query to include a JOIN with product_weights and fetch weight.
-	query := `SELECT 
-                pi.product_id, 
-                pi.product_name, 
-                pi.product_price, 
-                pw.weight, 
-                pi.quantity, 
-                pi.total_price,
-				pi.product_weight_id,
-				pw.measurement
-              FROM 
-                purchase_items AS pi 
-              JOIN 
-                product_weights AS pw ON pi.product_weight_id = pw.id 
-              WHERE 
-                pi.purchase_id = ?
-				ORDER BY 
-    			pi.purchase_id DESC;`
-
-	rows, err := ps.DB.Query(query, purchaseID)
+// UpdatePurchaseStatusRequest represents the request body for moving a purchase to a new status
+type UpdatePurchaseStatusRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+	// Carrier and TrackingNumber are passed on to the customer when the purchase ships
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+}
+
+// UpdatePurchaseStatus moves a purchase to a new status. The customer is emailed when it ships.
+// @Summary Update the status of a purchase
+// @Tags Purchases
+// @Accept json
+// @Produce json
+// @Param id path int true "Purchase ID"
+// @Param request body UpdatePurchaseStatusRequest true "New status"
+// @Success 200 {object} models.PurchaseStatusChange "Status updated successfully"
+// @Failure 400 {object} ErrorResponse "Invalid purchase ID or status"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Purchase not found"
+// @Failure 409 {object} ErrorResponse "Status change not allowed"
+// @Failure 500 {object} ErrorResponse "Failed to update status"
+// @Router /admin/purchases/{id}/status [put]
+func (ps *PurchaseService) UpdatePurchaseStatus(w http.ResponseWriter, r *http.Request) {
+	purchaseID, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		return nil, err
+		http.Error(w, "Invalid purchase ID", http.StatusBadRequest)
+		return
+	}
+
+	var request UpdatePurchaseStatusRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || !models.IsValidPurchaseStatus(request.Status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
 	}
-	defer rows.Close()
 
-	var items []*models.PurchaseItem
+	principal, _ := utils.PrincipalFromRequest(r)
+	change := &models.PurchaseStatusChange{
+		PurchaseID: purchaseID,
+		ToStatus:   request.Status,
+		ActorID:    principal.UserID,
+		Note:       request.Note,
+	}
 
-	for rows.Next() {
-		var item models.PurchaseItem
+	// Cancelling goes through the store's cancellation so that stock is restored
+	if change.ToStatus == models.PurchaseStatusCancelled {
+		_, err = ps.Orders.Cancel(change)
+	} else {
+		err = ps.Orders.UpdateStatus(change)
+	}
+	if err == store.ErrNotFound {
+		http.Error(w, "Purchase not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrInvalidTransition) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to update status", http.StatusInternalServerError)
+		return
+	}
 
-		// Scan now includes weight from product_weights table.
-		err := rows.Scan(&item.ProductID, &item.ProductName, &item.ProductPrice, &item.Weight, &item.Quantity, &item.TotalPrice, &item.ProductWeightID, &item.Measurement)
-		if err != nil {
-			return nil, err
-		}
+	if change.ToStatus == models.PurchaseStatusShipped {
+		go ps.sendShipmentNotice(purchaseID, request.Carrier, request.TrackingNumber)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+// sendShipmentNotice emails the customer that their purchase is on its way
+func (ps *PurchaseService) sendShipmentNotice(purchaseID int, carrier, trackingNumber string) {
+	purchase, err := ps.Orders.Get(purchaseID)
+	if err != nil {
+		log.Println("Failed to load purchase for shipment notice:", err)
+		return
+	}
 
-		items = append(items, &item)
+	user, err := ps.Users.Get(purchase.UserID)
+	if err != nil {
+		log.Println("Failed to load customer for shipment notice:", err)
+		return
+	}
+
+	message, err := notifications.ShipmentEmail(user.Email, notifications.ShipmentEmailData{
+		CustomerName:   user.FirstName,
+		OrderID:        purchaseID,
+		Carrier:        carrier,
+		TrackingNumber: trackingNumber,
+	})
+	if err == nil {
+		err = ps.Email.Send(message)
+	}
+	if err != nil {
+		log.Println("Failed to send shipment notice:", err)
 	}
+}
 
-	return items, nil
+// GetPurchaseHistory returns the status changes of a purchase
+// @Summary Get the status history of a purchase
+// @Tags Purchases
+// @Param id path int true "Purchase ID"
+// @Produce json
+// @Success 200 {array} models.PurchaseStatusChange "Status history retrieved successfully"
+// @Failure 400 {object} ErrorResponse "Invalid purchase ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch status history"
+// @Router /admin/purchases/{id}/history [get]
+func (ps *PurchaseService) GetPurchaseHistory(w http.ResponseWriter, r *http.Request) {
+	purchaseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase ID", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := ps.Orders.History(purchaseID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch status history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
 }
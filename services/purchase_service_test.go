@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/utils"
+)
+
+// stock returns the stock in hand of a weight variant
+func (s *testServer) stock(productWeightID int) int {
+	s.t.Helper()
+	weight, err := s.stores.Products.GetWeight(productWeightID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return weight.StockAvailability
+}
+
+// checkout orders the cart of the user with token, expecting code
+func (s *testServer) checkout(token string, addressID, paymentID, code int) *models.Purchase {
+	s.t.Helper()
+	w := s.do(http.MethodPost, "/checkout", token, CheckoutRequest{AddressID: addressID, PaymentID: paymentID})
+	expectStatus(s.t, w, code)
+	if code != http.StatusOK {
+		return nil
+	}
+	purchase := &models.Purchase{}
+	decode(s.t, w, purchase)
+	return purchase
+}
+
+func TestCheckout(t *testing.T) {
+	s := newTestServer(t)
+	ashaID, asha := s.user("asha@example.com", utils.RoleCustomer)
+	_, ravi := s.user("ravi@example.com", utils.RoleCustomer)
+	addressID, paymentID := s.checkoutSetup(ashaID)
+	weight := s.product(3, 100).Weights[0].ID
+
+	// An empty cart cannot be ordered
+	s.checkout(asha, addressID, paymentID, http.StatusBadRequest)
+
+	expectStatus(t, s.do(http.MethodPost, "/cart", asha, AddToCartRequest{ProductWeightID: weight, Quantity: 2}), http.StatusOK)
+
+	// The address must be the buyer's own
+	s.checkout(ravi, addressID, paymentID, http.StatusBadRequest)
+
+	purchase := s.checkout(asha, addressID, paymentID, http.StatusOK)
+	if purchase.UserID != ashaID || purchase.TotalPrice != 200 || len(purchase.Items) != 1 || purchase.Items[0].ProductPrice != 100 {
+		t.Fatalf("purchase = %+v", purchase)
+	}
+	if stock := s.stock(weight); stock != 1 {
+		t.Errorf("stock after checkout = %d, want 1", stock)
+	}
+	items, err := s.stores.Carts.Items(ashaID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("cart has %d items after checkout", len(items))
+	}
+
+	// More than is in stock is refused and nothing is taken out
+	expectStatus(t, s.do(http.MethodPost, "/cart", asha, AddToCartRequest{ProductWeightID: weight, Quantity: 2}), http.StatusOK)
+	s.checkout(asha, addressID, paymentID, http.StatusConflict)
+	if stock := s.stock(weight); stock != 1 {
+		t.Errorf("stock after a refused checkout = %d, want 1", stock)
+	}
+
+	// Purchases are only listed to their buyer
+	expectStatus(t, s.do(http.MethodGet, fmt.Sprintf("/purchase/%d", ashaID), ravi, nil), http.StatusForbidden)
+	w := s.do(http.MethodGet, fmt.Sprintf("/purchase/%d", ashaID), asha, nil)
+	expectStatus(t, w, http.StatusOK)
+	var purchases []*models.Purchase
+	decode(t, w, &purchases)
+	if len(purchases) != 1 || purchases[0].ID != purchase.ID {
+		t.Errorf("purchases = %+v", purchases)
+	}
+
+	// The mode's limits are checked again when paying
+	mode, err := s.stores.Payments.GetMode(paymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode.MaxOrderValue = 150
+	if err := s.stores.Payments.UpdateMode(mode); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, s.do(http.MethodPost, "/payments", asha, CreatePaymentRequest{PurchaseID: purchase.ID}), http.StatusBadRequest)
+}
+
+func TestPurchaseStatus(t *testing.T) {
+	s := newTestServer(t)
+	ashaID, asha := s.user("asha@example.com", utils.RoleCustomer)
+	_, staff := s.user("staff@example.com", utils.RoleStaff)
+	addressID, paymentID := s.checkoutSetup(ashaID)
+	weight := s.product(5, 100).Weights[0].ID
+
+	expectStatus(t, s.do(http.MethodPost, "/cart", asha, AddToCartRequest{ProductWeightID: weight, Quantity: 2}), http.StatusOK)
+	purchase := s.checkout(asha, addressID, paymentID, http.StatusOK)
+	path := fmt.Sprintf("/admin/purchases/%d/status", purchase.ID)
+
+	// Customers cannot move their own orders along
+	expectStatus(t, s.do(http.MethodPut, path, asha, UpdatePurchaseStatusRequest{Status: models.PurchaseStatusPreparing}), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodPut, path, staff, UpdatePurchaseStatusRequest{Status: "lost"}), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodPut, path, staff, UpdatePurchaseStatusRequest{Status: models.PurchaseStatusDelivered}), http.StatusConflict)
+	expectStatus(t, s.do(http.MethodPut, path, staff, UpdatePurchaseStatusRequest{Status: models.PurchaseStatusConfirmed}), http.StatusOK)
+	expectStatus(t, s.do(http.MethodPut, path, staff, UpdatePurchaseStatusRequest{Status: models.PurchaseStatusPreparing}), http.StatusOK)
+
+	// Cancelling puts the items back in stock as a return
+	cancelPath := fmt.Sprintf("/purchase/%d/cancel", purchase.ID)
+	expectStatus(t, s.do(http.MethodPost, cancelPath, asha, CancelPurchaseRequest{}), http.StatusBadRequest)
+	w := s.do(http.MethodPost, cancelPath, asha, CancelPurchaseRequest{Reason: "Ordered by mistake"})
+	expectStatus(t, w, http.StatusOK)
+	var cancelled CancelPurchaseResponse
+	decode(t, w, &cancelled)
+	if cancelled.Purchase.Status != models.PurchaseStatusCancelled || len(cancelled.Refunds) != 0 {
+		t.Errorf("cancellation = %+v", cancelled)
+	}
+	if stock := s.stock(weight); stock != 5 {
+		t.Errorf("stock after cancelling = %d, want 5", stock)
+	}
+	movements, err := s.stores.Inventory.Movements(weight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := movements[len(movements)-1]
+	if last.MovementType != models.StockMovementReturn || last.Quantity != 2 || last.PurchaseID != purchase.ID {
+		t.Errorf("last movement = %+v, want the return of the purchase", last)
+	}
+
+	// A cancelled purchase is not cancelled, or restocked, twice
+	expectStatus(t, s.do(http.MethodPost, cancelPath, asha, CancelPurchaseRequest{Reason: "Again"}), http.StatusConflict)
+	if stock := s.stock(weight); stock != 5 {
+		t.Errorf("stock after cancelling twice = %d, want 5", stock)
+	}
+
+	w = s.do(http.MethodGet, fmt.Sprintf("/admin/purchases/%d/history", purchase.ID), staff, nil)
+	expectStatus(t, w, http.StatusOK)
+	var history []*models.PurchaseStatusChange
+	decode(t, w, &history)
+	if len(history) != 4 || history[len(history)-1].ToStatus != models.PurchaseStatusCancelled || history[len(history)-1].Note != "Ordered by mistake" {
+		t.Errorf("history = %+v", history)
+	}
+}
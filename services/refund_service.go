@@ -0,0 +1,347 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/payments"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// RefundService handles the refund related operations
+type RefundService struct {
+	Refunds  store.RefundStore
+	Orders   store.OrderStore
+	Payments store.PaymentStore
+	// Providers are the enabled payment providers by name
+	Providers map[string]payments.Provider
+}
+
+// NewRefundService creates a new instance of RefundService
+func NewRefundService(stores *store.Stores, providers map[string]payments.Provider) *RefundService {
+	return &RefundService{
+		Refunds:   stores.Refunds,
+		Orders:    stores.Orders,
+		Payments:  stores.Payments,
+		Providers: providers,
+	}
+}
+
+// RegisterRoutes registers the refund routes
+func (rs *RefundService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/purchase/{id}/refunds", utils.AuthenticateFunc(rs.GetPurchaseRefunds)).Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/purchases/{id}/refunds", utils.RequireRoleFunc(rs.CreateRefund, utils.RoleAdmin)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/refunds/{id}/process", utils.RequireRoleFunc(rs.ProcessRefund, utils.RoleAdmin)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/refunds/{id}/reconcile", utils.RequireRoleFunc(rs.ReconcileRefund, utils.RoleAdmin)).Methods(http.MethodPost)
+}
+
+// GetPurchaseRefunds lists the refunds of a purchase to its buyer or an admin
+// @Summary List the refunds of a purchase
+// @Tags Refunds
+// @Produce json
+// @Param id path int true "Purchase ID"
+// @Success 200 {array} models.Refund "Refunds of the purchase"
+// @Failure 400 {object} ErrorResponse "Invalid purchase ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Purchase not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch refunds"
+// @Router /purchase/{id}/refunds [get]
+func (rs *RefundService) GetPurchaseRefunds(w http.ResponseWriter, r *http.Request) {
+	purchaseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase ID", http.StatusBadRequest)
+		return
+	}
+
+	purchase, err := rs.Orders.Get(purchaseID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Purchase not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch refunds", http.StatusInternalServerError)
+		return
+	}
+	if !utils.AuthorizeUser(w, r, purchase.UserID) {
+		return
+	}
+
+	refunds, err := rs.Refunds.ListByPurchase(purchaseID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch refunds", http.StatusInternalServerError)
+		return
+	}
+	if refunds == nil {
+		refunds = []*models.Refund{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refunds)
+}
+
+// CreateRefundRequest represents the request body for refunding a purchase. Give
+// either the items to refund or an amount; with neither, the rest of the payment is refunded.
+type CreateRefundRequest struct {
+	Amount float64             `json:"amount"`
+	Items  []RefundItemRequest `json:"items"`
+	Reason string              `json:"reason"`
+}
+
+// RefundItemRequest is a quantity of a purchase item to refund
+type RefundItemRequest struct {
+	PurchaseItemID int `json:"purchase_item_id"`
+	Quantity       int `json:"quantity"`
+}
+
+// CreateRefund refunds a purchase in full or in part and sends the refund to the
+// payment provider. A refund the provider fails stays pending and can be processed again.
+// @Summary Refund a purchase
+// @Tags Refunds
+// @Accept json
+// @Produce json
+// @Param id path int true "Purchase ID"
+// @Param request body CreateRefundRequest true "What to refund"
+// @Param Idempotency-Key header string false "Replays the first response when the request is retried"
+// @Success 200 {object} models.Refund "Refund processed"
+// @Failure 400 {object} ErrorResponse "Invalid refund"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Purchase not found"
+// @Failure 409 {object} ErrorResponse "Refund exceeds the amount left to refund, or would refund an undelivered purchase in full"
+// @Failure 500 {object} ErrorResponse "Failed to refund purchase"
+// @Failure 502 {object} ErrorResponse "Payment provider failed"
+// @Router /admin/purchases/{id}/refunds [post]
+func (rs *RefundService) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	purchaseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase ID", http.StatusBadRequest)
+		return
+	}
+
+	var request CreateRefundRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		http.Error(w, "A reason for the refund is required", http.StatusBadRequest)
+		return
+	}
+	if request.Amount < 0 || (request.Amount > 0 && len(request.Items) > 0) {
+		http.Error(w, "Give either a positive amount or items to refund", http.StatusBadRequest)
+		return
+	}
+
+	refund := &models.Refund{
+		PurchaseID: purchaseID,
+		Amount:     request.Amount,
+		Reason:     request.Reason,
+	}
+	for _, item := range request.Items {
+		if item.Quantity <= 0 {
+			http.Error(w, "Quantity must be positive", http.StatusBadRequest)
+			return
+		}
+		refund.Items = append(refund.Items, &models.RefundItem{
+			PurchaseItemID: item.PurchaseItemID,
+			Quantity:       item.Quantity,
+		})
+	}
+
+	err = rs.Refunds.Create(refund)
+	if err == store.ErrNotFound {
+		http.Error(w, "Purchase not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrInvalidItem) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, store.ErrOverRefund) {
+		http.Error(w, "Refund exceeds the amount left to refund", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, store.ErrFullRefund) {
+		http.Error(w, "Only delivered or cancelled purchases are refunded in full; cancel the purchase instead", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to refund purchase", http.StatusInternalServerError)
+		return
+	}
+
+	rs.process(w, refund)
+}
+
+// ProcessRefund sends a pending refund, such as one owed for a cancelled purchase,
+// to its payment provider
+// @Summary Process a pending refund
+// @Tags Refunds
+// @Produce json
+// @Param id path int true "Refund ID"
+// @Success 200 {object} models.Refund "Refund processed"
+// @Failure 400 {object} ErrorResponse "Invalid refund ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Refund not found"
+// @Failure 409 {object} ErrorResponse "Refund is not pending"
+// @Failure 500 {object} ErrorResponse "Failed to process refund"
+// @Failure 502 {object} ErrorResponse "Payment provider failed"
+// @Router /admin/refunds/{id}/process [post]
+func (rs *RefundService) ProcessRefund(w http.ResponseWriter, r *http.Request) {
+	refundID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid refund ID", http.StatusBadRequest)
+		return
+	}
+
+	refund, err := rs.Refunds.Get(refundID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Refund not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to process refund", http.StatusInternalServerError)
+		return
+	}
+
+	rs.process(w, refund)
+}
+
+// process sends a pending refund to the provider of its payment and writes the outcome
+func (rs *RefundService) process(w http.ResponseWriter, refund *models.Refund) {
+	// Claiming the refund first keeps it from being sent twice
+	claimed, err := rs.Refunds.StartProcessing(refund.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to process refund", http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		http.Error(w, "Refund is not pending", http.StatusConflict)
+		return
+	}
+
+	providerRefundID, err := rs.sendRefund(refund)
+	if err != nil {
+		log.Println("Failed to process refund", refund.ID, err)
+		if err := rs.Refunds.Release(refund.ID); err != nil {
+			log.Println(err)
+		}
+		http.Error(w, "Payment provider failed", http.StatusBadGateway)
+		return
+	}
+
+	err = rs.Refunds.Complete(refund.ID, providerRefundID)
+	if err != nil {
+		// The money was returned, so the refund stays processing until it is reconciled
+		log.Println("Refund", refund.ID, "was sent as", providerRefundID, "but could not be recorded:", err)
+		http.Error(w, "Refund was sent but could not be recorded; reconcile it with the provider's refund ID", http.StatusInternalServerError)
+		return
+	}
+	refund.Status = models.RefundStatusProcessed
+	refund.ProviderRefundID = providerRefundID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refund)
+}
+
+// ReconcileRefundRequest represents the request body for settling a refund stuck in processing
+type ReconcileRefundRequest struct {
+	// ProviderRefundID is the provider's ID of the refund when the provider shows it was
+	// sent; leave it empty when it was never sent
+	ProviderRefundID string `json:"provider_refund_id"`
+}
+
+// ReconcileRefund settles a refund left processing when the outcome of sending it was not
+// recorded. With the provider's refund ID it is recorded as processed; without one it goes
+// back to pending so that it can be processed again.
+// @Summary Reconcile a refund stuck in processing
+// @Tags Refunds
+// @Accept json
+// @Produce json
+// @Param id path int true "Refund ID"
+// @Param request body ReconcileRefundRequest true "Provider's refund ID, if it was sent"
+// @Success 200 {object} models.Refund "Refund reconciled"
+// @Failure 400 {object} ErrorResponse "Invalid refund ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Refund not found"
+// @Failure 409 {object} ErrorResponse "Refund is not being processed"
+// @Failure 500 {object} ErrorResponse "Failed to reconcile refund"
+// @Router /admin/refunds/{id}/reconcile [post]
+func (rs *RefundService) ReconcileRefund(w http.ResponseWriter, r *http.Request) {
+	refundID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid refund ID", http.StatusBadRequest)
+		return
+	}
+
+	var request ReconcileRefundRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	_, err = rs.Refunds.Get(refundID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Refund not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to reconcile refund", http.StatusInternalServerError)
+		return
+	}
+
+	providerRefundID := strings.TrimSpace(request.ProviderRefundID)
+	if providerRefundID != "" {
+		err = rs.Refunds.Complete(refundID, providerRefundID)
+	} else {
+		err = rs.Refunds.Release(refundID)
+	}
+	if err == store.ErrNotFound {
+		http.Error(w, "Refund is not being processed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to reconcile refund", http.StatusInternalServerError)
+		return
+	}
+
+	refund, err := rs.Refunds.Get(refundID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to reconcile refund", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refund)
+}
+
+// sendRefund asks the provider of a refund's payment to return the money
+func (rs *RefundService) sendRefund(refund *models.Refund) (string, error) {
+	payment, err := rs.Payments.Get(refund.PaymentID)
+	if err != nil {
+		return "", err
+	}
+	provider, ok := rs.Providers[payment.Provider]
+	if !ok {
+		return "", fmt.Errorf("payment provider %q is not enabled", payment.Provider)
+	}
+	return provider.Refund(payment.ProviderPaymentID, refund.Amount)
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/payments"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// unrecordedRefunds fails to record the next refunds that complete
+type unrecordedRefunds struct {
+	store.RefundStore
+	failures int
+}
+
+func (u *unrecordedRefunds) Complete(id int, providerRefundID string) error {
+	if u.failures > 0 {
+		u.failures--
+		return errors.New("database is unavailable")
+	}
+	return u.RefundStore.Complete(id, providerRefundID)
+}
+
+// paidPurchase places an order of quantity units of a new product for userID and captures its payment
+func (s *testServer) paidPurchase(userID, quantity int) *models.Purchase {
+	s.t.Helper()
+	product := s.product(10, 100)
+	addressID, _ := s.checkoutSetup(userID)
+	mode := &models.PaymentMode{Mode: "Card", Provider: payments.ProviderFake, IsActive: true}
+	if err := s.stores.Payments.CreateMode(mode); err != nil {
+		s.t.Fatal(err)
+	}
+
+	now := time.Now()
+	purchase := &models.Purchase{
+		UserID:    userID,
+		AddressID: addressID,
+		PaymentID: mode.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Items:     []*models.PurchaseItem{{ProductID: product.ID, ProductWeightID: product.Weights[0].ID, Quantity: quantity}},
+	}
+	if err := s.stores.Orders.Create(purchase); err != nil {
+		s.t.Fatal(err)
+	}
+	payment := &models.Payment{
+		PurchaseID:      purchase.ID,
+		Provider:        payments.ProviderFake,
+		ProviderOrderID: fmt.Sprintf("order_%d", purchase.ID),
+		Amount:          purchase.TotalPrice,
+		Currency:        "INR",
+		Status:          models.PaymentStatusCreated,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if _, err := s.stores.Payments.Create(payment); err != nil {
+		s.t.Fatal(err)
+	}
+	if _, err := s.stores.Payments.Capture(payment.ID, fmt.Sprintf("pay_%d", payment.ID)); err != nil {
+		s.t.Fatal(err)
+	}
+	return purchase
+}
+
+func TestReconcileRefund(t *testing.T) {
+	s := newTestServer(t)
+	userID, _ := s.user("asha@example.com", utils.RoleCustomer)
+	_, admin := s.user("admin@example.com", utils.RoleAdmin)
+	purchase := s.paidPurchase(userID, 2)
+
+	// Serve the refund routes with a store that loses the outcome of the first refund sent
+	refunds := &unrecordedRefunds{RefundStore: s.stores.Refunds, failures: 1}
+	service := NewRefundService(s.stores, s.providers)
+	service.Refunds = refunds
+	s.router = mux.NewRouter()
+	service.RegisterRoutes(s.router)
+
+	w := s.do(http.MethodPost, fmt.Sprintf("/admin/purchases/%d/refunds", purchase.ID), admin, CreateRefundRequest{Amount: 50, Reason: "Late"})
+	expectStatus(t, w, http.StatusInternalServerError)
+	stuck, err := s.stores.Refunds.ListByPurchase(purchase.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stuck) != 1 || stuck[0].Status != models.RefundStatusProcessing {
+		t.Fatalf("refunds = %+v, want one left processing", stuck)
+	}
+	refundID := stuck[0].ID
+
+	// It is not sent again, but can be recorded with the provider's refund ID
+	expectStatus(t, s.do(http.MethodPost, fmt.Sprintf("/admin/refunds/%d/process", refundID), admin, nil), http.StatusConflict)
+	path := fmt.Sprintf("/admin/refunds/%d/reconcile", refundID)
+	w = s.do(http.MethodPost, path, admin, ReconcileRefundRequest{ProviderRefundID: "rfnd_sent"})
+	expectStatus(t, w, http.StatusOK)
+	var refund models.Refund
+	decode(t, w, &refund)
+	if refund.Status != models.RefundStatusProcessed || refund.ProviderRefundID != "rfnd_sent" {
+		t.Errorf("reconciled refund = %+v", refund)
+	}
+	expectStatus(t, s.do(http.MethodPost, path, admin, ReconcileRefundRequest{}), http.StatusConflict)
+
+	// A refund that was never sent goes back to pending and is processed again
+	other := &models.Refund{PurchaseID: purchase.ID, Amount: 20, Reason: "Late"}
+	if err := s.stores.Refunds.Create(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.stores.Refunds.StartProcessing(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, s.do(http.MethodPost, fmt.Sprintf("/admin/refunds/%d/reconcile", other.ID), admin, ReconcileRefundRequest{}), http.StatusOK)
+	w = s.do(http.MethodPost, fmt.Sprintf("/admin/refunds/%d/process", other.ID), admin, nil)
+	expectStatus(t, w, http.StatusOK)
+	refund = models.Refund{}
+	decode(t, w, &refund)
+	if refund.Status != models.RefundStatusProcessed || refund.ProviderRefundID == "" {
+		t.Errorf("processed refund = %+v", refund)
+	}
+
+	expectStatus(t, s.do(http.MethodPost, "/admin/refunds/999/reconcile", admin, ReconcileRefundRequest{}), http.StatusNotFound)
+}
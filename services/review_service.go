@@ -0,0 +1,402 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// maxReviewLength is the longest review text accepted, in characters
+const maxReviewLength = 2000
+
+// ReviewService handles the product review related operations
+type ReviewService struct {
+	Reviews  store.ReviewStore
+	Products store.ProductStore
+}
+
+// NewReviewService creates a new instance of ReviewService
+func NewReviewService(stores *store.Stores) *ReviewService {
+	return &ReviewService{
+		Reviews:  stores.Reviews,
+		Products: stores.Products,
+	}
+}
+
+// RegisterRoutes registers the review routes
+func (rs *ReviewService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/products/{id}/reviews", rs.ListProductReviews).Methods(http.MethodGet)
+	r.HandleFunc("/products/{id}/reviews", utils.AuthenticateFunc(rs.CreateReview)).Methods(http.MethodPost)
+	r.HandleFunc("/reviews/{id}", utils.AuthenticateFunc(rs.UpdateReview)).Methods(http.MethodPut)
+	r.HandleFunc("/reviews/{id}", utils.AuthenticateFunc(rs.DeleteReview)).Methods(http.MethodDelete)
+
+	r.HandleFunc("/admin/reviews", utils.RequireRoleFunc(rs.ListReviews, utils.RoleAdmin)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/reviews/{id}/status", utils.RequireRoleFunc(rs.ModerateReview, utils.RoleAdmin)).Methods(http.MethodPut)
+}
+
+// ReviewRequest represents the request body for posting or editing a review
+type ReviewRequest struct {
+	// Rating is from 1 to 5 stars
+	Rating     int    `json:"rating"`
+	ReviewText string `json:"review_text"`
+}
+
+// validate checks the request and returns the problem with it, if any
+func (request *ReviewRequest) validate() string {
+	request.ReviewText = strings.TrimSpace(request.ReviewText)
+	if request.Rating < 1 || request.Rating > 5 {
+		return "Rating must be from 1 to 5"
+	}
+	if len([]rune(request.ReviewText)) > maxReviewLength {
+		return "Review text is too long"
+	}
+	return ""
+}
+
+// ListProductReviews lists the published reviews of a product, newest first
+// @Summary List the reviews of a product
+// @Tags Reviews
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {array} models.Review "Published reviews of the product"
+// @Failure 400 {object} ErrorResponse "Invalid product ID"
+// @Failure 500 {object} ErrorResponse "Failed to fetch reviews"
+// @Router /products/{id}/reviews [get]
+func (rs *ReviewService) ListProductReviews(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	reviews, err := rs.Reviews.ListByProduct(productID, models.ReviewStatusPublished)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+	if reviews == nil {
+		reviews = []*models.Review{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// CreateReview posts the caller's review of a product they received. Each customer
+// reviews a product once and edits that review afterwards.
+// @Summary Review a product
+// @Tags Reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param request body ReviewRequest true "Review"
+// @Success 200 {object} models.Review "Review posted"
+// @Failure 400 {object} ErrorResponse "Invalid review"
+// @Failure 403 {object} ErrorResponse "Only customers who received the product can review it"
+// @Failure 404 {object} ErrorResponse "Product not found"
+// @Failure 409 {object} ErrorResponse "Product already reviewed"
+// @Failure 500 {object} ErrorResponse "Failed to save review"
+// @Router /products/{id}/reviews [post]
+func (rs *ReviewService) CreateReview(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var request ReviewRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if problem := request.validate(); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := utils.ActingUserID(w, r, 0)
+	if !ok {
+		return
+	}
+
+	_, err = rs.Products.Get(productID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save review", http.StatusInternalServerError)
+		return
+	}
+
+	purchased, err := rs.Reviews.HasPurchased(userID, productID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save review", http.StatusInternalServerError)
+		return
+	}
+	if !purchased {
+		http.Error(w, "Only customers who received the product can review it", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	review := &models.Review{
+		ProductID:  productID,
+		UserID:     userID,
+		Rating:     request.Rating,
+		ReviewText: request.ReviewText,
+		Status:     models.ReviewStatusPublished,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	created, err := rs.Reviews.Create(review)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save review", http.StatusInternalServerError)
+		return
+	}
+	if !created {
+		http.Error(w, "Product already reviewed; edit the existing review instead", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// UpdateReview changes the rating and text of the caller's review. A review an admin
+// hid stays hidden.
+// @Summary Edit a review
+// @Tags Reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Review ID"
+// @Param request body ReviewRequest true "Review"
+// @Success 200 {object} models.Review "Review updated"
+// @Failure 400 {object} ErrorResponse "Invalid review"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Review not found"
+// @Failure 500 {object} ErrorResponse "Failed to save review"
+// @Router /reviews/{id} [put]
+func (rs *ReviewService) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	var request ReviewRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if problem := request.validate(); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	review, err := rs.Reviews.Get(reviewID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save review", http.StatusInternalServerError)
+		return
+	}
+
+	// Reviews are the customer's own words, so only their author edits them
+	principal, _ := utils.PrincipalFromRequest(r)
+	if principal.UserID != review.UserID {
+		utils.SendErrorResponse(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	review.Rating = request.Rating
+	review.ReviewText = request.ReviewText
+	review.UpdatedAt = time.Now()
+	err = rs.Reviews.Update(review)
+	if err == store.ErrNotFound {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save review", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// DeleteReview removes a review, by its author or an admin
+// @Summary Delete a review
+// @Tags Reviews
+// @Param id path int true "Review ID"
+// @Success 200 {string} string "Review deleted successfully"
+// @Failure 400 {object} ErrorResponse "Invalid review ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Review not found"
+// @Failure 500 {object} ErrorResponse "Failed to delete review"
+// @Router /reviews/{id} [delete]
+func (rs *ReviewService) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	review, err := rs.Reviews.Get(reviewID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to delete review", http.StatusInternalServerError)
+		return
+	}
+	if !utils.AuthorizeUser(w, r, review.UserID) {
+		return
+	}
+
+	err = rs.Reviews.Delete(reviewID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to delete review", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Review deleted successfully"))
+}
+
+// ListReviews lists the reviews of every product for moderation, newest first
+// @Summary List reviews for moderation
+// @Tags Reviews
+// @Produce json
+// @Param status query string false "Only reviews with this status: published or hidden"
+// @Param product_id query int false "Only reviews of this product"
+// @Success 200 {array} models.Review "Reviews"
+// @Failure 400 {object} ErrorResponse "Invalid status or product ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch reviews"
+// @Router /admin/reviews [get]
+func (rs *ReviewService) ListReviews(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !models.IsValidReviewStatus(status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	var reviews []*models.Review
+	var err error
+	if productParam := r.URL.Query().Get("product_id"); productParam != "" {
+		productID, convErr := strconv.Atoi(productParam)
+		if convErr != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+		reviews, err = rs.Reviews.ListByProduct(productID, status)
+	} else {
+		reviews, err = rs.Reviews.List(status)
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+	if reviews == nil {
+		reviews = []*models.Review{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// ModerateReviewRequest represents the request body for publishing or hiding a review
+type ModerateReviewRequest struct {
+	// Status is "published" or "hidden"
+	Status string `json:"status"`
+	// Note records why the review was hidden
+	Note string `json:"note"`
+}
+
+// ModerateReview publishes or hides a review. Hidden reviews are left out of the
+// product's reviews and rating.
+// @Summary Moderate a review
+// @Tags Reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Review ID"
+// @Param request body ModerateReviewRequest true "New status"
+// @Success 200 {object} models.Review "Review moderated"
+// @Failure 400 {object} ErrorResponse "Invalid status"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Review not found"
+// @Failure 500 {object} ErrorResponse "Failed to moderate review"
+// @Router /admin/reviews/{id}/status [put]
+func (rs *ReviewService) ModerateReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	var request ModerateReviewRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || !models.IsValidReviewStatus(request.Status) {
+		http.Error(w, "Status must be published or hidden", http.StatusBadRequest)
+		return
+	}
+
+	review, err := rs.Reviews.Get(reviewID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to moderate review", http.StatusInternalServerError)
+		return
+	}
+
+	review.Status = request.Status
+	review.ModerationNote = strings.TrimSpace(request.Note)
+	if review.Status == models.ReviewStatusPublished {
+		review.ModerationNote = ""
+	}
+	review.UpdatedAt = time.Now()
+	err = rs.Reviews.Update(review)
+	if err == store.ErrNotFound {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to moderate review", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
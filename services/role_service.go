@@ -0,0 +1,91 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// RoleRequest represents the request body for granting a role to a user
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// GrantRole assigns a role to a user. The first admin is made with the
+// "grant-admin <email>" command instead.
+// @Summary Grant a role to a user
+// @Tags Admin
+// @Accept json
+// @Param id path string true "User ID"
+// @Param request body RoleRequest true "Role to grant (customer, staff or admin)"
+// @Success 200 {string} string "Role granted successfully"
+// @Failure 400 {object} ErrorResponse "Invalid role"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Failed to update role"
+// @Router /admin/users/{id}/role [put]
+func (us *UserService) GrantRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var request RoleRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || !utils.IsValidRole(request.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	us.setRole(w, r, userID, request.Role, "Role granted successfully")
+}
+
+// RevokeRole resets a user back to the customer role
+// @Summary Revoke a user's role
+// @Tags Admin
+// @Param id path string true "User ID"
+// @Success 200 {string} string "Role revoked successfully"
+// @Failure 400 {object} ErrorResponse "Invalid user ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Failed to update role"
+// @Router /admin/users/{id}/role [delete]
+func (us *UserService) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	us.setRole(w, r, userID, utils.RoleCustomer, "Role revoked successfully")
+}
+
+// setRole updates the role of a user and writes the response
+func (us *UserService) setRole(w http.ResponseWriter, r *http.Request, userID int, role, message string) {
+	// Admins cannot demote themselves, so the shop is never left without an admin by accident
+	principal, _ := utils.PrincipalFromRequest(r)
+	if principal != nil && principal.UserID == userID && role != utils.RoleAdmin {
+		http.Error(w, "Admins cannot change their own role", http.StatusBadRequest)
+		return
+	}
+
+	err := us.Users.SetRole(userID, role)
+	if err == store.ErrNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(message))
+}
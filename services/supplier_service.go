@@ -0,0 +1,247 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// SupplierService handles the management of the suppliers weight variants are reordered from
+type SupplierService struct {
+	Suppliers store.SupplierStore
+}
+
+// NewSupplierService creates a new instance of SupplierService
+func NewSupplierService(stores *store.Stores) *SupplierService {
+	return &SupplierService{
+		Suppliers: stores.Suppliers,
+	}
+}
+
+// RegisterRoutes registers the supplier routes
+func (ss *SupplierService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/admin/suppliers", utils.RequireRoleFunc(ss.ListSuppliers, utils.RoleStaff)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/suppliers", utils.RequireRoleFunc(ss.CreateSupplier, utils.RoleStaff)).Methods(http.MethodPost)
+	r.HandleFunc("/admin/suppliers/{id}", utils.RequireRoleFunc(ss.GetSupplier, utils.RoleStaff)).Methods(http.MethodGet)
+	r.HandleFunc("/admin/suppliers/{id}", utils.RequireRoleFunc(ss.UpdateSupplier, utils.RoleStaff)).Methods(http.MethodPut)
+	r.HandleFunc("/admin/suppliers/{id}", utils.RequireRoleFunc(ss.DeleteSupplier, utils.RoleStaff)).Methods(http.MethodDelete)
+}
+
+// SupplierRequest represents the request body for creating or changing a supplier
+type SupplierRequest struct {
+	Name          string `json:"name"`
+	ContactNumber string `json:"contact_number"`
+	Email         string `json:"email"`
+}
+
+// supplier validates the request and returns the supplier it describes
+func (ss *SupplierService) supplier(request *SupplierRequest) (*models.Supplier, string) {
+	supplier := &models.Supplier{
+		Name:          strings.TrimSpace(request.Name),
+		ContactNumber: strings.TrimSpace(request.ContactNumber),
+		Email:         strings.TrimSpace(request.Email),
+	}
+	if supplier.Name == "" {
+		return nil, "Supplier name is required"
+	}
+	return supplier, ""
+}
+
+// ListSuppliers lists every supplier by name
+// @Summary List suppliers
+// @Tags Inventory
+// @Produce json
+// @Success 200 {array} models.Supplier "Suppliers"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to fetch suppliers"
+// @Router /admin/suppliers [get]
+func (ss *SupplierService) ListSuppliers(w http.ResponseWriter, r *http.Request) {
+	suppliers, err := ss.Suppliers.List()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch suppliers", http.StatusInternalServerError)
+		return
+	}
+	if suppliers == nil {
+		suppliers = []*models.Supplier{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suppliers)
+}
+
+// GetSupplier retrieves a supplier
+// @Summary Get a supplier
+// @Tags Inventory
+// @Produce json
+// @Param id path int true "Supplier ID"
+// @Success 200 {object} models.Supplier "Supplier"
+// @Failure 400 {object} ErrorResponse "Invalid supplier ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Supplier not found"
+// @Failure 500 {object} ErrorResponse "Failed to fetch supplier"
+// @Router /admin/suppliers/{id} [get]
+func (ss *SupplierService) GetSupplier(w http.ResponseWriter, r *http.Request) {
+	supplierID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	supplier, err := ss.Suppliers.Get(supplierID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to fetch supplier", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// CreateSupplier adds a supplier
+// @Summary Create a supplier
+// @Tags Inventory
+// @Accept json
+// @Produce json
+// @Param request body SupplierRequest true "Supplier"
+// @Success 200 {object} models.Supplier "Supplier created"
+// @Failure 400 {object} ErrorResponse "Invalid supplier"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to save supplier"
+// @Router /admin/suppliers [post]
+func (ss *SupplierService) CreateSupplier(w http.ResponseWriter, r *http.Request) {
+	var request SupplierRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	supplier, problem := ss.supplier(&request)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	supplier.CreatedAt = time.Now()
+	supplier.UpdatedAt = supplier.CreatedAt
+	err = ss.Suppliers.Create(supplier)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save supplier", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// UpdateSupplier replaces the details of a supplier
+// @Summary Update a supplier
+// @Tags Inventory
+// @Accept json
+// @Produce json
+// @Param id path int true "Supplier ID"
+// @Param request body SupplierRequest true "Supplier"
+// @Success 200 {object} models.Supplier "Supplier updated"
+// @Failure 400 {object} ErrorResponse "Invalid supplier"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Supplier not found"
+// @Failure 500 {object} ErrorResponse "Failed to save supplier"
+// @Router /admin/suppliers/{id} [put]
+func (ss *SupplierService) UpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	supplierID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	var request SupplierRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	supplier, problem := ss.supplier(&request)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	existing, err := ss.Suppliers.Get(supplierID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save supplier", http.StatusInternalServerError)
+		return
+	}
+	supplier.SupplierID = existing.SupplierID
+	supplier.CreatedAt = existing.CreatedAt
+	supplier.UpdatedAt = time.Now()
+
+	err = ss.Suppliers.Update(supplier)
+	if err == store.ErrNotFound {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to save supplier", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// DeleteSupplier removes a supplier no weight variant is reordered from
+// @Summary Delete a supplier
+// @Tags Inventory
+// @Param id path int true "Supplier ID"
+// @Success 200 {string} string "Supplier deleted successfully"
+// @Failure 400 {object} ErrorResponse "Invalid supplier ID"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Supplier not found"
+// @Failure 409 {object} ErrorResponse "Supplier is in use"
+// @Failure 500 {object} ErrorResponse "Failed to delete supplier"
+// @Router /admin/suppliers/{id} [delete]
+func (ss *SupplierService) DeleteSupplier(w http.ResponseWriter, r *http.Request) {
+	supplierID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	err = ss.Suppliers.Delete(supplierID)
+	if err == store.ErrNotFound {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+	if err == store.ErrSupplierInUse {
+		http.Error(w, "Supplier is in use; move its variants to another supplier first", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to delete supplier", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Supplier deleted successfully"))
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+// refreshTokenTTL is how long a refresh token can be used before the user has to log in again
+var refreshTokenTTL = 30 * 24 * time.Hour
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// RefreshTokenRequest represents the request body for refreshing tokens and logging out
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh token pair
+// @Summary Refresh access token
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param request body RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} LoginResponse "Tokens refreshed successfully"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 401 {object} ErrorResponse "Invalid refresh token"
+// @Failure 500 {object} ErrorResponse "Failed to refresh token"
+// @Router /token/refresh [post]
+func (us *UserService) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var request RefreshTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := us.rotateRefreshToken(request.RefreshToken)
+	if err == errInvalidRefreshToken {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Logout revokes the refresh token and every token rotated from the same login
+// @Summary User logout
+// @Tags Users
+// @Accept json
+// @Param request body RefreshTokenRequest true "Refresh token"
+// @Success 200 {string} string "Logged out successfully"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 500 {object} ErrorResponse "Failed to log out"
+// @Router /logout [post]
+func (us *UserService) Logout(w http.ResponseWriter, r *http.Request) {
+	var request RefreshTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := us.RefreshTokens.Get(hashRefreshToken(request.RefreshToken))
+	if err != nil && err != store.ErrNotFound {
+		log.Println(err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	// Unknown tokens are treated as already logged out
+	if err == nil {
+		err = us.RefreshTokens.RevokeFamily(token.FamilyID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Logged out successfully"))
+}
+
+// saveRefreshToken generates a new refresh token in the given family and stores its hash
+func (us *UserService) saveRefreshToken(userID int, familyID string) (string, time.Time, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(refreshTokenTTL)
+	err = us.RefreshTokens.Create(&models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashRefreshToken(token),
+		FamilyID:  familyID,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// rotateRefreshToken marks the presented refresh token as used and issues its successor.
+// Presenting a token that was already rotated revokes the whole family, since it means
+// the token has leaked.
+func (us *UserService) rotateRefreshToken(token string) (*LoginResponse, error) {
+	stored, err := us.RefreshTokens.Get(hashRefreshToken(token))
+	if err == store.ErrNotFound {
+		return nil, errInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+	if stored.RotatedAt != nil {
+		log.Printf("Refresh token reuse detected for user %d, revoking token family", stored.UserID)
+		if err := us.RefreshTokens.RevokeFamily(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+
+	// Only one caller can rotate a token; a concurrent second attempt counts as reuse
+	rotated, err := us.RefreshTokens.MarkRotated(stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		if err := us.RefreshTokens.RevokeFamily(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+
+	return us.issueTokens(stored.UserID, stored.FamilyID)
+}
+
+// randomToken returns a URL-safe random string suitable for opaque tokens
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken hashes a refresh token for storage; tokens are never stored in clear
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
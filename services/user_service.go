@@ -1,36 +1,59 @@
 package services
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 
-	"github.com/gklps/mittai-backend/db"
 	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/notifications"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/utils"
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // UserService represents a service for user-related operations
 type UserService struct {
-	DB *db.Repository
+	Users         store.UserStore
+	OTPs          store.OTPStore
+	RefreshTokens store.RefreshTokenStore
+	Email         notifications.EmailSender
+	SMS           notifications.SMSSender
+	OTP           OTPPolicy
+	// BaseURL is the public URL of the API used in links sent to users
+	BaseURL string
 }
 
-func NewUserService(db *db.Repository) *UserService {
+func NewUserService(stores *store.Stores, email notifications.EmailSender, sms notifications.SMSSender) *UserService {
 	return &UserService{
-		DB: db,
+		Users:         stores.Users,
+		OTPs:          stores.OTPs,
+		RefreshTokens: stores.RefreshTokens,
+		Email:         email,
+		SMS:           sms,
+		OTP:           DefaultOTPPolicy,
 	}
 }
 
 // RegisterRoutes registers the user service routes
 func (us *UserService) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/users", us.CreateUser).Methods("POST")
-	r.HandleFunc("/users/{id}", us.GetUserByID).Methods("GET")
-	r.HandleFunc("/users/{id}", us.UpdateUser).Methods("PUT")
-	r.HandleFunc("/users/{id}", us.DeleteUser).Methods("DELETE")
+	r.HandleFunc("/users/{id}", utils.AuthenticateFunc(us.GetUserByID)).Methods("GET")
+	r.HandleFunc("/users/{id}", utils.AuthenticateFunc(us.UpdateUser)).Methods("PUT")
+	r.HandleFunc("/users/{id}", utils.AuthenticateFunc(us.DeleteUser)).Methods("DELETE")
 	r.HandleFunc("/login", us.Login).Methods("POST") // Add this line for the login route
+	r.HandleFunc("/login/otp/request", us.RequestLoginOTP).Methods("POST")
+	r.HandleFunc("/login/otp/verify", us.VerifyLoginOTP).Methods("POST")
+	r.HandleFunc("/token/refresh", us.RefreshToken).Methods("POST")
+	r.HandleFunc("/logout", us.Logout).Methods("POST")
+	r.HandleFunc("/password/forgot", us.ForgotPassword).Methods("POST")
+	r.HandleFunc("/password/reset", us.ResetPassword).Methods("POST")
 	r.HandleFunc("/verify-otp/{id}", us.VerifyOTP).Methods("POST")
+	r.HandleFunc("/resend-otp/{id}", us.ResendOTP).Methods("POST")
+	r.HandleFunc("/admin/users/{id}/role", utils.RequireRoleFunc(us.GrantRole, utils.RoleAdmin)).Methods("PUT")
+	r.HandleFunc("/admin/users/{id}/role", utils.RequireRoleFunc(us.RevokeRole, utils.RoleAdmin)).Methods("DELETE")
 }
 
 // CreateUser creates a new user
@@ -53,8 +76,19 @@ func (us *UserService) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
 	// Check if the contact number is unique
-	if us.isContactNumberExists(user.ContactNumber) {
+	exists, err := us.Users.ContactNumberExists(user.ContactNumber)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+	if exists {
 		http.Error(w, "Contact number already exists", http.StatusConflict)
 		return
 	}
@@ -73,9 +107,8 @@ func (us *UserService) CreateUser(w http.ResponseWriter, r *http.Request) {
 		"user_id": user.UserID,
 	}
 
-	otp := generateOTP()
-	// Save OTP to the database
-	err = us.saveOTP(user.UserID, otp)
+	// Issue the account verification OTP
+	otp, err := us.issueOTP(user.UserID, otpPurposeVerify, us.OTP.TTL)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to create user", http.StatusInternalServerError)
@@ -103,33 +136,13 @@ func (us *UserService) CreateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (us *UserService) saveUser(user *models.User) error {
-	// Save the user to the 'users' table
-	query := `INSERT INTO users (first_name, last_name, email, contact_number, verified_account, hashed_password) VALUES (?, ?, ?, ?, ?, ?)`
-	result, err := us.DB.Exec(query, user.FirstName, user.LastName, user.Email, user.ContactNumber, user.VerifiedAccount, user.Password)
+	hashedPassword, err := us.hashPassword(user.Password)
 	if err != nil {
 		return err
 	}
+	user.Password = hashedPassword
 
-	// Get the auto-generated user ID
-	userID, err := result.LastInsertId()
-	if err != nil {
-		return err
-	}
-	user.UserID = int(userID)
-
-	// Save the user's addresses to the 'addresses' table if provided
-	if user.Address != nil {
-		addresses := *user.Address
-		for _, address := range addresses {
-			query = `INSERT INTO addresses (user_id, address_line1, address_line2, city, state, zip_code) VALUES (?, ?, ?, ?, ?, ?)`
-			_, err := us.DB.Exec(query, user.UserID, address.AddressLine1, address.AddressLine2, address.City, address.State, address.ZipCode)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
+	return us.Users.Create(user)
 }
 
 // GetUserByID retrieves a user by ID
@@ -139,61 +152,37 @@ func (us *UserService) saveUser(user *models.User) error {
 // @Produce json
 // @Param id path string true "User ID"
 // @Success 200 {object} models.User "User retrieved successfully"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
 // @Failure 500 {object} ErrorResponse "Failed to retrieve user"
 // @Router /users/{id} [get]
 func (us *UserService) GetUserByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	userID := vars["id"]
+	userID, ok := us.authorizeUser(w, r, vars["id"])
+	if !ok {
+		return
+	}
 
-	user, err := us.getUserByID(userID)
+	user, err := us.Users.Get(userID)
+	if err == store.ErrNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
 		return
 	}
 
+	// Never expose the password hash
+	user.Password = ""
+
 	// Send the response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
-func (us *UserService) getUserByID(userID string) (*models.User, error) {
-	// Get the user from the 'users' table
-	query := `SELECT * FROM users WHERE user_id = ?`
-	row := us.DB.QueryRow(query, userID)
-
-	user := &models.User{}
-	err := row.Scan(&user.UserID, &user.FirstName, &user.LastName, &user.Email, &user.ContactNumber, &user.VerifiedAccount, &user.Password)
-	if err != nil {
-		return nil, err
-	}
-
-	// Get the user's addresses from the 'addresses' table
-	query = `SELECT * FROM addresses WHERE user_id = ?`
-	rows, err := us.DB.Query(query, user.UserID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var addresses []*models.Address
-	for rows.Next() {
-		address := &models.Address{}
-		err := rows.Scan(&address.AddressID, &address.UserID, &address.AddressLine1, &address.AddressLine2, &address.City, &address.State, &address.ZipCode)
-		if err != nil {
-			return nil, err
-		}
-		addresses = append(addresses, address)
-	}
-
-	// Assign addresses to the user's Addresses field
-	if len(addresses) > 0 {
-		user.Address = &addresses
-	}
-	return user, nil
-}
-
-// UpdateUser updates a user
+// UpdateUser updates the profile and addresses of a user. Accounts are only verified by OTP.
 // @Summary Update a user
 // @Tags Users
 // @Accept json
@@ -202,11 +191,17 @@ func (us *UserService) getUserByID(userID string) (*models.User, error) {
 // @Param user body models.User true "User object"
 // @Success 200 {string} string "User updated successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "Contact number already exists"
 // @Failure 500 {object} ErrorResponse "Failed to update user"
 // @Router /users/{id} [put]
 func (us *UserService) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	userID := vars["id"]
+	userID, ok := us.authorizeUser(w, r, vars["id"])
+	if !ok {
+		return
+	}
 
 	var user models.User
 	err := json.NewDecoder(r.Body).Decode(&user)
@@ -216,8 +211,25 @@ func (us *UserService) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The contact number may be kept but not taken from another user
+	owner, err := us.Users.GetByContactNumber(user.ContactNumber)
+	if err != nil && err != store.ErrNotFound {
+		log.Println(err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && owner.UserID != userID {
+		http.Error(w, "Contact number already exists", http.StatusConflict)
+		return
+	}
+
 	// Update the user in the database
-	err = us.updateUser(userID, &user)
+	user.UserID = userID
+	err = us.updateUser(&user)
+	if err == store.ErrNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to update user", http.StatusInternalServerError)
@@ -229,34 +241,17 @@ func (us *UserService) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("User updated successfully"))
 }
 
-// UpdateUser updates a user
-func (us *UserService) updateUser(userID string, user *models.User) error {
-	// Update the user in the 'users' table
-	query := `UPDATE users SET first_name = ?, last_name = ?, email = ?, contact_number = ?, verified_account = ? WHERE user_id = ?`
-	_, err := us.DB.Exec(query, user.FirstName, user.LastName, user.Email, user.ContactNumber, user.VerifiedAccount, userID)
-	if err != nil {
-		return err
-	}
-
-	// Delete the user's existing addresses from the 'addresses' table
-	query = `DELETE FROM addresses WHERE user_id = ?`
-	_, err = us.DB.Exec(query, userID)
+// updateUser updates the profile and addresses of a user, and the password when a new one is given
+func (us *UserService) updateUser(user *models.User) error {
+	err := us.Users.Update(user)
 	if err != nil {
 		return err
 	}
 
-	// Insert the updated addresses into the 'addresses' table
-	if user.Address != nil {
-		addresses := *user.Address
-		for _, address := range addresses {
-			query = `INSERT INTO addresses (user_id, address_line1, address_line2, city, state, zip_code) VALUES (?, ?, ?, ?, ?, ?)`
-			_, err := us.DB.Exec(query, userID, address.AddressLine1, address.AddressLine2, address.City, address.State, address.ZipCode)
-			if err != nil {
-				return err
-			}
-		}
+	// Only change the password when a new one is provided
+	if user.Password != "" {
+		return us.updatePassword(user.UserID, user.Password)
 	}
-
 	return nil
 }
 
@@ -265,13 +260,17 @@ func (us *UserService) updateUser(userID string, user *models.User) error {
 // @Tags Users
 // @Param id path string true "User ID"
 // @Success 200 {string} string "User deleted successfully"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Failure 500 {object} ErrorResponse "Failed to delete user"
 // @Router /users/{id} [delete]
 func (us *UserService) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	userID := vars["id"]
+	userID, ok := us.authorizeUser(w, r, vars["id"])
+	if !ok {
+		return
+	}
 
-	err := us.deleteUser(userID)
+	err := us.Users.Delete(userID)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
@@ -283,48 +282,33 @@ func (us *UserService) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("User deleted successfully"))
 }
 
-func (us *UserService) deleteUser(userID string) error {
-	// Delete the user from the 'users' table
-	query := `DELETE FROM users WHERE user_id = ?`
-	_, err := us.DB.Exec(query, userID)
+// authorizeUser parses the path ID and checks that the caller may act on that user
+func (us *UserService) authorizeUser(w http.ResponseWriter, r *http.Request, userID string) (int, bool) {
+	id, err := strconv.Atoi(userID)
 	if err != nil {
-		return err
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
 	}
-
-	// Delete the user's addresses from the 'addresses' table
-	query = `DELETE FROM addresses WHERE user_id = ?`
-	_, err = us.DB.Exec(query, userID)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return id, utils.AuthorizeUser(w, r, id)
 }
 
-// isContactNumberExists checks if a contact number already exists in the database
-func (us *UserService) isContactNumberExists(contactNumber string) bool {
-	query := `SELECT COUNT(*) FROM users WHERE contact_number = ?`
-	row := us.DB.QueryRow(query, contactNumber)
-
-	var count int
-	err := row.Scan(&count)
+// updatePassword stores a bcrypt hash of the new password for the user
+func (us *UserService) updatePassword(userID int, password string) error {
+	hashedPassword, err := us.hashPassword(password)
 	if err != nil {
-		log.Println(err)
-		return false
+		return err
 	}
 
-	return count > 0
+	return us.Users.UpdatePassword(userID, hashedPassword)
 }
 
 // hashPassword hashes the user's password using bcrypt
 func (us *UserService) hashPassword(password string) (string, error) {
-	// Hash the password using bcrypt
+	// Hash the password using bcrypt; the encoded hash is already printable and is stored as is
 	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return "", err
 	}
 
-	// Base64 encode the hashed password before returning it as a string
-	hashedPassword := base64.StdEncoding.EncodeToString(hashedBytes)
-	return hashedPassword, nil
+	return string(hashedBytes), nil
 }
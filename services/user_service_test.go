@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/utils"
+)
+
+// signUp creates an account through the API and returns its ID
+func (s *testServer) signUp(email, password string) int {
+	s.t.Helper()
+	w := s.do(http.MethodPost, "/users", "", models.User{
+		FirstName:     "Asha",
+		Email:         email,
+		ContactNumber: "98400" + email[:5],
+		Password:      password,
+	})
+	expectStatus(s.t, w, http.StatusOK)
+	var response struct {
+		UserID int `json:"user_id"`
+	}
+	decode(s.t, w, &response)
+	return response.UserID
+}
+
+func TestSignUpAndVerify(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.signUp("asha@example.com", "secret")
+
+	user, err := s.stores.Users.Get(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Password == "secret" || !isPasswordHash(user.Password) {
+		t.Errorf("password is stored as %q, want a bcrypt hash", user.Password)
+	}
+	if user.VerifiedAccount {
+		t.Error("account is verified before the OTP was entered")
+	}
+
+	// The same contact number cannot sign up twice
+	w := s.do(http.MethodPost, "/users", "", models.User{Email: "other@example.com", ContactNumber: user.ContactNumber, Password: "secret"})
+	expectStatus(t, w, http.StatusConflict)
+
+	path := fmt.Sprintf("/verify-otp/%d", userID)
+	w = s.do(http.MethodPost, path, "", map[string]string{"otp": "not-it"})
+	expectStatus(t, w, http.StatusUnauthorized)
+
+	otp := s.outbox.lastOTP(t, "asha@example.com")
+	w = s.do(http.MethodPost, path, "", map[string]string{"otp": otp})
+	expectStatus(t, w, http.StatusOK)
+
+	user, err = s.stores.Users.Get(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.VerifiedAccount {
+		t.Error("account is not verified after entering the OTP")
+	}
+
+	// A code works once
+	w = s.do(http.MethodPost, path, "", map[string]string{"otp": otp})
+	expectStatus(t, w, http.StatusUnauthorized)
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.signUp("asha@example.com", "secret")
+
+	w := s.do(http.MethodPost, "/login", "", LoginRequest{Email: "asha@example.com", Password: "wrong"})
+	expectStatus(t, w, http.StatusUnauthorized)
+	w = s.do(http.MethodPost, "/login", "", LoginRequest{Email: "nobody@example.com", Password: "secret"})
+	expectStatus(t, w, http.StatusUnauthorized)
+
+	w = s.do(http.MethodPost, "/login", "", LoginRequest{Email: "asha@example.com", Password: "secret"})
+	expectStatus(t, w, http.StatusOK)
+	var login LoginResponse
+	decode(t, w, &login)
+	if login.UserID != userID || login.AccessToken == "" || login.RefreshToken == "" {
+		t.Fatalf("login response = %+v", login)
+	}
+
+	// The access token opens the user's own profile without the password hash
+	w = s.do(http.MethodGet, fmt.Sprintf("/users/%d", userID), login.AccessToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var user models.User
+	decode(t, w, &user)
+	if user.Email != "asha@example.com" || user.Password != "" {
+		t.Errorf("profile = %+v", user)
+	}
+
+	// Refresh tokens rotate, and replaying a used one is refused
+	w = s.do(http.MethodPost, "/token/refresh", "", RefreshTokenRequest{RefreshToken: login.RefreshToken})
+	expectStatus(t, w, http.StatusOK)
+	var refreshed LoginResponse
+	decode(t, w, &refreshed)
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+	w = s.do(http.MethodPost, "/token/refresh", "", RefreshTokenRequest{RefreshToken: login.RefreshToken})
+	expectStatus(t, w, http.StatusUnauthorized)
+}
+
+func TestUserAccess(t *testing.T) {
+	s := newTestServer(t)
+	ashaID, asha := s.user("asha@example.com", utils.RoleCustomer)
+	ravi, _ := s.user("ravi@example.com", utils.RoleCustomer)
+	_, admin := s.user("admin@example.com", utils.RoleAdmin)
+
+	path := fmt.Sprintf("/users/%d", ravi)
+	expectStatus(t, s.do(http.MethodGet, path, "", nil), http.StatusUnauthorized)
+	expectStatus(t, s.do(http.MethodGet, path, asha, nil), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodDelete, path, asha, nil), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodGet, path, admin, nil), http.StatusOK)
+
+	// Only admins grant roles
+	rolePath := fmt.Sprintf("/admin/users/%d/role", ashaID)
+	expectStatus(t, s.do(http.MethodPut, rolePath, asha, RoleRequest{Role: utils.RoleAdmin}), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodPut, rolePath, admin, RoleRequest{Role: "owner"}), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodPut, rolePath, admin, RoleRequest{Role: utils.RoleStaff}), http.StatusOK)
+
+	role, err := s.stores.Users.Role(ashaID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != utils.RoleStaff {
+		t.Errorf("role = %q, want %q", role, utils.RoleStaff)
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	s := newTestServer(t)
+	s.user("asha@example.com", utils.RoleCustomer)
+	raviID := s.signUp("ravi@example.com", "secret123")
+	ravi := s.token(raviID, utils.RoleCustomer)
+	path := fmt.Sprintf("/users/%d", raviID)
+
+	// A profile update cannot verify the account
+	update := models.User{FirstName: "Ravi", Email: "ravi@example.com", ContactNumber: "98400ravi@", VerifiedAccount: true}
+	expectStatus(t, s.do(http.MethodPut, path, ravi, update), http.StatusOK)
+	user, err := s.stores.Users.Get(raviID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.VerifiedAccount || user.FirstName != "Ravi" {
+		t.Errorf("user = %+v, want the name changed and the account left unverified", user)
+	}
+
+	// Nor take another user's contact number
+	update.ContactNumber = "asha@example.com"
+	expectStatus(t, s.do(http.MethodPut, path, ravi, update), http.StatusConflict)
+}
+
+func TestOTPLockout(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.signUp("asha@example.com", "secret")
+	otp := s.outbox.lastOTP(t, "asha@example.com")
+	path := fmt.Sprintf("/verify-otp/%d", userID)
+
+	// Guesses made at the same time are all counted
+	guesses := 3 * DefaultOTPPolicy.MaxFailures
+	codes := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- s.do(http.MethodPost, path, "", map[string]string{"otp": "wrong!"}).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counted := map[int]int{}
+	for code := range codes {
+		counted[code]++
+	}
+	if counted[http.StatusUnauthorized] != DefaultOTPPolicy.MaxFailures || counted[http.StatusTooManyRequests] != guesses-DefaultOTPPolicy.MaxFailures {
+		t.Errorf("responses = %v, want %d refused as invalid and the rest locked out", counted, DefaultOTPPolicy.MaxFailures)
+	}
+
+	// The right code is refused while the user is locked out
+	expectStatus(t, s.do(http.MethodPost, path, "", map[string]string{"otp": otp}), http.StatusTooManyRequests)
+}
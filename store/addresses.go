@@ -0,0 +1,92 @@
+package store
+
+import (
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// AddressStore stores users' delivery addresses
+type AddressStore interface {
+	// Create stores an address, assigning its ID
+	Create(address *models.Address) error
+	// Get returns an address
+	Get(id int) (*models.Address, error)
+	// Update changes the lines of address.AddressID
+	Update(address *models.Address) error
+	// Delete removes an address
+	Delete(id int) error
+	// ListByUser returns the addresses of a user
+	ListByUser(userID int) ([]*models.Address, error)
+}
+
+const addressColumns = `address_id, user_id, address_line1, COALESCE(address_line2, ''), city, state, zip_code`
+
+type sqlAddressStore struct {
+	db *db.Repository
+}
+
+func scanAddress(row scanner) (*models.Address, error) {
+	address := &models.Address{}
+	err := row.Scan(&address.AddressID, &address.UserID, &address.AddressLine1, &address.AddressLine2, &address.City, &address.State, &address.ZipCode)
+	if err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// insertAddress stores an address through Repository or Tx and assigns its ID
+func insertAddress(insert func(query, idColumn string, args ...interface{}) (int64, error), address *models.Address) error {
+	query := `INSERT INTO addresses (user_id, address_line1, address_line2, city, state, zip_code) VALUES (?, ?, ?, ?, ?, ?)`
+	id, err := insert(query, "address_id", address.UserID, address.AddressLine1, address.AddressLine2, address.City, address.State, address.ZipCode)
+	if err != nil {
+		return err
+	}
+	address.AddressID = int(id)
+	return nil
+}
+
+func (s *sqlAddressStore) Create(address *models.Address) error {
+	return insertAddress(s.db.InsertReturningID, address)
+}
+
+func (s *sqlAddressStore) Get(id int) (*models.Address, error) {
+	address, err := scanAddress(s.db.QueryRow(`SELECT `+addressColumns+` FROM addresses WHERE address_id = ?`, id))
+	return address, notFound(err)
+}
+
+func (s *sqlAddressStore) Update(address *models.Address) error {
+	query := `UPDATE addresses SET address_line1 = ?, address_line2 = ?, city = ?, state = ?, zip_code = ? WHERE address_id = ?`
+	result, err := s.db.Exec(query, address.AddressLine1, address.AddressLine2, address.City, address.State, address.ZipCode, address.AddressID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlAddressStore) Delete(id int) error {
+	_, err := s.db.Exec(`DELETE FROM addresses WHERE address_id = ?`, id)
+	return err
+}
+
+func (s *sqlAddressStore) ListByUser(userID int) ([]*models.Address, error) {
+	return listAddresses(s.db, userID)
+}
+
+// listAddresses returns the addresses of a user
+func listAddresses(repo *db.Repository, userID int) ([]*models.Address, error) {
+	rows, err := repo.Query(`SELECT `+addressColumns+` FROM addresses WHERE user_id = ? ORDER BY address_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addresses []*models.Address
+	for rows.Next() {
+		address, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
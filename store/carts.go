@@ -0,0 +1,75 @@
+package store
+
+import (
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// CartStore stores the items in users' carts
+type CartStore interface {
+	// AddItem puts a quantity of a weight variant in the user's cart
+	AddItem(userID, productWeightID, quantity int) error
+	// Items returns the items in the user's cart together with their weight variant
+	Items(userID int) ([]*models.CartItem, error)
+	// UpdateQuantity changes the quantity of a weight variant in the user's cart
+	UpdateQuantity(userID, productWeightID, quantity int) error
+	// RemoveItem removes a weight variant from the user's cart
+	RemoveItem(userID, productWeightID int) error
+	// Clear removes every item from the user's cart
+	Clear(userID int) error
+}
+
+type sqlCartStore struct {
+	db *db.Repository
+}
+
+func (s *sqlCartStore) AddItem(userID, productWeightID, quantity int) error {
+	now := time.Now()
+	_, err := s.db.Exec(`INSERT INTO cart (user_id, product_weight_id, quantity, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		userID, productWeightID, quantity, now, now)
+	return err
+}
+
+func (s *sqlCartStore) Items(userID int) ([]*models.CartItem, error) {
+	rows, err := s.db.Query(`SELECT c.quantity, c.created_at, c.updated_at,
+			w.id, w.product_id, w.weight, w.price, w.stock, w.measurement, w.created_at, w.updated_at
+		FROM cart AS c
+		INNER JOIN product_weights AS w ON c.product_weight_id = w.id
+		WHERE c.user_id = ?
+		ORDER BY c.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.CartItem
+	for rows.Next() {
+		item := &models.CartItem{Product: &models.ProductWeight{}}
+		weight := item.Product
+		err := rows.Scan(&item.Quantity, &item.CreatedAt, &item.UpdatedAt,
+			&weight.ID, &weight.ProductID, &weight.Weight, &weight.Price, &weight.StockAvailability, &weight.Measurement, &weight.CreatedAt, &weight.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlCartStore) UpdateQuantity(userID, productWeightID, quantity int) error {
+	_, err := s.db.Exec(`UPDATE cart SET quantity = ?, updated_at = ? WHERE user_id = ? AND product_weight_id = ?`,
+		quantity, time.Now(), userID, productWeightID)
+	return err
+}
+
+func (s *sqlCartStore) RemoveItem(userID, productWeightID int) error {
+	_, err := s.db.Exec(`DELETE FROM cart WHERE user_id = ? AND product_weight_id = ?`, userID, productWeightID)
+	return err
+}
+
+func (s *sqlCartStore) Clear(userID int) error {
+	_, err := s.db.Exec(`DELETE FROM cart WHERE user_id = ?`, userID)
+	return err
+}
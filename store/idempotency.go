@@ -0,0 +1,102 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// IdempotencyStore stores the responses of requests sent with an Idempotency-Key header
+type IdempotencyStore interface {
+	// Reserve claims record.Key for the user while the request is processed,
+	// assigning the record's ID. When an unexpired record already holds the key,
+	// nothing is stored and that record is returned instead.
+	Reserve(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	// Complete stores the response of a reserved request
+	Complete(record *models.IdempotencyRecord) error
+	// Release removes a reservation so that the request can be retried
+	Release(id int) error
+	// DeleteExpired removes the records that expired by now and returns how many there were
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+type sqlIdempotencyStore struct {
+	db *db.Repository
+}
+
+func (s *sqlIdempotencyStore) Reserve(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// An expired record no longer holds its key
+	_, err = tx.Exec(`DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ? AND expires_at <= ?`, record.UserID, record.Key, record.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// A concurrent reservation of the same key makes this insert a no-op rather than an error
+	query := `INSERT INTO idempotency_keys (user_id, idempotency_key, method, path, request_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, idempotency_key) DO NOTHING`
+	result, err := tx.Exec(query, record.UserID, record.Key, record.Method, record.Path, record.RequestHash, record.CreatedAt, record.ExpiresAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	stored := &models.IdempotencyRecord{}
+	var statusCode sql.NullInt64
+	var contentType, responseBody sql.NullString
+	query = `SELECT id, user_id, idempotency_key, method, path, request_hash, status_code, content_type, response_body, created_at, expires_at
+		FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?`
+	err = tx.QueryRow(query, record.UserID, record.Key).Scan(&stored.ID, &stored.UserID, &stored.Key, &stored.Method, &stored.Path, &stored.RequestHash,
+		&statusCode, &contentType, &responseBody, &stored.CreatedAt, &stored.ExpiresAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	stored.StatusCode = int(statusCode.Int64)
+	stored.ContentType = contentType.String
+	stored.ResponseBody = responseBody.String
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if inserted == 0 {
+		return stored, nil
+	}
+	record.ID = stored.ID
+	return nil, nil
+}
+
+func (s *sqlIdempotencyStore) Complete(record *models.IdempotencyRecord) error {
+	query := `UPDATE idempotency_keys SET status_code = ?, content_type = ?, response_body = ? WHERE id = ?`
+	result, err := s.db.Exec(query, record.StatusCode, record.ContentType, record.ResponseBody, record.ID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlIdempotencyStore) Release(id int) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE id = ?`, id)
+	return err
+}
+
+func (s *sqlIdempotencyStore) DeleteExpired(now time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= ?`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
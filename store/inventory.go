@@ -0,0 +1,212 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// InventoryStore stores the stock settings of weight variants and the ledger of
+// stock movements. Every change to the stock of a variant, by any store, is recorded
+// as a movement.
+type InventoryStore interface {
+	// Get returns the inventory of a weight variant
+	Get(productWeightID int) (*models.Inventory, error)
+	// List returns the inventory of every weight variant by product
+	List() ([]*models.Inventory, error)
+	// UpdateSettings changes the reorder threshold and supplier of a weight variant
+	UpdateSettings(inventory *models.Inventory) error
+	// RecordMovement changes the stock of movement.ProductWeightID by movement.Quantity
+	// and records the movement, assigning its ID. It returns ErrOutOfStock when the
+	// stock would fall below zero, and ErrInvalidItem when movement.PurchaseID is set
+	// but the purchase does not contain the weight variant.
+	RecordMovement(movement *models.StockMovement) error
+	// Movements returns the stock ledger of a weight variant, oldest first
+	Movements(productWeightID int) ([]*models.StockMovement, error)
+	// LowStock returns the weight variants whose stock is below their reorder
+	// threshold, by supplier and product
+	LowStock() ([]*models.Inventory, error)
+}
+
+const inventoryQuery = `SELECT w.id, w.stock, w.reorder_threshold, COALESCE(w.supplier_id, 0), w.product_id, p.name, w.weight, w.measurement
+	FROM product_weights AS w
+	JOIN products AS p ON w.product_id = p.id`
+
+const movementColumns = `id, product_weight_id, movement_type, quantity, COALESCE(purchase_id, 0), note, COALESCE(actor_id, 0), created_at`
+
+type sqlInventoryStore struct {
+	db *db.Repository
+}
+
+func scanInventory(row scanner) (*models.Inventory, error) {
+	inventory := &models.Inventory{}
+	err := row.Scan(&inventory.ProductWeightID, &inventory.AvailableQuantity, &inventory.ReorderThreshold, &inventory.SupplierID,
+		&inventory.ProductID, &inventory.ProductName, &inventory.Weight, &inventory.Measurement)
+	if err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+func (s *sqlInventoryStore) Get(productWeightID int) (*models.Inventory, error) {
+	inventory, err := scanInventory(s.db.QueryRow(inventoryQuery+` WHERE w.id = ?`, productWeightID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return inventory, nil
+}
+
+func (s *sqlInventoryStore) List() ([]*models.Inventory, error) {
+	return s.list(inventoryQuery + ` ORDER BY w.product_id, w.weight, w.id`)
+}
+
+func (s *sqlInventoryStore) LowStock() ([]*models.Inventory, error) {
+	return s.list(inventoryQuery + ` WHERE w.stock < w.reorder_threshold ORDER BY COALESCE(w.supplier_id, 0), w.product_id, w.weight, w.id`)
+}
+
+// list returns the inventory a query selects
+func (s *sqlInventoryStore) list(query string, args ...interface{}) ([]*models.Inventory, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inventory []*models.Inventory
+	for rows.Next() {
+		item, err := scanInventory(rows)
+		if err != nil {
+			return nil, err
+		}
+		inventory = append(inventory, item)
+	}
+	return inventory, rows.Err()
+}
+
+func (s *sqlInventoryStore) UpdateSettings(inventory *models.Inventory) error {
+	query := `UPDATE product_weights SET reorder_threshold = ?, supplier_id = ? WHERE id = ?`
+	result, err := s.db.Exec(query, inventory.ReorderThreshold, nullInt(inventory.SupplierID), inventory.ProductWeightID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlInventoryStore) RecordMovement(movement *models.StockMovement) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if movement.PurchaseID != 0 {
+		var count int
+		query := `SELECT COUNT(*) FROM purchase_items WHERE purchase_id = ? AND product_weight_id = ?`
+		err := tx.QueryRow(query, movement.PurchaseID, movement.ProductWeightID).Scan(&count)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if count == 0 {
+			tx.Rollback()
+			return fmt.Errorf("%w: purchase %d has no weight %d", ErrInvalidItem, movement.PurchaseID, movement.ProductWeightID)
+		}
+	}
+
+	// The check and the change are one statement so concurrent movements cannot take the stock below zero
+	result, err := tx.Exec(`UPDATE product_weights SET stock = stock + ? WHERE id = ? AND stock + ? >= 0`,
+		movement.Quantity, movement.ProductWeightID, movement.Quantity)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if rows == 0 {
+		var count int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM product_weights WHERE id = ?`, movement.ProductWeightID).Scan(&count)
+		tx.Rollback()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return fmt.Errorf("%w: weight %d", ErrOutOfStock, movement.ProductWeightID)
+	}
+
+	if err := insertMovement(tx, movement); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertMovement records a stock movement within a transaction and assigns its ID. The
+// stock itself is changed by the caller.
+func insertMovement(tx *db.Tx, movement *models.StockMovement) error {
+	if movement.CreatedAt.IsZero() {
+		movement.CreatedAt = time.Now()
+	}
+	query := `INSERT INTO stock_movements (product_weight_id, movement_type, quantity, purchase_id, note, actor_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	id, err := tx.InsertReturningID(query, "id", movement.ProductWeightID, movement.MovementType, movement.Quantity,
+		nullInt(movement.PurchaseID), movement.Note, nullInt(movement.ActorID), movement.CreatedAt)
+	if err != nil {
+		return err
+	}
+	movement.ID = int(id)
+	return nil
+}
+
+// setStock sets the stock of a weight variant within a transaction and records the
+// difference as an adjustment
+func setStock(tx *db.Tx, productWeightID, stock int, note string) error {
+	// Locking first keeps an order or another adjustment from changing the stock
+	// between the read and the write, which the movement would then misstate
+	if err := lockRow(tx, "product_weights", "id", productWeightID); err != nil {
+		return err
+	}
+	var current int
+	err := tx.QueryRow(`SELECT stock FROM product_weights WHERE id = ?`, productWeightID).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current == stock {
+		return nil
+	}
+
+	_, err = tx.Exec(`UPDATE product_weights SET stock = ? WHERE id = ?`, stock, productWeightID)
+	if err != nil {
+		return err
+	}
+	return insertMovement(tx, &models.StockMovement{
+		ProductWeightID: productWeightID,
+		MovementType:    models.StockMovementAdjustment,
+		Quantity:        stock - current,
+		Note:            note,
+	})
+}
+
+func (s *sqlInventoryStore) Movements(productWeightID int) ([]*models.StockMovement, error) {
+	rows, err := s.db.Query(`SELECT `+movementColumns+` FROM stock_movements WHERE product_weight_id = ? ORDER BY id`, productWeightID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []*models.StockMovement
+	for rows.Next() {
+		movement := &models.StockMovement{}
+		err := rows.Scan(&movement.ID, &movement.ProductWeightID, &movement.MovementType, &movement.Quantity,
+			&movement.PurchaseID, &movement.Note, &movement.ActorID, &movement.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, movement)
+	}
+	return movements, rows.Err()
+}
@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+func TestStockMovements(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		product := f.product(5, 100)
+		weightID := product.Weights[0].ID
+		purchase := f.order(userID, product, 2, "")
+
+		receipt := &models.StockMovement{ProductWeightID: weightID, MovementType: models.StockMovementReceipt, Quantity: 10, Note: "Morning batch"}
+		if err := stores.Inventory.RecordMovement(receipt); err != nil {
+			t.Fatal(err)
+		}
+		returned := &models.StockMovement{ProductWeightID: weightID, MovementType: models.StockMovementReturn, Quantity: 1, PurchaseID: purchase.ID}
+		if err := stores.Inventory.RecordMovement(returned); err != nil {
+			t.Fatal(err)
+		}
+		if stock := f.stock(weightID); stock != 14 {
+			t.Errorf("stock = %d, want 14", stock)
+		}
+
+		// A movement that would take the stock below zero changes nothing
+		adjustment := &models.StockMovement{ProductWeightID: weightID, MovementType: models.StockMovementAdjustment, Quantity: -15}
+		if err := stores.Inventory.RecordMovement(adjustment); !errors.Is(err, store.ErrOutOfStock) {
+			t.Errorf("adjusting below zero = %v, want %v", err, store.ErrOutOfStock)
+		}
+		if err := stores.Inventory.RecordMovement(&models.StockMovement{ProductWeightID: weightID + 100, MovementType: models.StockMovementReceipt, Quantity: 1}); err != store.ErrNotFound {
+			t.Errorf("receiving a missing weight = %v, want %v", err, store.ErrNotFound)
+		}
+
+		// A return can only be tied to a purchase of the weight variant
+		other := f.product(5, 80)
+		for _, purchaseID := range []int{purchase.ID + 100, purchase.ID} {
+			movement := &models.StockMovement{ProductWeightID: other.Weights[0].ID, MovementType: models.StockMovementReturn, Quantity: 1, PurchaseID: purchaseID}
+			if err := stores.Inventory.RecordMovement(movement); !errors.Is(err, store.ErrInvalidItem) {
+				t.Errorf("returning to purchase %d = %v, want %v", purchaseID, err, store.ErrInvalidItem)
+			}
+		}
+		if stock := f.stock(other.Weights[0].ID); stock != 5 {
+			t.Errorf("stock = %d, want the refused return to leave it at 5", stock)
+		}
+
+		movements, err := stores.Inventory.Movements(weightID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []struct {
+			movementType string
+			quantity     int
+			purchaseID   int
+		}{
+			{models.StockMovementAdjustment, 5, 0},
+			{models.StockMovementSale, -2, purchase.ID},
+			{models.StockMovementReceipt, 10, 0},
+			{models.StockMovementReturn, 1, purchase.ID},
+		}
+		if len(movements) != len(want) {
+			t.Fatalf("movements = %+v, want %d", movements, len(want))
+		}
+		for i, movement := range movements {
+			if movement.MovementType != want[i].movementType || movement.Quantity != want[i].quantity || movement.PurchaseID != want[i].purchaseID {
+				t.Errorf("movement %d = %+v, want %+v", i, movement, want[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package memstore
+
+import (
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type addressStore struct {
+	*data
+}
+
+func (s *addressStore) Create(address *models.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insertAddress(address)
+	return nil
+}
+
+// insertAddress stores a copy of an address and assigns its ID
+func (d *data) insertAddress(address *models.Address) {
+	address.AddressID = d.id("addresses")
+	stored := *address
+	d.addresses[address.AddressID] = &stored
+}
+
+func (s *addressStore) Get(id int) (*models.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	address, ok := s.addresses[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *address
+	return &copied, nil
+}
+
+func (s *addressStore) Update(address *models.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.addresses[address.AddressID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	stored.AddressLine1 = address.AddressLine1
+	stored.AddressLine2 = address.AddressLine2
+	stored.City = address.City
+	stored.State = address.State
+	stored.ZipCode = address.ZipCode
+	return nil
+}
+
+func (s *addressStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.addresses, id)
+	return nil
+}
+
+func (s *addressStore) ListByUser(userID int) ([]*models.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.userAddresses(userID), nil
+}
+
+// userAddresses returns copies of the addresses of a user
+func (d *data) userAddresses(userID int) []*models.Address {
+	var addresses []*models.Address
+	for _, id := range sortedKeys(d.addresses) {
+		if address := d.addresses[id]; address.UserID == userID {
+			copied := *address
+			addresses = append(addresses, &copied)
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,94 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+)
+
+type cartStore struct {
+	*data
+}
+
+func (s *cartStore) AddItem(userID, productWeightID, quantity int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.cart = append(s.cart, &cartRow{
+		userID:          userID,
+		productWeightID: productWeightID,
+		quantity:        quantity,
+		createdAt:       now,
+		updatedAt:       now,
+	})
+	return nil
+}
+
+func (s *cartStore) Items(userID int) ([]*models.CartItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []*models.CartItem
+	for _, row := range s.cart {
+		weight, ok := s.weights[row.productWeightID]
+		if row.userID != userID || !ok {
+			continue
+		}
+		copied := *weight
+		items = append(items, &models.CartItem{
+			Product:   &copied,
+			Quantity:  row.quantity,
+			CreatedAt: row.createdAt,
+			UpdatedAt: row.updatedAt,
+		})
+	}
+	return items, nil
+}
+
+func (s *cartStore) UpdateQuantity(userID, productWeightID, quantity int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, row := range s.cart {
+		if row.userID == userID && row.productWeightID == productWeightID {
+			row.quantity = quantity
+			row.updatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *cartStore) RemoveItem(userID, productWeightID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeCartRows(func(row *cartRow) bool {
+		return row.userID == userID && row.productWeightID == productWeightID
+	})
+	return nil
+}
+
+func (s *cartStore) Clear(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clearCart(userID)
+	return nil
+}
+
+// clearCart removes every item from the user's cart
+func (d *data) clearCart(userID int) {
+	d.removeCartRows(func(row *cartRow) bool { return row.userID == userID })
+}
+
+// removeCartRows removes the cart rows matching the predicate
+func (d *data) removeCartRows(match func(row *cartRow) bool) {
+	kept := d.cart[:0]
+	for _, row := range d.cart {
+		if !match(row) {
+			kept = append(kept, row)
+		}
+	}
+	d.cart = kept
+}
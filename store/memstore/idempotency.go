@@ -0,0 +1,70 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type idempotencyStore struct {
+	*data
+}
+
+func (s *idempotencyStore) Reserve(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, stored := range s.idempotencyKeys {
+		if stored.UserID != record.UserID || stored.Key != record.Key {
+			continue
+		}
+		if !stored.ExpiresAt.After(record.CreatedAt) {
+			delete(s.idempotencyKeys, id)
+			break
+		}
+		existing := *stored
+		return &existing, nil
+	}
+
+	record.ID = s.id("idempotency_keys")
+	stored := *record
+	s.idempotencyKeys[record.ID] = &stored
+	return nil, nil
+}
+
+func (s *idempotencyStore) Complete(record *models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.idempotencyKeys[record.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	stored.StatusCode = record.StatusCode
+	stored.ContentType = record.ContentType
+	stored.ResponseBody = record.ResponseBody
+	return nil
+}
+
+func (s *idempotencyStore) Release(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotencyKeys, id)
+	return nil
+}
+
+func (s *idempotencyStore) DeleteExpired(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, stored := range s.idempotencyKeys {
+		if !stored.ExpiresAt.After(now) {
+			delete(s.idempotencyKeys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
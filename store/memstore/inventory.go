@@ -0,0 +1,175 @@
+package memstore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type inventoryStore struct {
+	*data
+}
+
+// inventoryOf returns the inventory of a stored weight variant
+func (d *data) inventoryOf(weight *models.ProductWeight) *models.Inventory {
+	inventory := &models.Inventory{
+		ProductWeightID:   weight.ID,
+		AvailableQuantity: weight.StockAvailability,
+		ProductID:         weight.ProductID,
+		Weight:            weight.Weight,
+		Measurement:       weight.Measurement,
+	}
+	if product, ok := d.products[weight.ProductID]; ok {
+		inventory.ProductName = product.Name
+	}
+	if settings, ok := d.stockSettings[weight.ID]; ok {
+		inventory.ReorderThreshold = settings.ReorderThreshold
+		inventory.SupplierID = settings.SupplierID
+	}
+	return inventory
+}
+
+// listInventory returns the inventory of the weight variants matching the predicate by product
+func (d *data) listInventory(match func(inventory *models.Inventory) bool) []*models.Inventory {
+	var inventory []*models.Inventory
+	for _, id := range sortedKeys(d.weights) {
+		weight := d.weights[id]
+		if _, ok := d.products[weight.ProductID]; !ok {
+			continue
+		}
+		if item := d.inventoryOf(weight); match(item) {
+			inventory = append(inventory, item)
+		}
+	}
+	sort.SliceStable(inventory, func(i, j int) bool {
+		if inventory[i].ProductID != inventory[j].ProductID {
+			return inventory[i].ProductID < inventory[j].ProductID
+		}
+		return inventory[i].Weight < inventory[j].Weight
+	})
+	return inventory
+}
+
+func (s *inventoryStore) Get(productWeightID int) (*models.Inventory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	weight, ok := s.weights[productWeightID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	if _, ok := s.products[weight.ProductID]; !ok {
+		return nil, store.ErrNotFound
+	}
+	return s.inventoryOf(weight), nil
+}
+
+func (s *inventoryStore) List() ([]*models.Inventory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listInventory(func(*models.Inventory) bool { return true }), nil
+}
+
+func (s *inventoryStore) LowStock() ([]*models.Inventory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inventory := s.listInventory(func(inventory *models.Inventory) bool {
+		return inventory.NeedsReorder()
+	})
+	sort.SliceStable(inventory, func(i, j int) bool {
+		return inventory[i].SupplierID < inventory[j].SupplierID
+	})
+	return inventory, nil
+}
+
+func (s *inventoryStore) UpdateSettings(inventory *models.Inventory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.weights[inventory.ProductWeightID]; !ok {
+		return store.ErrNotFound
+	}
+	s.stockSettings[inventory.ProductWeightID] = &models.Inventory{
+		ProductWeightID:  inventory.ProductWeightID,
+		ReorderThreshold: inventory.ReorderThreshold,
+		SupplierID:       inventory.SupplierID,
+	}
+	return nil
+}
+
+func (s *inventoryStore) RecordMovement(movement *models.StockMovement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	weight, ok := s.weights[movement.ProductWeightID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if movement.PurchaseID != 0 && !s.purchaseContains(movement.PurchaseID, movement.ProductWeightID) {
+		return fmt.Errorf("%w: purchase %d has no weight %d", store.ErrInvalidItem, movement.PurchaseID, movement.ProductWeightID)
+	}
+	if weight.StockAvailability+movement.Quantity < 0 {
+		return fmt.Errorf("%w: weight %d", store.ErrOutOfStock, movement.ProductWeightID)
+	}
+	weight.StockAvailability += movement.Quantity
+	s.recordMovement(movement)
+	return nil
+}
+
+// purchaseContains reports whether a stored purchase has an item of the weight variant
+func (d *data) purchaseContains(purchaseID, productWeightID int) bool {
+	purchase, ok := d.purchases[purchaseID]
+	if !ok {
+		return false
+	}
+	for _, item := range purchase.Items {
+		if item.ProductWeightID == productWeightID {
+			return true
+		}
+	}
+	return false
+}
+
+// recordMovement stores a copy of a stock movement and assigns its ID. The stock
+// itself is changed by the caller.
+func (d *data) recordMovement(movement *models.StockMovement) {
+	if movement.CreatedAt.IsZero() {
+		movement.CreatedAt = time.Now()
+	}
+	movement.ID = d.id("stock_movements")
+	stored := *movement
+	d.stockMovements[movement.ID] = &stored
+}
+
+// setStock sets the stock of a stored weight variant and records the difference as an adjustment
+func (d *data) setStock(weight *models.ProductWeight, stock int, note string) {
+	if weight.StockAvailability == stock {
+		return
+	}
+	d.recordMovement(&models.StockMovement{
+		ProductWeightID: weight.ID,
+		MovementType:    models.StockMovementAdjustment,
+		Quantity:        stock - weight.StockAvailability,
+		Note:            note,
+	})
+	weight.StockAvailability = stock
+}
+
+func (s *inventoryStore) Movements(productWeightID int) ([]*models.StockMovement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var movements []*models.StockMovement
+	for _, id := range sortedKeys(s.stockMovements) {
+		if movement := s.stockMovements[id]; movement.ProductWeightID == productWeightID {
+			copied := *movement
+			movements = append(movements, &copied)
+		}
+	}
+	return movements, nil
+}
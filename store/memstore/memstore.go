@@ -0,0 +1,117 @@
+// Package memstore provides in-memory implementations of the store interfaces
+// so that services and handlers can be exercised without a database.
+package memstore
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+// data holds every record. The stores share it so that joins and cascades
+// behave as they do in the database.
+type data struct {
+	mu sync.Mutex
+
+	nextID map[string]int
+
+	products        map[int]*models.Product
+	weights         map[int]*models.ProductWeight
+	cart            []*cartRow
+	purchases       map[int]*models.Purchase
+	statusChanges   map[int]*models.PurchaseStatusChange
+	refunds         map[int]*models.Refund
+	paymentModes    map[int]*models.PaymentMode
+	promotions      map[int]*models.Promotion
+	offers          map[int]*models.Offer
+	reviews         map[int]*models.Review
+	suppliers       map[int]*models.Supplier
+	stockSettings   map[int]*models.Inventory
+	stockMovements  map[int]*models.StockMovement
+	payments        map[int]*models.Payment
+	users           map[int]*userRow
+	addresses       map[int]*models.Address
+	wishlist        map[int]*models.Wishlist
+	otps            map[int]*models.OTP
+	refreshTokens   map[int]*models.RefreshToken
+	idempotencyKeys map[int]*models.IdempotencyRecord
+}
+
+// cartRow is a line of a user's cart
+type cartRow struct {
+	userID          int
+	productWeightID int
+	quantity        int
+	createdAt       time.Time
+	updatedAt       time.Time
+}
+
+// userRow is a user together with their OTP lockout state
+type userRow struct {
+	user           models.User
+	otpFailures    int
+	otpLockedUntil time.Time
+}
+
+// New returns empty in-memory stores
+func New() *store.Stores {
+	d := &data{
+		nextID:          map[string]int{},
+		products:        map[int]*models.Product{},
+		weights:         map[int]*models.ProductWeight{},
+		purchases:       map[int]*models.Purchase{},
+		statusChanges:   map[int]*models.PurchaseStatusChange{},
+		refunds:         map[int]*models.Refund{},
+		paymentModes:    map[int]*models.PaymentMode{},
+		promotions:      map[int]*models.Promotion{},
+		offers:          map[int]*models.Offer{},
+		reviews:         map[int]*models.Review{},
+		suppliers:       map[int]*models.Supplier{},
+		stockSettings:   map[int]*models.Inventory{},
+		stockMovements:  map[int]*models.StockMovement{},
+		payments:        map[int]*models.Payment{},
+		users:           map[int]*userRow{},
+		addresses:       map[int]*models.Address{},
+		wishlist:        map[int]*models.Wishlist{},
+		otps:            map[int]*models.OTP{},
+		refreshTokens:   map[int]*models.RefreshToken{},
+		idempotencyKeys: map[int]*models.IdempotencyRecord{},
+	}
+	return &store.Stores{
+		Products:      &productStore{d},
+		Carts:         &cartStore{d},
+		Orders:        &orderStore{d},
+		Payments:      &paymentStore{d},
+		Refunds:       &refundStore{d},
+		Promotions:    &promotionStore{d},
+		Offers:        &offerStore{d},
+		Reviews:       &reviewStore{d},
+		Suppliers:     &supplierStore{d},
+		Inventory:     &inventoryStore{d},
+		Users:         &userStore{d},
+		Addresses:     &addressStore{d},
+		Wishlists:     &wishlistStore{d},
+		OTPs:          &otpStore{d},
+		RefreshTokens: &refreshTokenStore{d},
+		Idempotency:   &idempotencyStore{d},
+	}
+}
+
+// id returns the next auto-increment value of a table
+func (d *data) id(table string) int {
+	d.nextID[table]++
+	return d.nextID[table]
+}
+
+// sortedKeys returns the keys of a map keyed by ID in ascending order
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,110 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type offerStore struct {
+	*data
+}
+
+// copyOffer returns a copy of an offer that shares no tiers with it
+func copyOffer(offer *models.Offer) *models.Offer {
+	copied := *offer
+	copied.Tiers = []*models.OfferTier{}
+	for _, tier := range offer.Tiers {
+		copiedTier := *tier
+		copied.Tiers = append(copied.Tiers, &copiedTier)
+	}
+	return &copied
+}
+
+func (s *offerStore) Create(offer *models.Offer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offer.OfferID = s.id("offers")
+	s.offers[offer.OfferID] = copyOffer(offer)
+	return nil
+}
+
+func (s *offerStore) Get(id int) (*models.Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offer, ok := s.offers[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return copyOffer(offer), nil
+}
+
+func (s *offerStore) List() ([]*models.Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listOffers(), nil
+}
+
+// listOffers returns copies of the offers by priority
+func (d *data) listOffers() []*models.Offer {
+	var offers []*models.Offer
+	for _, id := range sortedKeys(d.offers) {
+		offers = append(offers, copyOffer(d.offers[id]))
+	}
+	sort.SliceStable(offers, func(i, j int) bool {
+		return offers[i].Priority < offers[j].Priority
+	})
+	return offers
+}
+
+func (s *offerStore) Update(offer *models.Offer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.offers[offer.OfferID]; !ok {
+		return store.ErrNotFound
+	}
+	s.offers[offer.OfferID] = copyOffer(offer)
+	return nil
+}
+
+func (s *offerStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.offers[id]; !ok {
+		return store.ErrNotFound
+	}
+	for _, purchase := range s.purchases {
+		for _, discount := range purchase.Discounts {
+			if discount.OfferID == id {
+				return store.ErrOfferInUse
+			}
+		}
+	}
+	delete(s.offers, id)
+	return nil
+}
+
+func (s *offerStore) Price(items []*models.PurchaseItem) ([]*models.PurchaseDiscount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.priceOffers(items, time.Now()), nil
+}
+
+// priceOffers returns the discount lines the offers running at now give on items
+func (d *data) priceOffers(items []*models.PurchaseItem, now time.Time) []*models.PurchaseDiscount {
+	var running []*models.Offer
+	for _, offer := range d.listOffers() {
+		if offer.RunsAt(now) {
+			running = append(running, offer)
+		}
+	}
+	return models.ApplyOffers(running, items)
+}
@@ -0,0 +1,350 @@
+package memstore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type orderStore struct {
+	*data
+}
+
+func (s *orderStore) Create(purchase *models.Purchase) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.placeOrder(purchase)
+}
+
+func (s *orderStore) Checkout(purchase *models.Purchase) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purchase.Items = nil
+	for _, row := range s.cart {
+		if row.userID != purchase.UserID {
+			continue
+		}
+		item := &models.PurchaseItem{ProductWeightID: row.productWeightID, Quantity: row.quantity}
+		if weight, ok := s.weights[row.productWeightID]; ok {
+			item.ProductID = weight.ProductID
+		}
+		purchase.Items = append(purchase.Items, item)
+	}
+	if len(purchase.Items) == 0 {
+		return store.ErrEmptyCart
+	}
+	if err := s.placeOrder(purchase); err != nil {
+		return err
+	}
+	s.clearCart(purchase.UserID)
+	return nil
+}
+
+// orderTerms checks that the address of a purchase belongs to the buyer and that its payment
+// mode is active
+func (d *data) orderTerms(purchase *models.Purchase) (*models.PaymentMode, *models.Address, error) {
+	address, ok := d.addresses[purchase.AddressID]
+	if !ok || address.UserID != purchase.UserID {
+		return nil, nil, fmt.Errorf("%w: address %d", store.ErrInvalidAddress, purchase.AddressID)
+	}
+	mode, ok := d.paymentModes[purchase.PaymentID]
+	if !ok || !mode.IsActive {
+		return nil, nil, fmt.Errorf("%w: payment mode %d", store.ErrInvalidPayment, purchase.PaymentID)
+	}
+	return mode, address, nil
+}
+
+// placeOrder checks the address and payment mode of a purchase, reserves its items and stores it
+func (d *data) placeOrder(purchase *models.Purchase) error {
+	mode, address, err := d.orderTerms(purchase)
+	if err != nil {
+		return err
+	}
+
+	// Check every item before touching stock so that a failed order changes nothing
+	ordered := map[int]int{}
+	for _, item := range purchase.Items {
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: quantity %d of product %d weight %d", store.ErrInvalidItem, item.Quantity, item.ProductID, item.ProductWeightID)
+		}
+		weight, ok := d.weights[item.ProductWeightID]
+		if !ok || weight.ProductID != item.ProductID {
+			return fmt.Errorf("%w: product %d has no weight %d", store.ErrInvalidItem, item.ProductID, item.ProductWeightID)
+		}
+		ordered[weight.ID] += item.Quantity
+		if weight.StockAvailability < ordered[weight.ID] {
+			return fmt.Errorf("%w: product %d weight %d", store.ErrOutOfStock, item.ProductID, item.ProductWeightID)
+		}
+	}
+
+	var priced []*models.PurchaseItem
+	total := 0.0
+	for _, item := range purchase.Items {
+		price := d.weights[item.ProductWeightID].Price
+		priced = append(priced, &models.PurchaseItem{
+			ProductID:       item.ProductID,
+			ProductWeightID: item.ProductWeightID,
+			ProductPrice:    price,
+			Quantity:        item.Quantity,
+		})
+		total += price * float64(item.Quantity)
+	}
+	now := time.Now()
+	discounts := d.priceOffers(priced, now)
+	if purchase.DiscountCode != "" {
+		discount, err := d.priceDiscount(purchase.UserID, purchase.DiscountCode, priced, now)
+		if err != nil {
+			return err
+		}
+		discounts = append(discounts, discount)
+	}
+	if !mode.Allows(total-models.TotalDiscount(discounts, total), address.ZipCode) {
+		return fmt.Errorf("%w: payment mode %d is not available for this order", store.ErrInvalidPayment, purchase.PaymentID)
+	}
+	purchase.Discounts = discounts
+
+	purchase.TotalPrice = 0
+	for _, item := range purchase.Items {
+		weight := d.weights[item.ProductWeightID]
+		weight.StockAvailability -= item.Quantity
+
+		item.ID = d.id("purchase_items")
+		item.ProductName = d.products[item.ProductID].Name
+		item.ProductPrice = weight.Price
+		item.Weight = float64(weight.Weight)
+		item.Measurement = weight.Measurement
+		item.TotalPrice = weight.Price * float64(item.Quantity)
+		purchase.TotalPrice += item.TotalPrice
+	}
+	purchase.Discount = models.TotalDiscount(purchase.Discounts, purchase.TotalPrice)
+	purchase.TotalPrice -= purchase.Discount
+
+	purchase.Status = models.PurchaseStatusPendingPayment
+	purchase.ID = d.id("purchases")
+	for _, discount := range purchase.Discounts {
+		if discount.OfferID != 0 {
+			discount.ID = d.id("purchase_offers")
+		} else {
+			discount.ID = d.id("purchase_discounts")
+		}
+		discount.PurchaseID = purchase.ID
+	}
+	for _, item := range purchase.Items {
+		d.recordMovement(&models.StockMovement{
+			ProductWeightID: item.ProductWeightID,
+			MovementType:    models.StockMovementSale,
+			Quantity:        -item.Quantity,
+			PurchaseID:      purchase.ID,
+			ActorID:         purchase.UserID,
+			CreatedAt:       purchase.CreatedAt,
+		})
+	}
+	d.recordStatusChange(&models.PurchaseStatusChange{
+		PurchaseID: purchase.ID,
+		ToStatus:   purchase.Status,
+		ActorID:    purchase.UserID,
+		CreatedAt:  purchase.CreatedAt,
+	})
+
+	stored := *purchase
+	stored.Items = d.purchaseItems(purchase)
+	stored.Discounts = d.purchaseDiscounts(purchase)
+	d.purchases[purchase.ID] = &stored
+	return nil
+}
+
+func (s *orderStore) Get(id int) (*models.Purchase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.purchases[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	purchase := *stored
+	purchase.Items = s.purchaseItems(stored)
+	purchase.Discounts = s.purchaseDiscounts(stored)
+	return &purchase, nil
+}
+
+func (s *orderStore) List(status string) ([]*models.Purchase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listPurchases(func(purchase *models.Purchase) bool {
+		return status == "" || purchase.Status == status
+	}), nil
+}
+
+func (s *orderStore) ListByUser(userID int) ([]*models.Purchase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listPurchases(func(purchase *models.Purchase) bool {
+		return purchase.UserID == userID
+	}), nil
+}
+
+// listPurchases returns copies of the purchases matching the predicate, newest first
+func (d *data) listPurchases(match func(purchase *models.Purchase) bool) []*models.Purchase {
+	var purchases []*models.Purchase
+	keys := sortedKeys(d.purchases)
+	for i := len(keys) - 1; i >= 0; i-- {
+		stored := d.purchases[keys[i]]
+		if !match(stored) {
+			continue
+		}
+		purchase := *stored
+		purchase.Items = d.purchaseItems(stored)
+		purchase.Discounts = d.purchaseDiscounts(stored)
+		purchases = append(purchases, &purchase)
+	}
+	return purchases
+}
+
+func (s *orderStore) Items(purchaseID int) ([]*models.PurchaseItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purchase, ok := s.purchases[purchaseID]
+	if !ok {
+		return nil, nil
+	}
+	return s.purchaseItems(purchase), nil
+}
+
+// purchaseItems returns copies of the items of a purchase
+func (d *data) purchaseItems(purchase *models.Purchase) []*models.PurchaseItem {
+	var items []*models.PurchaseItem
+	for _, stored := range purchase.Items {
+		item := *stored
+		items = append(items, &item)
+	}
+	return items
+}
+
+// purchaseDiscounts returns copies of the discount lines of a purchase
+func (d *data) purchaseDiscounts(purchase *models.Purchase) []*models.PurchaseDiscount {
+	var discounts []*models.PurchaseDiscount
+	for _, stored := range purchase.Discounts {
+		discount := *stored
+		discounts = append(discounts, &discount)
+	}
+	return discounts
+}
+
+func (s *orderStore) UpdateStatus(change *models.PurchaseStatusChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateStatus(change)
+}
+
+// updateStatus moves a purchase to a new status and records the change
+func (d *data) updateStatus(change *models.PurchaseStatusChange) error {
+	purchase, ok := d.purchases[change.PurchaseID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	change.FromStatus = purchase.Status
+	if !models.CanTransitionPurchase(change.FromStatus, change.ToStatus) {
+		return fmt.Errorf("%w: purchase %d is %s", store.ErrInvalidTransition, change.PurchaseID, change.FromStatus)
+	}
+
+	if change.CreatedAt.IsZero() {
+		change.CreatedAt = time.Now()
+	}
+	purchase.Status = change.ToStatus
+	purchase.UpdatedAt = change.CreatedAt
+	d.recordStatusChange(change)
+	return nil
+}
+
+// recordStatusChange stores a copy of a status change and assigns its ID
+func (d *data) recordStatusChange(change *models.PurchaseStatusChange) {
+	change.ID = d.id("purchase_status_history")
+	stored := *change
+	d.statusChanges[change.ID] = &stored
+}
+
+func (s *orderStore) History(purchaseID int) ([]*models.PurchaseStatusChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []*models.PurchaseStatusChange
+	for _, id := range sortedKeys(s.statusChanges) {
+		if stored := s.statusChanges[id]; stored.PurchaseID == purchaseID {
+			change := *stored
+			changes = append(changes, &change)
+		}
+	}
+	return changes, nil
+}
+
+func (s *orderStore) Cancel(change *models.PurchaseStatusChange) ([]*models.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change.ToStatus = models.PurchaseStatusCancelled
+	if err := s.updateStatus(change); err != nil {
+		return nil, err
+	}
+
+	purchase := s.purchases[change.PurchaseID]
+	returned := map[int]int{}
+	for _, item := range purchase.Items {
+		if weight, ok := s.weights[item.ProductWeightID]; ok {
+			weight.StockAvailability += item.Quantity
+			returned[weight.ID] += item.Quantity
+		}
+	}
+	for _, weightID := range sortedKeys(returned) {
+		s.recordMovement(&models.StockMovement{
+			ProductWeightID: weightID,
+			MovementType:    models.StockMovementReturn,
+			Quantity:        returned[weightID],
+			PurchaseID:      purchase.ID,
+			Note:            "Purchase cancelled",
+			ActorID:         change.ActorID,
+			CreatedAt:       change.CreatedAt,
+		})
+	}
+
+	var refunds []*models.Refund
+	for _, id := range sortedKeys(s.payments) {
+		payment := s.payments[id]
+		if payment.PurchaseID != purchase.ID || payment.Status != models.PaymentStatusCaptured {
+			continue
+		}
+		left := payment.Amount - s.refundedOf(payment.ID)
+		if left < refundTolerance {
+			continue
+		}
+		refund := &models.Refund{
+			PurchaseID: purchase.ID,
+			PaymentID:  payment.ID,
+			Amount:     left,
+			Status:     models.RefundStatusPending,
+			Reason:     change.Note,
+			CreatedAt:  change.CreatedAt,
+			UpdatedAt:  change.CreatedAt,
+		}
+		s.insertRefund(refund)
+		refunds = append(refunds, refund)
+	}
+	return refunds, nil
+}
+
+// insertRefund stores a copy of a refund, assigns its ID and adds it to the
+// refunded total of its purchase
+func (d *data) insertRefund(refund *models.Refund) {
+	refund.ID = d.id("refunds")
+	d.refunds[refund.ID] = copyRefund(refund)
+	if purchase, ok := d.purchases[refund.PurchaseID]; ok {
+		purchase.RefundedAmount += refund.Amount
+	}
+}
@@ -0,0 +1,117 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type otpStore struct {
+	*data
+}
+
+func (s *otpStore) Issue(otp *models.OTP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.otps {
+		if stored.UserID == otp.UserID && stored.Purpose == otp.Purpose && stored.ConsumedAt == nil {
+			consumedAt := otp.GeneratedAt
+			stored.ConsumedAt = &consumedAt
+		}
+	}
+
+	otp.ID = s.id("otp")
+	stored := *otp
+	s.otps[otp.ID] = &stored
+	return nil
+}
+
+func (s *otpStore) Latest(userID int, purpose string) (*models.OTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := sortedKeys(s.otps)
+	for i := len(keys) - 1; i >= 0; i-- {
+		otp := s.otps[keys[i]]
+		if otp.UserID == userID && otp.Purpose == purpose && otp.ConsumedAt == nil {
+			copied := *otp
+			return &copied, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *otpStore) CountAttempt(id, maxAttempts int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	otp, ok := s.otps[id]
+	if !ok || otp.ConsumedAt != nil || otp.Attempts >= maxAttempts {
+		return false, nil
+	}
+	otp.Attempts++
+	return true, nil
+}
+
+func (s *otpStore) Consume(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	otp, ok := s.otps[id]
+	if !ok || otp.ConsumedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	otp.ConsumedAt = &now
+	return true, nil
+}
+
+func (s *otpStore) SendTimes(userID int, purpose string, limit int) ([]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sentAt []time.Time
+	keys := sortedKeys(s.otps)
+	for i := len(keys) - 1; i >= 0 && len(sentAt) < limit; i-- {
+		if otp := s.otps[keys[i]]; otp.UserID == userID && otp.Purpose == purpose {
+			sentAt = append(sentAt, otp.GeneratedAt)
+		}
+	}
+	return sentAt, nil
+}
+
+func (s *otpStore) CountCheck(userID, maxFailures int, now, lockUntil time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.users[userID]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	if !row.otpLockedUntil.IsZero() && row.otpLockedUntil.After(now) {
+		return 0, store.ErrLockedOut
+	}
+	if row.otpLockedUntil.IsZero() {
+		row.otpFailures++
+	} else {
+		row.otpFailures = 1
+	}
+	row.otpLockedUntil = time.Time{}
+	if row.otpFailures >= maxFailures {
+		row.otpLockedUntil = lockUntil
+	}
+	return row.otpFailures, nil
+}
+
+func (s *otpStore) ClearFailures(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if row, ok := s.users[userID]; ok {
+		row.otpFailures = 0
+		row.otpLockedUntil = time.Time{}
+	}
+	return nil
+}
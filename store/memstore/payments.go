@@ -0,0 +1,213 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type paymentStore struct {
+	*data
+}
+
+func (s *paymentStore) ListModes() ([]*models.PaymentMode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var modes []*models.PaymentMode
+	for _, id := range sortedKeys(s.paymentModes) {
+		mode := *s.paymentModes[id]
+		modes = append(modes, &mode)
+	}
+	return modes, nil
+}
+
+func (s *paymentStore) GetMode(id int) (*models.PaymentMode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mode, ok := s.paymentModes[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *mode
+	return &copied, nil
+}
+
+func (s *paymentStore) CreateMode(mode *models.PaymentMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *mode
+	stored.ID = s.id("payment_mode")
+	stored.AllowedPincodes = append([]string{}, mode.AllowedPincodes...)
+	s.paymentModes[stored.ID] = &stored
+	mode.ID = stored.ID
+	return nil
+}
+
+func (s *paymentStore) UpdateMode(mode *models.PaymentMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.paymentModes[mode.ID]; !ok {
+		return store.ErrNotFound
+	}
+	stored := *mode
+	stored.AllowedPincodes = append([]string{}, mode.AllowedPincodes...)
+	s.paymentModes[mode.ID] = &stored
+	return nil
+}
+
+func (s *paymentStore) DeleteMode(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.paymentModes[id]; !ok {
+		return store.ErrNotFound
+	}
+	for _, purchase := range s.purchases {
+		if purchase.PaymentID == id {
+			return store.ErrModeInUse
+		}
+	}
+	delete(s.paymentModes, id)
+	return nil
+}
+
+func (s *paymentStore) Create(payment *models.Payment) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if payment.Status == models.PaymentStatusCreated {
+		keys := sortedKeys(s.payments)
+		for i := len(keys) - 1; i >= 0; i-- {
+			open := s.payments[keys[i]]
+			if open.PurchaseID == payment.PurchaseID && open.Provider == payment.Provider && open.Status == models.PaymentStatusCreated {
+				*payment = *open
+				return false, nil
+			}
+		}
+	}
+
+	if payment.Status == models.PaymentStatusPending {
+		err := s.updateStatus(&models.PurchaseStatusChange{
+			PurchaseID: payment.PurchaseID,
+			ToStatus:   models.PurchaseStatusConfirmed,
+			Note:       "Payment collected on delivery",
+			CreatedAt:  payment.CreatedAt,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	payment.ID = s.id("payments")
+	stored := *payment
+	s.payments[payment.ID] = &stored
+	return true, nil
+}
+
+func (s *paymentStore) Get(id int) (*models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *payment
+	return &copied, nil
+}
+
+func (s *paymentStore) GetByProviderOrder(provider, providerOrderID string) (*models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, payment := range s.payments {
+		if payment.Provider == provider && payment.ProviderOrderID == providerOrderID {
+			copied := *payment
+			return &copied, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *paymentStore) ListByPurchase(purchaseID int) ([]*models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var payments []*models.Payment
+	for _, id := range sortedKeys(s.payments) {
+		if payment := s.payments[id]; payment.PurchaseID == purchaseID {
+			copied := *payment
+			payments = append(payments, &copied)
+		}
+	}
+	return payments, nil
+}
+
+func (s *paymentStore) Capture(id int, providerPaymentID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[id]
+	if !ok || (payment.Status != models.PaymentStatusCreated && payment.Status != models.PaymentStatusFailed) {
+		return false, nil
+	}
+
+	now := time.Now()
+	payment.Status = models.PaymentStatusCaptured
+	payment.ProviderPaymentID = providerPaymentID
+	payment.UpdatedAt = now
+
+	purchase, ok := s.purchases[payment.PurchaseID]
+	if !ok {
+		return true, nil
+	}
+	switch purchase.Status {
+	case models.PurchaseStatusPendingPayment:
+		return true, s.updateStatus(&models.PurchaseStatusChange{
+			PurchaseID: payment.PurchaseID,
+			ToStatus:   models.PurchaseStatusConfirmed,
+			Note:       "Payment captured",
+			CreatedAt:  now,
+		})
+	case models.PurchaseStatusCancelled:
+		s.insertRefund(&models.Refund{
+			PurchaseID: payment.PurchaseID,
+			PaymentID:  payment.ID,
+			Amount:     payment.Amount,
+			Status:     models.RefundStatusPending,
+			Reason:     "Payment captured after the purchase was cancelled",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+	default:
+		// The purchase was already paid for, by another payment or on delivery
+		s.insertRefund(&models.Refund{
+			PurchaseID: payment.PurchaseID,
+			PaymentID:  payment.ID,
+			Amount:     payment.Amount,
+			Status:     models.RefundStatusPending,
+			Reason:     "Purchase was already paid for",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+	}
+	return true, nil
+}
+
+func (s *paymentStore) Fail(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[id]
+	if !ok || payment.Status != models.PaymentStatusCreated {
+		return false, nil
+	}
+	payment.Status = models.PaymentStatusFailed
+	payment.UpdatedAt = time.Now()
+	return true, nil
+}
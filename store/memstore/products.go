@@ -0,0 +1,206 @@
+package memstore
+
+import (
+	"math"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type productStore struct {
+	*data
+}
+
+// copyProduct returns a copy of a stored product with copies of its weights
+func (d *data) copyProduct(p *models.Product) *models.Product {
+	product := *p
+	product.ImageURLs = append([]string(nil), p.ImageURLs...)
+	product.Weights = nil
+	for _, id := range sortedKeys(d.weights) {
+		if w := d.weights[id]; w.ProductID == p.ID {
+			weight := *w
+			product.Weights = append(product.Weights, &weight)
+		}
+	}
+
+	total := 0
+	product.AverageRating, product.ReviewCount = 0, 0
+	for _, review := range d.reviews {
+		if review.ProductID == p.ID && review.Status == models.ReviewStatusPublished {
+			total += review.Rating
+			product.ReviewCount++
+		}
+	}
+	if product.ReviewCount > 0 {
+		product.AverageRating = math.Round(float64(total)/float64(product.ReviewCount)*100) / 100
+	}
+	return &product
+}
+
+func (s *productStore) List() ([]*models.Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var products []*models.Product
+	for _, id := range sortedKeys(s.products) {
+		products = append(products, s.copyProduct(s.products[id]))
+	}
+	return products, nil
+}
+
+func (s *productStore) Get(id int) (*models.Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product, ok := s.products[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return s.copyProduct(product), nil
+}
+
+func (s *productStore) Create(product *models.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product.ID = s.id("products")
+	stored := *product
+	stored.ImageURLs = append([]string(nil), product.ImageURLs...)
+	stored.Weights = nil
+	s.products[product.ID] = &stored
+
+	for _, weight := range product.Weights {
+		weight.ProductID = product.ID
+		s.insertWeight(weight)
+	}
+	return nil
+}
+
+func (s *productStore) Update(product *models.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.products[product.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	stored.Name = product.Name
+	stored.Description = product.Description
+	stored.Category = product.Category
+	stored.Ingredients = product.Ingredients
+	stored.NutritionalInfo = product.NutritionalInfo
+	stored.ImageURLs = append([]string(nil), product.ImageURLs...)
+	stored.UpdatedAt = product.UpdatedAt
+
+	for _, weight := range product.Weights {
+		weight.ProductID = product.ID
+
+		updated := false
+		for _, w := range s.weights {
+			if w.ProductID == weight.ProductID && w.Weight == weight.Weight {
+				w.Price = weight.Price
+				s.setStock(w, weight.StockAvailability, "Stock set with the product")
+				w.UpdatedAt = weight.UpdatedAt
+				updated = true
+			}
+		}
+		if !updated {
+			s.insertWeight(weight)
+		}
+	}
+	return nil
+}
+
+func (s *productStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for weightID, weight := range s.weights {
+		if weight.ProductID == id {
+			delete(s.weights, weightID)
+			delete(s.stockSettings, weightID)
+		}
+	}
+	for reviewID, review := range s.reviews {
+		if review.ProductID == id {
+			delete(s.reviews, reviewID)
+		}
+	}
+	delete(s.products, id)
+	return nil
+}
+
+func (s *productStore) GetWeight(id int) (*models.ProductWeight, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	weight, ok := s.weights[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *weight
+	return &copied, nil
+}
+
+func (s *productStore) CreateWeight(weight *models.ProductWeight) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insertWeight(weight)
+	return nil
+}
+
+func (s *productStore) UpdateWeight(weight *models.ProductWeight) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.weights[weight.ID]
+	if !ok || stored.ProductID != weight.ProductID {
+		return store.ErrNotFound
+	}
+	stored.Weight = weight.Weight
+	stored.Price = weight.Price
+	s.setStock(stored, weight.StockAvailability, "Stock set with the variant")
+	stored.Measurement = weight.Measurement
+	stored.UpdatedAt = weight.UpdatedAt
+	return nil
+}
+
+func (s *productStore) ReplaceWeight(id int, weight *models.ProductWeight) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.weights[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	s.setStock(stored, 0, "Variant replaced")
+	delete(s.weights, id)
+	delete(s.stockSettings, id)
+	s.insertWeight(weight)
+	return nil
+}
+
+// insertWeight stores a copy of a weight variant, assigns its ID and records its initial stock
+func (d *data) insertWeight(weight *models.ProductWeight) {
+	if weight.CreatedAt.IsZero() {
+		weight.CreatedAt = time.Now()
+	}
+	if weight.UpdatedAt.IsZero() {
+		weight.UpdatedAt = weight.CreatedAt
+	}
+
+	weight.ID = d.id("product_weights")
+	stored := *weight
+	d.weights[weight.ID] = &stored
+	if weight.StockAvailability != 0 {
+		d.recordMovement(&models.StockMovement{
+			ProductWeightID: weight.ID,
+			MovementType:    models.StockMovementAdjustment,
+			Quantity:        weight.StockAvailability,
+			Note:            "Initial stock",
+			CreatedAt:       weight.CreatedAt,
+		})
+	}
+}
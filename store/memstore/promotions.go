@@ -0,0 +1,168 @@
+package memstore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type promotionStore struct {
+	*data
+}
+
+func (s *promotionStore) Create(promotion *models.Promotion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	promotion.PromotionID = s.id("promotions")
+	stored := *promotion
+	s.promotions[promotion.PromotionID] = &stored
+	return nil
+}
+
+func (s *promotionStore) Get(id int) (*models.Promotion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	promotion, ok := s.promotions[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *promotion
+	return &copied, nil
+}
+
+func (s *promotionStore) GetByCode(code string) (*models.Promotion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	promotion := s.promotionByCode(code)
+	if promotion == nil {
+		return nil, store.ErrNotFound
+	}
+	copied := *promotion
+	return &copied, nil
+}
+
+// promotionByCode returns the promotion with a discount code, in any case, or nil
+func (d *data) promotionByCode(code string) *models.Promotion {
+	code = models.NormalizeDiscountCode(code)
+	for _, promotion := range d.promotions {
+		if promotion.DiscountCode == code {
+			return promotion
+		}
+	}
+	return nil
+}
+
+func (s *promotionStore) List() ([]*models.Promotion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var promotions []*models.Promotion
+	for _, id := range sortedKeys(s.promotions) {
+		promotion := *s.promotions[id]
+		promotions = append(promotions, &promotion)
+	}
+	return promotions, nil
+}
+
+func (s *promotionStore) Update(promotion *models.Promotion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.promotions[promotion.PromotionID]; !ok {
+		return store.ErrNotFound
+	}
+	stored := *promotion
+	s.promotions[promotion.PromotionID] = &stored
+	return nil
+}
+
+func (s *promotionStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.promotions[id]; !ok {
+		return store.ErrNotFound
+	}
+	for _, purchase := range s.purchases {
+		for _, discount := range purchase.Discounts {
+			if discount.PromotionID == id {
+				return store.ErrPromotionInUse
+			}
+		}
+	}
+	delete(s.promotions, id)
+	return nil
+}
+
+func (s *promotionStore) Quote(userID int, code string, items []*models.PurchaseItem) (*models.PurchaseDiscount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.priceDiscount(userID, code, items, time.Now())
+}
+
+// priceDiscount checks that a discount code can be applied to an order of items by
+// userID at now and returns the discount line it gives
+func (d *data) priceDiscount(userID int, code string, items []*models.PurchaseItem, now time.Time) (*models.PurchaseDiscount, error) {
+	promotion := d.promotionByCode(code)
+	if promotion == nil || !promotion.IsActive {
+		return nil, fmt.Errorf("%w: unknown discount code %s", store.ErrInvalidPromotion, code)
+	}
+	if !promotion.StartDate.IsZero() && now.Before(promotion.StartDate) {
+		return nil, fmt.Errorf("%w: %s is not valid yet", store.ErrInvalidPromotion, promotion.DiscountCode)
+	}
+	if !promotion.EndDate.IsZero() && now.After(promotion.EndDate) {
+		return nil, fmt.Errorf("%w: %s has expired", store.ErrInvalidPromotion, promotion.DiscountCode)
+	}
+
+	subtotal, eligible := 0.0, 0.0
+	for _, item := range items {
+		price := item.ProductPrice * float64(item.Quantity)
+		subtotal += price
+
+		// Products removed since have no category
+		category := ""
+		if product, ok := d.products[item.ProductID]; ok {
+			category = product.Category
+		}
+		if promotion.Applies(item.ProductID, category) {
+			eligible += price
+		}
+	}
+	if subtotal < promotion.MinOrderValue {
+		return nil, fmt.Errorf("%w: %s needs an order of at least %.2f", store.ErrInvalidPromotion, promotion.DiscountCode, promotion.MinOrderValue)
+	}
+	if eligible == 0 {
+		return nil, fmt.Errorf("%w: %s does not apply to these items", store.ErrInvalidPromotion, promotion.DiscountCode)
+	}
+
+	if promotion.UsageLimitPerUser > 0 {
+		// Cancelled and refunded orders give the use back
+		used := 0
+		for _, purchase := range d.purchases {
+			if purchase.UserID != userID || purchase.Status == models.PurchaseStatusCancelled || purchase.Status == models.PurchaseStatusRefunded {
+				continue
+			}
+			for _, discount := range purchase.Discounts {
+				if discount.PromotionID == promotion.PromotionID {
+					used++
+				}
+			}
+		}
+		if used >= promotion.UsageLimitPerUser {
+			return nil, fmt.Errorf("%w: %s was already used", store.ErrInvalidPromotion, promotion.DiscountCode)
+		}
+	}
+
+	return &models.PurchaseDiscount{
+		PromotionID:  promotion.PromotionID,
+		DiscountCode: promotion.DiscountCode,
+		Description:  promotion.Description(),
+		Amount:       promotion.DiscountOn(eligible),
+	}, nil
+}
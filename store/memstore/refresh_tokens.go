@@ -0,0 +1,71 @@
+package memstore
+
+import (
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type refreshTokenStore struct {
+	*data
+}
+
+func (s *refreshTokenStore) Create(token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token.ID = s.id("refresh_tokens")
+	stored := *token
+	s.refreshTokens[token.ID] = &stored
+	return nil
+}
+
+func (s *refreshTokenStore) Get(tokenHash string) (*models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.refreshTokens {
+		if token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *refreshTokenStore) MarkRotated(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.refreshTokens[id]
+	if !ok || token.RotatedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.RotatedAt = &now
+	return true, nil
+}
+
+func (s *refreshTokenStore) RevokeFamily(familyID string) error {
+	return s.revoke(func(token *models.RefreshToken) bool { return token.FamilyID == familyID })
+}
+
+func (s *refreshTokenStore) RevokeUser(userID int) error {
+	return s.revoke(func(token *models.RefreshToken) bool { return token.UserID == userID })
+}
+
+// revoke revokes the tokens matching the predicate that are not revoked yet
+func (s *refreshTokenStore) revoke(match func(token *models.RefreshToken) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range s.refreshTokens {
+		if match(token) && token.RevokedAt == nil {
+			revokedAt := now
+			token.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package memstore
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+// refundTolerance absorbs the rounding of amounts summed from prices
+const refundTolerance = 0.005
+
+type refundStore struct {
+	*data
+}
+
+// copyRefund returns a copy of a refund and its items
+func copyRefund(refund *models.Refund) *models.Refund {
+	copied := *refund
+	copied.Items = nil
+	for _, item := range refund.Items {
+		copiedItem := *item
+		copied.Items = append(copied.Items, &copiedItem)
+	}
+	return &copied
+}
+
+func (s *refundStore) Create(refund *models.Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purchase, ok := s.purchases[refund.PurchaseID]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	if len(refund.Items) > 0 {
+		// Check every item before pricing any so that a failed refund changes nothing
+		refunded := s.refundedQuantities()
+		amount := 0.0
+		prices := make([]float64, len(refund.Items))
+		for i, item := range refund.Items {
+			var bought *models.PurchaseItem
+			for _, purchaseItem := range purchase.Items {
+				if purchaseItem.ID == item.PurchaseItemID {
+					bought = purchaseItem
+				}
+			}
+			if bought == nil {
+				return fmt.Errorf("%w: purchase %d has no item %d", store.ErrInvalidItem, purchase.ID, item.PurchaseItemID)
+			}
+			if item.Quantity <= 0 || refunded[item.PurchaseItemID]+item.Quantity > bought.Quantity {
+				return fmt.Errorf("%w: %d of item %d refunded, %d more requested, %d bought", store.ErrInvalidItem, refunded[item.PurchaseItemID], item.PurchaseItemID, item.Quantity, bought.Quantity)
+			}
+			prices[i] = models.RefundItemAmount(purchase.Items, purchase.Discount, item.PurchaseItemID, refunded[item.PurchaseItemID], item.Quantity)
+			refunded[item.PurchaseItemID] += item.Quantity
+			amount += prices[i]
+		}
+		for i, item := range refund.Items {
+			item.Amount = prices[i]
+		}
+		refund.Amount = math.Round(amount*100) / 100
+	}
+
+	paymentID, paid := 0, 0.0
+	for _, payment := range s.paidPayments(purchase) {
+		paid += payment.Amount
+		left := payment.Amount - s.refundedOf(payment.ID)
+		if left < refundTolerance {
+			continue
+		}
+		if refund.Amount == 0 {
+			refund.Amount = left
+		}
+		if paymentID == 0 && refund.Amount <= left+refundTolerance {
+			paymentID = payment.ID
+		}
+	}
+	if paymentID == 0 {
+		return fmt.Errorf("%w: purchase %d", store.ErrOverRefund, purchase.ID)
+	}
+	if purchase.RefundedAmount+refund.Amount >= paid-refundTolerance && !models.CanTransitionPurchase(purchase.Status, models.PurchaseStatusRefunded) {
+		return fmt.Errorf("%w: purchase %d is %s", store.ErrFullRefund, purchase.ID, purchase.Status)
+	}
+
+	refund.PaymentID = paymentID
+	refund.Status = models.RefundStatusPending
+	if refund.CreatedAt.IsZero() {
+		refund.CreatedAt = time.Now()
+	}
+	refund.UpdatedAt = refund.CreatedAt
+	s.insertRefund(refund)
+	return nil
+}
+
+// paidPayments returns the payments of a purchase that were paid, oldest first: the
+// captured ones, and those collected on delivery once it is delivered
+func (d *data) paidPayments(purchase *models.Purchase) []*models.Payment {
+	delivered := purchase.Status == models.PurchaseStatusDelivered || purchase.Status == models.PurchaseStatusRefunded
+	var paid []*models.Payment
+	for _, id := range sortedKeys(d.payments) {
+		payment := d.payments[id]
+		if payment.PurchaseID != purchase.ID {
+			continue
+		}
+		if payment.Status == models.PaymentStatusCaptured || (payment.Status == models.PaymentStatusPending && delivered) {
+			paid = append(paid, payment)
+		}
+	}
+	return paid
+}
+
+// refundedOf returns the total refunded through a payment
+func (d *data) refundedOf(paymentID int) float64 {
+	total := 0.0
+	for _, refund := range d.refunds {
+		if refund.PaymentID == paymentID {
+			total += refund.Amount
+		}
+	}
+	return total
+}
+
+// refundedQuantities returns the quantities refunded of each purchase item
+func (d *data) refundedQuantities() map[int]int {
+	quantities := map[int]int{}
+	for _, refund := range d.refunds {
+		for _, item := range refund.Items {
+			quantities[item.PurchaseItemID] += item.Quantity
+		}
+	}
+	return quantities
+}
+
+func (s *refundStore) Get(id int) (*models.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refund, ok := s.refunds[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return copyRefund(refund), nil
+}
+
+func (s *refundStore) ListByPurchase(purchaseID int) ([]*models.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var refunds []*models.Refund
+	for _, id := range sortedKeys(s.refunds) {
+		if refund := s.refunds[id]; refund.PurchaseID == purchaseID {
+			refunds = append(refunds, copyRefund(refund))
+		}
+	}
+	return refunds, nil
+}
+
+func (s *refundStore) StartProcessing(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refund, ok := s.refunds[id]
+	if !ok || refund.Status != models.RefundStatusPending {
+		return false, nil
+	}
+	refund.Status = models.RefundStatusProcessing
+	refund.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (s *refundStore) Release(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refund, ok := s.refunds[id]
+	if !ok || refund.Status != models.RefundStatusProcessing {
+		return store.ErrNotFound
+	}
+	refund.Status = models.RefundStatusPending
+	refund.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *refundStore) Complete(id int, providerRefundID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refund, ok := s.refunds[id]
+	if !ok || refund.Status != models.RefundStatusProcessing {
+		return store.ErrNotFound
+	}
+	now := time.Now()
+	refund.Status = models.RefundStatusProcessed
+	refund.ProviderRefundID = providerRefundID
+	refund.UpdatedAt = now
+
+	purchase, ok := s.purchases[refund.PurchaseID]
+	if !ok {
+		return nil
+	}
+	paid, refunded := 0.0, 0.0
+	for _, payment := range s.paidPayments(purchase) {
+		paid += payment.Amount
+	}
+	for _, other := range s.refunds {
+		if other.PurchaseID == purchase.ID && other.Status == models.RefundStatusProcessed {
+			refunded += other.Amount
+		}
+	}
+	if paid > 0 && refunded >= paid-refundTolerance && models.CanTransitionPurchase(purchase.Status, models.PurchaseStatusRefunded) {
+		return s.updateStatus(&models.PurchaseStatusChange{
+			PurchaseID: purchase.ID,
+			ToStatus:   models.PurchaseStatusRefunded,
+			Note:       "Refunded in full",
+			CreatedAt:  now,
+		})
+	}
+	return nil
+}
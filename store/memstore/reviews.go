@@ -0,0 +1,113 @@
+package memstore
+
+import (
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type reviewStore struct {
+	*data
+}
+
+func (s *reviewStore) Create(review *models.Review) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.reviews {
+		if stored.ProductID == review.ProductID && stored.UserID == review.UserID {
+			return false, nil
+		}
+	}
+
+	review.ReviewID = s.id("reviews")
+	stored := *review
+	s.reviews[review.ReviewID] = &stored
+	return true, nil
+}
+
+func (s *reviewStore) Get(id int) (*models.Review, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	review, ok := s.reviews[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *review
+	return &copied, nil
+}
+
+func (s *reviewStore) ListByProduct(productID int, status string) ([]*models.Review, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listReviews(func(review *models.Review) bool {
+		return review.ProductID == productID && (status == "" || review.Status == status)
+	}), nil
+}
+
+func (s *reviewStore) List(status string) ([]*models.Review, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listReviews(func(review *models.Review) bool {
+		return status == "" || review.Status == status
+	}), nil
+}
+
+// listReviews returns copies of the reviews matching the predicate, newest first
+func (d *data) listReviews(match func(review *models.Review) bool) []*models.Review {
+	var reviews []*models.Review
+	keys := sortedKeys(d.reviews)
+	for i := len(keys) - 1; i >= 0; i-- {
+		if review := d.reviews[keys[i]]; match(review) {
+			copied := *review
+			reviews = append(reviews, &copied)
+		}
+	}
+	return reviews
+}
+
+func (s *reviewStore) Update(review *models.Review) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.reviews[review.ReviewID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	stored.Rating = review.Rating
+	stored.ReviewText = review.ReviewText
+	stored.Status = review.Status
+	stored.ModerationNote = review.ModerationNote
+	stored.UpdatedAt = review.UpdatedAt
+	return nil
+}
+
+func (s *reviewStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reviews[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.reviews, id)
+	return nil
+}
+
+func (s *reviewStore) HasPurchased(userID, productID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, purchase := range s.purchases {
+		if purchase.UserID != userID || purchase.Status != models.PurchaseStatusDelivered {
+			continue
+		}
+		for _, item := range purchase.Items {
+			if item.ProductID == productID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,77 @@
+package memstore
+
+import (
+	"sort"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type supplierStore struct {
+	*data
+}
+
+func (s *supplierStore) Create(supplier *models.Supplier) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	supplier.SupplierID = s.id("suppliers")
+	stored := *supplier
+	s.suppliers[supplier.SupplierID] = &stored
+	return nil
+}
+
+func (s *supplierStore) Get(id int) (*models.Supplier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	supplier, ok := s.suppliers[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *supplier
+	return &copied, nil
+}
+
+func (s *supplierStore) List() ([]*models.Supplier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var suppliers []*models.Supplier
+	for _, id := range sortedKeys(s.suppliers) {
+		supplier := *s.suppliers[id]
+		suppliers = append(suppliers, &supplier)
+	}
+	sort.SliceStable(suppliers, func(i, j int) bool {
+		return suppliers[i].Name < suppliers[j].Name
+	})
+	return suppliers, nil
+}
+
+func (s *supplierStore) Update(supplier *models.Supplier) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.suppliers[supplier.SupplierID]; !ok {
+		return store.ErrNotFound
+	}
+	stored := *supplier
+	s.suppliers[supplier.SupplierID] = &stored
+	return nil
+}
+
+func (s *supplierStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.suppliers[id]; !ok {
+		return store.ErrNotFound
+	}
+	for weightID, settings := range s.stockSettings {
+		if _, ok := s.weights[weightID]; ok && settings.SupplierID == id {
+			return store.ErrSupplierInUse
+		}
+	}
+	delete(s.suppliers, id)
+	return nil
+}
@@ -0,0 +1,176 @@
+package memstore
+
+import (
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+type userStore struct {
+	*data
+}
+
+// copyUser returns a copy of a stored user without addresses
+func copyUser(row *userRow) *models.User {
+	user := row.user
+	user.Address = nil
+	return &user
+}
+
+func (s *userStore) Create(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.UserID = s.id("users")
+	stored := *user
+	stored.Address = nil
+	if stored.Role == "" {
+		stored.Role = "customer"
+	}
+	s.users[user.UserID] = &userRow{user: stored}
+
+	s.insertUserAddresses(user)
+	return nil
+}
+
+// insertUserAddresses stores the addresses given with a user
+func (d *data) insertUserAddresses(user *models.User) {
+	if user.Address == nil {
+		return
+	}
+	for _, address := range *user.Address {
+		address.UserID = user.UserID
+		d.insertAddress(address)
+	}
+}
+
+func (s *userStore) Get(id int) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.users[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	user := copyUser(row)
+	if addresses := s.userAddresses(id); len(addresses) > 0 {
+		user.Address = &addresses
+	}
+	return user, nil
+}
+
+func (s *userStore) GetByEmail(email string) (*models.User, error) {
+	return s.find(func(user *models.User) bool { return user.Email == email })
+}
+
+func (s *userStore) GetByContactNumber(contactNumber string) (*models.User, error) {
+	return s.find(func(user *models.User) bool { return user.ContactNumber == contactNumber })
+}
+
+func (s *userStore) ContactNumberExists(contactNumber string) (bool, error) {
+	_, err := s.GetByContactNumber(contactNumber)
+	if err == store.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// find returns the first user, by ID, matching the predicate
+func (s *userStore) find(match func(user *models.User) bool) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range sortedKeys(s.users) {
+		if row := s.users[id]; match(&row.user) {
+			return copyUser(row), nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *userStore) Update(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.users[user.UserID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	row.user.FirstName = user.FirstName
+	row.user.LastName = user.LastName
+	row.user.Email = user.Email
+	row.user.ContactNumber = user.ContactNumber
+
+	for id, address := range s.addresses {
+		if address.UserID == user.UserID {
+			delete(s.addresses, id)
+		}
+	}
+	s.insertUserAddresses(user)
+	return nil
+}
+
+func (s *userStore) UpdatePassword(id int, passwordHash string) error {
+	return s.update(id, func(row *userRow) { row.user.Password = passwordHash })
+}
+
+func (s *userStore) SetVerified(id int, verified bool) error {
+	return s.update(id, func(row *userRow) { row.user.VerifiedAccount = verified })
+}
+
+func (s *userStore) SetRole(id int, role string) error {
+	return s.update(id, func(row *userRow) { row.user.Role = role })
+}
+
+// update changes a stored user, returning ErrNotFound when there is none
+func (s *userStore) update(id int, change func(row *userRow)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	change(row)
+	return nil
+}
+
+func (s *userStore) Role(id int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.users[id]
+	if !ok {
+		return "", store.ErrNotFound
+	}
+	return row.user.Role, nil
+}
+
+func (s *userStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenID, token := range s.refreshTokens {
+		if token.UserID == id {
+			delete(s.refreshTokens, tokenID)
+		}
+	}
+	for otpID, otp := range s.otps {
+		if otp.UserID == id {
+			delete(s.otps, otpID)
+		}
+	}
+	s.clearCart(id)
+	for itemID, item := range s.wishlist {
+		if item.UserID == id {
+			delete(s.wishlist, itemID)
+		}
+	}
+	for addressID, address := range s.addresses {
+		if address.UserID == id {
+			delete(s.addresses, addressID)
+		}
+	}
+	delete(s.users, id)
+	return nil
+}
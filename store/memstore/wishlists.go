@@ -0,0 +1,66 @@
+package memstore
+
+import (
+	"github.com/gklps/mittai-backend/models"
+)
+
+type wishlistStore struct {
+	*data
+}
+
+func (s *wishlistStore) Add(item *models.Wishlist) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.contains(item.UserID, item.ProductID) {
+		return false, nil
+	}
+
+	item.ID = s.id("wishlist")
+	stored := *item
+	s.wishlist[item.ID] = &stored
+	return true, nil
+}
+
+func (s *wishlistStore) Remove(userID, productID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, item := range s.wishlist {
+		if item.UserID == userID && item.ProductID == productID {
+			delete(s.wishlist, id)
+		}
+	}
+	return nil
+}
+
+func (s *wishlistStore) ListByUser(userID int) ([]*models.Wishlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []*models.Wishlist
+	for _, id := range sortedKeys(s.wishlist) {
+		if item := s.wishlist[id]; item.UserID == userID {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	return items, nil
+}
+
+func (s *wishlistStore) Contains(userID, productID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.contains(userID, productID), nil
+}
+
+// contains reports whether the product is in the user's wishlist
+func (s *wishlistStore) contains(userID, productID int) bool {
+	for _, item := range s.wishlist {
+		if item.UserID == userID && item.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
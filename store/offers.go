@@ -0,0 +1,246 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// ErrOfferInUse is returned when deleting an offer that purchases were discounted with
+var ErrOfferInUse = errors.New("offer is in use")
+
+// OfferStore stores the offers applied automatically to carts and orders
+type OfferStore interface {
+	// Create stores an offer with its tiers, assigning its ID
+	Create(offer *models.Offer) error
+	// Get returns an offer with its tiers
+	Get(id int) (*models.Offer, error)
+	// List returns every offer with its tiers, by priority
+	List() ([]*models.Offer, error)
+	// Update changes an offer and replaces its tiers
+	Update(offer *models.Offer) error
+	// Delete removes an offer. It returns ErrOfferInUse when purchases were discounted with it.
+	Delete(id int) error
+	// Price returns the discount lines the offers running now give on items, the way
+	// placing the order would. Only ProductWeightID, ProductPrice and Quantity of the
+	// items are read.
+	Price(items []*models.PurchaseItem) ([]*models.PurchaseDiscount, error)
+}
+
+const offerColumns = `offer_id, name, offer_type, buy_product_weight_id, buy_quantity, get_product_weight_id, get_quantity,
+	priority, stackable, start_date, end_date, is_active, created_at, updated_at`
+
+// querier runs queries, on the database or within a transaction
+type querier interface {
+	queryRower
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type sqlOfferStore struct {
+	db *db.Repository
+}
+
+func scanOffer(row scanner) (*models.Offer, error) {
+	offer := &models.Offer{}
+	var startDate, endDate sql.NullTime
+	err := row.Scan(&offer.OfferID, &offer.Name, &offer.OfferType, &offer.BuyProductWeightID, &offer.BuyQuantity,
+		&offer.GetProductWeightID, &offer.GetQuantity, &offer.Priority, &offer.Stackable, &startDate, &endDate,
+		&offer.IsActive, &offer.CreatedAt, &offer.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	offer.StartDate = startDate.Time
+	offer.EndDate = endDate.Time
+	return offer, nil
+}
+
+func (s *sqlOfferStore) Create(offer *models.Offer) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO offers (name, offer_type, buy_product_weight_id, buy_quantity, get_product_weight_id, get_quantity,
+			priority, stackable, start_date, end_date, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := tx.InsertReturningID(query, "offer_id", offer.Name, offer.OfferType, offer.BuyProductWeightID, offer.BuyQuantity,
+		offer.GetProductWeightID, offer.GetQuantity, offer.Priority, offer.Stackable, nullTime(offer.StartDate),
+		nullTime(offer.EndDate), offer.IsActive, offer.CreatedAt, offer.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	offer.OfferID = int(id)
+
+	if err := insertTiers(tx, offer); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertTiers stores the tiers of an offer
+func insertTiers(tx *db.Tx, offer *models.Offer) error {
+	for _, tier := range offer.Tiers {
+		_, err := tx.Exec(`INSERT INTO offer_tiers (offer_id, min_order_value, discount_percentage, discount_amount) VALUES (?, ?, ?, ?)`,
+			offer.OfferID, tier.MinOrderValue, tier.DiscountPercentage, tier.DiscountAmount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlOfferStore) Get(id int) (*models.Offer, error) {
+	offer, err := scanOffer(s.db.QueryRow(`SELECT `+offerColumns+` FROM offers WHERE offer_id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	offer.Tiers, err = offerTiers(s.db, offer.OfferID)
+	if err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+func (s *sqlOfferStore) List() ([]*models.Offer, error) {
+	return listOffers(s.db, false)
+}
+
+// listOffers returns the offers with their tiers by priority, only the active ones when activeOnly is set
+func listOffers(q querier, activeOnly bool) ([]*models.Offer, error) {
+	query := `SELECT ` + offerColumns + ` FROM offers ORDER BY priority, offer_id`
+	var args []interface{}
+	if activeOnly {
+		query = `SELECT ` + offerColumns + ` FROM offers WHERE is_active = ? ORDER BY priority, offer_id`
+		args = append(args, true)
+	}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var offers []*models.Offer
+	for rows.Next() {
+		offer, err := scanOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, offer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, offer := range offers {
+		offer.Tiers, err = offerTiers(q, offer.OfferID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return offers, nil
+}
+
+// offerTiers returns the tiers of an offer, lowest first
+func offerTiers(q querier, offerID int) ([]*models.OfferTier, error) {
+	rows, err := q.Query(`SELECT min_order_value, discount_percentage, discount_amount FROM offer_tiers WHERE offer_id = ? ORDER BY min_order_value, id`, offerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tiers := []*models.OfferTier{}
+	for rows.Next() {
+		tier := &models.OfferTier{}
+		if err := rows.Scan(&tier.MinOrderValue, &tier.DiscountPercentage, &tier.DiscountAmount); err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, rows.Err()
+}
+
+func (s *sqlOfferStore) Update(offer *models.Offer) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE offers SET name = ?, offer_type = ?, buy_product_weight_id = ?, buy_quantity = ?, get_product_weight_id = ?,
+			get_quantity = ?, priority = ?, stackable = ?, start_date = ?, end_date = ?, is_active = ?, updated_at = ?
+		WHERE offer_id = ?`
+	result, err := tx.Exec(query, offer.Name, offer.OfferType, offer.BuyProductWeightID, offer.BuyQuantity, offer.GetProductWeightID,
+		offer.GetQuantity, offer.Priority, offer.Stackable, nullTime(offer.StartDate), nullTime(offer.EndDate), offer.IsActive,
+		offer.UpdatedAt, offer.OfferID)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM offer_tiers WHERE offer_id = ?`, offer.OfferID)
+	}
+	if err == nil {
+		err = insertTiers(tx, offer)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlOfferStore) Delete(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM purchase_offers WHERE offer_id = ?`, id).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return ErrOfferInUse
+	}
+
+	_, err = tx.Exec(`DELETE FROM offer_tiers WHERE offer_id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM offers WHERE offer_id = ?`, id)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlOfferStore) Price(items []*models.PurchaseItem) ([]*models.PurchaseDiscount, error) {
+	return priceOffers(s.db, items, time.Now())
+}
+
+// priceOffers returns the discount lines the offers running at now give on items
+func priceOffers(q querier, items []*models.PurchaseItem, now time.Time) ([]*models.PurchaseDiscount, error) {
+	offers, err := listOffers(q, true)
+	if err != nil {
+		return nil, err
+	}
+	var running []*models.Offer
+	for _, offer := range offers {
+		if offer.RunsAt(now) {
+			running = append(running, offer)
+		}
+	}
+	return models.ApplyOffers(running, items), nil
+}
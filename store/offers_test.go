@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+func TestOffers(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		product := f.product(10, 100)
+		weightID := product.Weights[0].ID
+
+		now := time.Now()
+		offers := []*models.Offer{
+			{Name: "Buy 2, get 1 free", OfferType: models.OfferTypeBuyXGetY, BuyProductWeightID: weightID, BuyQuantity: 2, GetProductWeightID: weightID, GetQuantity: 1, Priority: 1, Stackable: true, IsActive: true},
+			{Name: "10% off above 200", OfferType: models.OfferTypeTiered, Tiers: []*models.OfferTier{{MinOrderValue: 200, DiscountPercentage: 10}, {MinOrderValue: 1000, DiscountAmount: 150}}, Priority: 2, Stackable: true, IsActive: true},
+			{Name: "Ended", OfferType: models.OfferTypeTiered, Tiers: []*models.OfferTier{{DiscountAmount: 50}}, EndDate: now.Add(-time.Hour), Stackable: true, IsActive: true},
+		}
+		for _, offer := range offers {
+			offer.CreatedAt, offer.UpdatedAt = now, now
+			if err := stores.Offers.Create(offer); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := stores.Offers.Get(offers[1].OfferID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Tiers) != 2 || got.Tiers[1].DiscountAmount != 150 || !got.Stackable {
+			t.Errorf("offer = %+v", got)
+		}
+
+		// The free unit comes off first, then the tier takes 10% of what is left
+		discounts, err := stores.Offers.Price([]*models.PurchaseItem{{ProductWeightID: weightID, ProductPrice: 100, Quantity: 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(discounts) != 2 || discounts[0].OfferID != offers[0].OfferID || discounts[0].Amount != 100 || discounts[1].Amount != 20 {
+			t.Errorf("discounts = %+v", discounts)
+		}
+		purchase := f.order(userID, product, 3, "")
+		if purchase.Discount != 120 || purchase.TotalPrice != 180 || len(purchase.Discounts) != 2 || purchase.Discounts[1].OfferID != offers[1].OfferID {
+			t.Errorf("purchase = %+v", purchase)
+		}
+
+		// Updating an offer replaces its tiers
+		got.Tiers = []*models.OfferTier{{MinOrderValue: 100, DiscountAmount: 30}}
+		if err := stores.Offers.Update(got); err != nil {
+			t.Fatal(err)
+		}
+		if updated, err := stores.Offers.Get(got.OfferID); err != nil || len(updated.Tiers) != 1 || updated.Tiers[0].DiscountAmount != 30 {
+			t.Errorf("updated offer = %+v, %v", updated, err)
+		}
+
+		// An offer purchases were discounted with is kept
+		if err := stores.Offers.Delete(offers[0].OfferID); err != store.ErrOfferInUse {
+			t.Errorf("deleting an offer in use = %v, want %v", err, store.ErrOfferInUse)
+		}
+		if err := stores.Offers.Delete(offers[2].OfferID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Offers.Get(offers[2].OfferID); err != store.ErrNotFound {
+			t.Errorf("Get after Delete = %v, want %v", err, store.ErrNotFound)
+		}
+		if listed, err := stores.Offers.List(); err != nil || len(listed) != 2 || listed[0].OfferID != offers[0].OfferID {
+			t.Errorf("offers = %v, %v", listed, err)
+		}
+	})
+}
@@ -0,0 +1,629 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+var (
+	// ErrInvalidItem is returned when an ordered weight variant does not exist or belongs to another product
+	ErrInvalidItem = errors.New("invalid item")
+	// ErrOutOfStock is returned when less stock is left than ordered
+	ErrOutOfStock = errors.New("out of stock")
+	// ErrEmptyCart is returned when checking out a cart without items
+	ErrEmptyCart = errors.New("cart is empty")
+	// ErrInvalidAddress is returned when the delivery address does not belong to the buyer
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrInvalidPayment is returned when the payment mode does not exist or is not active
+	ErrInvalidPayment = errors.New("invalid payment mode")
+	// ErrInvalidTransition is returned when a purchase cannot move to the requested status
+	ErrInvalidTransition = errors.New("invalid status transition")
+)
+
+// OrderStore stores purchases and the items bought with them
+type OrderStore interface {
+	// Create prices the items of a purchase from the current weight variants, takes
+	// their quantities out of stock as sales, applies the running offers and
+	// purchase.DiscountCode and stores the purchase with its totals and discount
+	// lines, all at once. The buyer's cart is left alone.
+	// Only ProductID, ProductWeightID and Quantity of the items are read. The address
+	// must belong to the buyer (ErrInvalidAddress) and the payment mode must be active
+	// and allow the order's total and pincode (ErrInvalidPayment). Nothing is stored
+	// when an item fails with ErrInvalidItem or ErrOutOfStock, or the code with
+	// ErrInvalidPromotion.
+	Create(purchase *models.Purchase) error
+	// Checkout places an order for everything in the cart of purchase.UserID the way
+	// Create does, filling in purchase.Items, and empties the cart along with it. An
+	// empty cart fails with ErrEmptyCart.
+	Checkout(purchase *models.Purchase) error
+	// Get returns a purchase with its items and discount lines
+	Get(id int) (*models.Purchase, error)
+	// List returns the purchases in a status with their items and discount lines, newest first. An
+	// empty status returns every purchase.
+	List(status string) ([]*models.Purchase, error)
+	// ListByUser returns the purchases of a user with their items and discount lines, newest first
+	ListByUser(userID int) ([]*models.Purchase, error)
+	// Items returns the items of a purchase
+	Items(purchaseID int) ([]*models.PurchaseItem, error)
+
+	// UpdateStatus moves change.PurchaseID to change.ToStatus and records the change,
+	// filling in its ID and FromStatus. It returns ErrInvalidTransition when the
+	// current status does not allow the move.
+	UpdateStatus(change *models.PurchaseStatusChange) error
+	// History returns the status changes of a purchase, oldest first
+	History(purchaseID int) ([]*models.PurchaseStatusChange, error)
+	// Cancel moves change.PurchaseID to cancelled like UpdateStatus and puts its
+	// items back in stock as returns. A pending refund of what is left to refund is stored and
+	// returned for every payment captured for the purchase.
+	Cancel(change *models.PurchaseStatusChange) ([]*models.Refund, error)
+}
+
+const purchaseColumns = `id, user_id, total_price, discount, refunded_amount, address_id, payment_id, status, created_at, updated_at`
+
+type sqlOrderStore struct {
+	db *db.Repository
+}
+
+func (s *sqlOrderStore) Create(purchase *models.Purchase) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := placeOrder(tx, purchase); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlOrderStore) Checkout(purchase *models.Purchase) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := checkout(tx, purchase); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkout places an order for the buyer's cart and empties it
+func checkout(tx *db.Tx, purchase *models.Purchase) error {
+	// Items whose weight variant is gone are kept so that reserveItem rejects them
+	rows, err := tx.Query(`SELECT c.product_weight_id, COALESCE(w.product_id, 0), c.quantity
+		FROM cart AS c
+		LEFT JOIN product_weights AS w ON c.product_weight_id = w.id
+		WHERE c.user_id = ?
+		ORDER BY c.id`, purchase.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	purchase.Items = nil
+	for rows.Next() {
+		item := &models.PurchaseItem{}
+		if err := rows.Scan(&item.ProductWeightID, &item.ProductID, &item.Quantity); err != nil {
+			return err
+		}
+		purchase.Items = append(purchase.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if len(purchase.Items) == 0 {
+		return ErrEmptyCart
+	}
+	if err := placeOrder(tx, purchase); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM cart WHERE user_id = ?`, purchase.UserID)
+	return err
+}
+
+// orderTerms checks that the delivery address of a purchase belongs to the buyer and that its
+// payment mode is active, and returns the mode with the pincode the order is delivered to
+func orderTerms(tx *db.Tx, purchase *models.Purchase) (*models.PaymentMode, string, error) {
+	var pincode string
+	err := tx.QueryRow(`SELECT zip_code FROM addresses WHERE address_id = ? AND user_id = ?`, purchase.AddressID, purchase.UserID).Scan(&pincode)
+	if err == sql.ErrNoRows {
+		return nil, "", fmt.Errorf("%w: address %d", ErrInvalidAddress, purchase.AddressID)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	mode, err := scanMode(tx.QueryRow(`SELECT `+modeColumns+` FROM payment_mode WHERE id = ?`, purchase.PaymentID))
+	if err != nil && err != sql.ErrNoRows {
+		return nil, "", err
+	}
+	if mode == nil || !mode.IsActive {
+		return nil, "", fmt.Errorf("%w: payment mode %d", ErrInvalidPayment, purchase.PaymentID)
+	}
+	return mode, pincode, nil
+}
+
+// placeOrder checks the address and payment mode of a purchase, reserves its items and stores
+// it with its items
+func placeOrder(tx *db.Tx, purchase *models.Purchase) error {
+	mode, pincode, err := orderTerms(tx, purchase)
+	if err != nil {
+		return err
+	}
+
+	purchase.TotalPrice = 0
+	for _, item := range purchase.Items {
+		if err := reserveItem(tx, item); err != nil {
+			return err
+		}
+		purchase.TotalPrice += item.TotalPrice
+	}
+
+	now := time.Now()
+	discounts, err := priceOffers(tx, purchase.Items, now)
+	if err != nil {
+		return err
+	}
+	purchase.Discounts = discounts
+	if purchase.DiscountCode != "" {
+		// Writing to the promotion first makes concurrent orders using it wait for each
+		// other, so that each counts the others against the per-user limit
+		_, err := tx.Exec(`UPDATE promotions SET promotion_id = promotion_id WHERE discount_code = ?`, models.NormalizeDiscountCode(purchase.DiscountCode))
+		if err != nil {
+			return err
+		}
+		discount, err := priceDiscount(tx, purchase.UserID, purchase.DiscountCode, purchase.Items, now)
+		if err != nil {
+			return err
+		}
+		purchase.Discounts = append(purchase.Discounts, discount)
+	}
+	purchase.Discount = models.TotalDiscount(purchase.Discounts, purchase.TotalPrice)
+	purchase.TotalPrice -= purchase.Discount
+	// The total is only known once the items are priced; failing here rolls the stock back
+	if !mode.Allows(purchase.TotalPrice, pincode) {
+		return fmt.Errorf("%w: payment mode %d is not available for this order", ErrInvalidPayment, purchase.PaymentID)
+	}
+
+	purchase.Status = models.PurchaseStatusPendingPayment
+	query := `INSERT INTO purchases (user_id, total_price, discount, address_id, payment_id, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	purchaseID, err := tx.InsertReturningID(query, "id", purchase.UserID, purchase.TotalPrice, purchase.Discount, purchase.AddressID, purchase.PaymentID, purchase.Status, purchase.CreatedAt, purchase.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	purchase.ID = int(purchaseID)
+
+	for _, discount := range purchase.Discounts {
+		discount.PurchaseID = purchase.ID
+		var discountID int64
+		if discount.OfferID != 0 {
+			query := `INSERT INTO purchase_offers (purchase_id, offer_id, description, amount) VALUES (?, ?, ?, ?)`
+			discountID, err = tx.InsertReturningID(query, "id", discount.PurchaseID, discount.OfferID, discount.Description, discount.Amount)
+		} else {
+			query := `INSERT INTO purchase_discounts (purchase_id, promotion_id, discount_code, description, amount) VALUES (?, ?, ?, ?, ?)`
+			discountID, err = tx.InsertReturningID(query, "id", discount.PurchaseID, discount.PromotionID, discount.DiscountCode, discount.Description, discount.Amount)
+		}
+		if err != nil {
+			return err
+		}
+		discount.ID = int(discountID)
+	}
+
+	err = recordStatusChange(tx, &models.PurchaseStatusChange{
+		PurchaseID: purchase.ID,
+		ToStatus:   purchase.Status,
+		ActorID:    purchase.UserID,
+		CreatedAt:  purchase.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range purchase.Items {
+		query := `INSERT INTO purchase_items (purchase_id, product_id, product_name, product_weight_id, product_price, quantity, total_price, weight, measurement) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		itemID, err := tx.InsertReturningID(query, "id", purchase.ID, item.ProductID, item.ProductName, item.ProductWeightID, item.ProductPrice, item.Quantity, item.TotalPrice, item.Weight, item.Measurement)
+		if err != nil {
+			return err
+		}
+		item.ID = int(itemID)
+
+		err = insertMovement(tx, &models.StockMovement{
+			ProductWeightID: item.ProductWeightID,
+			MovementType:    models.StockMovementSale,
+			Quantity:        -item.Quantity,
+			PurchaseID:      purchase.ID,
+			ActorID:         purchase.UserID,
+			CreatedAt:       purchase.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserveItem prices an ordered item from its weight variant and takes its quantity out of stock
+func reserveItem(tx *db.Tx, item *models.PurchaseItem) error {
+	if item.Quantity <= 0 {
+		return fmt.Errorf("%w: quantity %d of product %d weight %d", ErrInvalidItem, item.Quantity, item.ProductID, item.ProductWeightID)
+	}
+
+	query := `SELECT p.name, w.price, w.weight, w.measurement
+		FROM product_weights AS w
+		JOIN products AS p ON w.product_id = p.id
+		WHERE w.id = ? AND w.product_id = ?`
+	err := tx.QueryRow(query, item.ProductWeightID, item.ProductID).Scan(&item.ProductName, &item.ProductPrice, &item.Weight, &item.Measurement)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: product %d has no weight %d", ErrInvalidItem, item.ProductID, item.ProductWeightID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The stock check and the decrement are one statement so concurrent orders cannot oversell
+	result, err := tx.Exec(`UPDATE product_weights SET stock = stock - ? WHERE id = ? AND stock >= ?`, item.Quantity, item.ProductWeightID, item.Quantity)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: product %d weight %d", ErrOutOfStock, item.ProductID, item.ProductWeightID)
+	}
+
+	item.TotalPrice = item.ProductPrice * float64(item.Quantity)
+	return nil
+}
+
+func scanPurchase(row scanner) (*models.Purchase, error) {
+	purchase := &models.Purchase{}
+	// Purchases made before totals were recorded have no total
+	var totalPrice sql.NullFloat64
+	err := row.Scan(&purchase.ID, &purchase.UserID, &totalPrice, &purchase.Discount, &purchase.RefundedAmount, &purchase.AddressID, &purchase.PaymentID, &purchase.Status, &purchase.CreatedAt, &purchase.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	purchase.TotalPrice = totalPrice.Float64
+	return purchase, nil
+}
+
+func (s *sqlOrderStore) Get(id int) (*models.Purchase, error) {
+	purchase, err := scanPurchase(s.db.QueryRow(`SELECT `+purchaseColumns+` FROM purchases WHERE id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	purchase.Items, err = s.Items(purchase.ID)
+	if err != nil {
+		return nil, err
+	}
+	purchase.Discounts, err = s.discounts(purchase.ID)
+	if err != nil {
+		return nil, err
+	}
+	return purchase, nil
+}
+
+func (s *sqlOrderStore) List(status string) ([]*models.Purchase, error) {
+	if status == "" {
+		return s.list(`SELECT ` + purchaseColumns + ` FROM purchases ORDER BY id DESC`)
+	}
+	return s.list(`SELECT `+purchaseColumns+` FROM purchases WHERE status = ? ORDER BY id DESC`, status)
+}
+
+func (s *sqlOrderStore) ListByUser(userID int) ([]*models.Purchase, error) {
+	return s.list(`SELECT `+purchaseColumns+` FROM purchases WHERE user_id = ? ORDER BY id DESC`, userID)
+}
+
+// list returns the purchases selected by the query with their items
+func (s *sqlOrderStore) list(query string, args ...interface{}) ([]*models.Purchase, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purchases []*models.Purchase
+	for rows.Next() {
+		purchase, err := scanPurchase(rows)
+		if err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, purchase)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, purchase := range purchases {
+		purchase.Items, err = s.Items(purchase.ID)
+		if err != nil {
+			return nil, err
+		}
+		purchase.Discounts, err = s.discounts(purchase.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return purchases, nil
+}
+
+// discounts returns the discount lines of a purchase
+func (s *sqlOrderStore) discounts(purchaseID int) ([]*models.PurchaseDiscount, error) {
+	// Offers are applied before discount codes
+	query := `SELECT 0 AS kind, id, purchase_id, 0, '', offer_id, description, amount FROM purchase_offers WHERE purchase_id = ?
+		UNION ALL
+		SELECT 1 AS kind, id, purchase_id, promotion_id, discount_code, 0, description, amount FROM purchase_discounts WHERE purchase_id = ?
+		ORDER BY kind, id`
+	rows, err := s.db.Query(query, purchaseID, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discounts []*models.PurchaseDiscount
+	for rows.Next() {
+		discount := &models.PurchaseDiscount{}
+		var kind int
+		err := rows.Scan(&kind, &discount.ID, &discount.PurchaseID, &discount.PromotionID, &discount.DiscountCode, &discount.OfferID, &discount.Description, &discount.Amount)
+		if err != nil {
+			return nil, err
+		}
+		discounts = append(discounts, discount)
+	}
+	return discounts, rows.Err()
+}
+
+func (s *sqlOrderStore) Items(purchaseID int) ([]*models.PurchaseItem, error) {
+	return purchaseItems(s.db, purchaseID)
+}
+
+// purchaseItems returns the items of a purchase in the order they were bought
+func purchaseItems(q querier, purchaseID int) ([]*models.PurchaseItem, error) {
+	// Weight and measurement are the ones the items were bought in
+	query := `SELECT id, product_id, product_name, product_weight_id, product_price, quantity, total_price,
+			COALESCE(weight, 0), COALESCE(measurement, '')
+		FROM purchase_items
+		WHERE purchase_id = ?
+		ORDER BY id`
+	rows, err := q.Query(query, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.PurchaseItem
+	for rows.Next() {
+		item := &models.PurchaseItem{}
+		err := rows.Scan(&item.ID, &item.ProductID, &item.ProductName, &item.ProductWeightID, &item.ProductPrice, &item.Quantity, &item.TotalPrice, &item.Weight, &item.Measurement)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlOrderStore) UpdateStatus(change *models.PurchaseStatusChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := updateStatus(tx, change); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateStatus moves a purchase to a new status and records the change
+func updateStatus(tx *db.Tx, change *models.PurchaseStatusChange) error {
+	err := tx.QueryRow(`SELECT status FROM purchases WHERE id = ?`, change.PurchaseID).Scan(&change.FromStatus)
+	if err != nil {
+		return notFound(err)
+	}
+	if !models.CanTransitionPurchase(change.FromStatus, change.ToStatus) {
+		return fmt.Errorf("%w: purchase %d is %s", ErrInvalidTransition, change.PurchaseID, change.FromStatus)
+	}
+
+	if change.CreatedAt.IsZero() {
+		change.CreatedAt = time.Now()
+	}
+
+	// Matching on the old status turns away a concurrent change made since it was read
+	result, err := tx.Exec(`UPDATE purchases SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		change.ToStatus, change.CreatedAt, change.PurchaseID, change.FromStatus)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: purchase %d changed status", ErrInvalidTransition, change.PurchaseID)
+	}
+
+	return recordStatusChange(tx, change)
+}
+
+// recordStatusChange stores a status change and assigns its ID. A zero ActorID is stored as NULL.
+func recordStatusChange(tx *db.Tx, change *models.PurchaseStatusChange) error {
+	var actorID sql.NullInt64
+	if change.ActorID != 0 {
+		actorID = sql.NullInt64{Int64: int64(change.ActorID), Valid: true}
+	}
+
+	query := `INSERT INTO purchase_status_history (purchase_id, from_status, to_status, actor_id, note, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	id, err := tx.InsertReturningID(query, "id", change.PurchaseID, change.FromStatus, change.ToStatus, actorID, change.Note, change.CreatedAt)
+	if err != nil {
+		return err
+	}
+	change.ID = int(id)
+	return nil
+}
+
+func (s *sqlOrderStore) History(purchaseID int) ([]*models.PurchaseStatusChange, error) {
+	query := `SELECT id, purchase_id, COALESCE(from_status, ''), to_status, COALESCE(actor_id, 0), COALESCE(note, ''), created_at
+		FROM purchase_status_history
+		WHERE purchase_id = ?
+		ORDER BY id`
+	rows, err := s.db.Query(query, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []*models.PurchaseStatusChange
+	for rows.Next() {
+		change := &models.PurchaseStatusChange{}
+		err := rows.Scan(&change.ID, &change.PurchaseID, &change.FromStatus, &change.ToStatus, &change.ActorID, &change.Note, &change.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func (s *sqlOrderStore) Cancel(change *models.PurchaseStatusChange) ([]*models.Refund, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	refunds, err := cancel(tx, change)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return refunds, tx.Commit()
+}
+
+// recordReturns records the stock a cancelled purchase put back, one movement per weight variant
+func recordReturns(tx *db.Tx, change *models.PurchaseStatusChange) error {
+	query := `SELECT product_weight_id, SUM(quantity) FROM purchase_items
+		WHERE purchase_id = ? AND product_weight_id IN (SELECT id FROM product_weights)
+		GROUP BY product_weight_id
+		ORDER BY product_weight_id`
+	rows, err := tx.Query(query, change.PurchaseID)
+	if err != nil {
+		return err
+	}
+	var movements []*models.StockMovement
+	for rows.Next() {
+		movement := &models.StockMovement{
+			MovementType: models.StockMovementReturn,
+			PurchaseID:   change.PurchaseID,
+			Note:         "Purchase cancelled",
+			ActorID:      change.ActorID,
+			CreatedAt:    change.CreatedAt,
+		}
+		if err := rows.Scan(&movement.ProductWeightID, &movement.Quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		movements = append(movements, movement)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, movement := range movements {
+		if err := insertMovement(tx, movement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancel cancels a purchase, restores its stock and stores the refunds owed for it
+func cancel(tx *db.Tx, change *models.PurchaseStatusChange) ([]*models.Refund, error) {
+	change.ToStatus = models.PurchaseStatusCancelled
+	if err := updateStatus(tx, change); err != nil {
+		return nil, err
+	}
+
+	// Variants removed since the purchase have no stock left to restore
+	query := `UPDATE product_weights SET stock = stock + (
+			SELECT COALESCE(SUM(quantity), 0) FROM purchase_items
+			WHERE purchase_items.purchase_id = ? AND purchase_items.product_weight_id = product_weights.id)
+		WHERE id IN (SELECT product_weight_id FROM purchase_items WHERE purchase_id = ?)`
+	_, err := tx.Exec(query, change.PurchaseID, change.PurchaseID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordReturns(tx, change); err != nil {
+		return nil, err
+	}
+
+	// What is left of each captured payment is refunded through its own provider
+	query = `SELECT id, amount - COALESCE((SELECT SUM(refunds.amount) FROM refunds WHERE refunds.payment_id = payments.id), 0)
+		FROM payments
+		WHERE purchase_id = ? AND status = ?
+		ORDER BY id`
+	rows, err := tx.Query(query, change.PurchaseID, models.PaymentStatusCaptured)
+	if err != nil {
+		return nil, err
+	}
+	var refunds []*models.Refund
+	for rows.Next() {
+		refund := &models.Refund{
+			PurchaseID: change.PurchaseID,
+			Status:     models.RefundStatusPending,
+			Reason:     change.Note,
+			CreatedAt:  change.CreatedAt,
+			UpdatedAt:  change.CreatedAt,
+		}
+		if err := rows.Scan(&refund.PaymentID, &refund.Amount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if refund.Amount >= refundTolerance {
+			refunds = append(refunds, refund)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, refund := range refunds {
+		if err := insertRefund(tx, refund); err != nil {
+			return nil, err
+		}
+	}
+	return refunds, nil
+}
+
+// insertRefund stores a refund with its items within a transaction, assigns its ID
+// and adds it to the refunded total of its purchase
+func insertRefund(tx *db.Tx, refund *models.Refund) error {
+	query := `INSERT INTO refunds (purchase_id, payment_id, amount, status, reason, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	id, err := tx.InsertReturningID(query, "id", refund.PurchaseID, refund.PaymentID, refund.Amount, refund.Status, refund.Reason, refund.CreatedAt, refund.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	refund.ID = int(id)
+
+	for _, item := range refund.Items {
+		query := `INSERT INTO refund_items (refund_id, purchase_item_id, quantity, amount) VALUES (?, ?, ?, ?)`
+		_, err := tx.Exec(query, refund.ID, item.PurchaseItemID, item.Quantity, item.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE purchases SET refunded_amount = refunded_amount + ? WHERE id = ?`, refund.Amount, refund.PurchaseID)
+	return err
+}
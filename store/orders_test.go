@@ -0,0 +1,270 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+func TestOrderPricing(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		product := f.product(5, 100, 190)
+
+		// Prices sent with the items are ignored in favour of the current ones, and the
+		// buyer's cart is kept for a later checkout
+		if err := stores.Carts.AddItem(userID, product.Weights[1].ID, 1); err != nil {
+			t.Fatal(err)
+		}
+		purchase := &models.Purchase{
+			UserID:    userID,
+			AddressID: f.address(userID),
+			PaymentID: f.paymentMode("cod"),
+			Items: []*models.PurchaseItem{
+				{ProductID: product.ID, ProductWeightID: product.Weights[0].ID, Quantity: 2, ProductPrice: 1},
+				{ProductID: product.ID, ProductWeightID: product.Weights[1].ID, Quantity: 1, ProductPrice: 1},
+			},
+		}
+		if err := stores.Orders.Create(purchase); err != nil {
+			t.Fatal(err)
+		}
+		if purchase.ID == 0 || purchase.TotalPrice != 390 || purchase.Status != models.PurchaseStatusPendingPayment {
+			t.Errorf("purchase = %+v", purchase)
+		}
+		got, err := stores.Orders.Get(purchase.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Items) != 2 {
+			t.Fatalf("purchase has %d items, want 2", len(got.Items))
+		}
+		if got.Items[0].ProductPrice != 100 || got.Items[0].TotalPrice != 200 || got.Items[1].Weight != 500 || got.Items[1].ProductName != "Laddu" {
+			t.Errorf("items = %+v, %+v", got.Items[0], got.Items[1])
+		}
+		if stock := f.stock(product.Weights[0].ID); stock != 3 {
+			t.Errorf("stock = %d, want 3", stock)
+		}
+		if items, err := stores.Carts.Items(userID); err != nil || len(items) != 1 {
+			t.Errorf("cart = %v, %v, want the order to leave it alone", items, err)
+		}
+
+		// A failing item, a foreign address or a payment mode that is inactive or not open
+		// to the order's total stores nothing and leaves the stock of the other items alone
+		other := f.product(5, 80)
+		inactive := &models.PaymentMode{Mode: "UPI", Provider: "fake"}
+		if err := stores.Payments.CreateMode(inactive); err != nil {
+			t.Fatal(err)
+		}
+		limited := &models.PaymentMode{Mode: "COD", Provider: "cod", IsActive: true, MaxOrderValue: 50}
+		if err := stores.Payments.CreateMode(limited); err != nil {
+			t.Fatal(err)
+		}
+		one := []*models.PurchaseItem{{ProductID: product.ID, ProductWeightID: product.Weights[0].ID, Quantity: 1}}
+		orders := []struct {
+			items                []*models.PurchaseItem
+			addressID, paymentID int
+			want                 error
+		}{
+			{[]*models.PurchaseItem{{ProductID: product.ID, ProductWeightID: product.Weights[0].ID, Quantity: 1}, {ProductID: product.ID, ProductWeightID: product.Weights[1].ID, Quantity: 5}}, purchase.AddressID, purchase.PaymentID, store.ErrOutOfStock},
+			{[]*models.PurchaseItem{{ProductID: product.ID, ProductWeightID: product.Weights[0].ID, Quantity: 1}, {ProductID: product.ID, ProductWeightID: other.Weights[0].ID, Quantity: 1}}, purchase.AddressID, purchase.PaymentID, store.ErrInvalidItem},
+			{[]*models.PurchaseItem{{ProductID: product.ID, ProductWeightID: other.Weights[0].ID + 100, Quantity: 1}}, purchase.AddressID, purchase.PaymentID, store.ErrInvalidItem},
+			{one, f.address(f.user("ravi@example.com")), purchase.PaymentID, store.ErrInvalidAddress},
+			{one, purchase.AddressID, inactive.ID, store.ErrInvalidPayment},
+			{one, purchase.AddressID, inactive.ID + 100, store.ErrInvalidPayment},
+			{one, purchase.AddressID, limited.ID, store.ErrInvalidPayment},
+		}
+		for i, order := range orders {
+			err := stores.Orders.Create(&models.Purchase{UserID: userID, AddressID: order.addressID, PaymentID: order.paymentID, Items: order.items})
+			if !errors.Is(err, order.want) {
+				t.Errorf("order %d = %v, want %v", i, err, order.want)
+			}
+		}
+		if stock := f.stock(product.Weights[0].ID); stock != 3 {
+			t.Errorf("stock = %d, want the refused orders to leave it at 3", stock)
+		}
+		if purchases, err := stores.Orders.ListByUser(userID); err != nil || len(purchases) != 1 {
+			t.Errorf("purchases = %v, %v, want only the order placed", purchases, err)
+		}
+	})
+}
+
+func TestCheckout(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		otherID := f.user("ravi@example.com")
+		product := f.product(5, 100, 190)
+		addressID := f.address(userID)
+		paymentID := f.paymentMode("cod")
+
+		checkout := func(addressID, paymentID int) (*models.Purchase, error) {
+			purchase := &models.Purchase{UserID: userID, AddressID: addressID, PaymentID: paymentID}
+			return purchase, stores.Orders.Checkout(purchase)
+		}
+		if _, err := checkout(addressID, paymentID); !errors.Is(err, store.ErrEmptyCart) {
+			t.Errorf("checking out an empty cart = %v, want %v", err, store.ErrEmptyCart)
+		}
+		if err := stores.Carts.AddItem(userID, product.Weights[0].ID, 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Carts.AddItem(userID, product.Weights[1].ID, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		// The address must be the buyer's and the mode active and open to the order's total
+		limited := &models.PaymentMode{Mode: "Card", Provider: "fake", IsActive: true, MaxOrderValue: 300}
+		if err := stores.Payments.CreateMode(limited); err != nil {
+			t.Fatal(err)
+		}
+		inactive := &models.PaymentMode{Mode: "UPI", Provider: "fake"}
+		if err := stores.Payments.CreateMode(inactive); err != nil {
+			t.Fatal(err)
+		}
+		refused := []struct {
+			addressID, paymentID int
+			want                 error
+		}{
+			{f.address(otherID), paymentID, store.ErrInvalidAddress},
+			{addressID, inactive.ID, store.ErrInvalidPayment},
+			{addressID, limited.ID, store.ErrInvalidPayment},
+			{addressID, paymentID + 100, store.ErrInvalidPayment},
+		}
+		for _, test := range refused {
+			if _, err := checkout(test.addressID, test.paymentID); !errors.Is(err, test.want) {
+				t.Errorf("checking out to address %d with mode %d = %v, want %v", test.addressID, test.paymentID, err, test.want)
+			}
+		}
+		if items, err := stores.Carts.Items(userID); err != nil || len(items) != 2 {
+			t.Fatalf("cart = %v, %v, want the refused checkouts to leave it alone", items, err)
+		}
+
+		purchase, err := checkout(addressID, paymentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if purchase.TotalPrice != 390 || len(purchase.Items) != 2 || purchase.Items[0].ProductID != product.ID {
+			t.Errorf("purchase = %+v", purchase)
+		}
+		if items, err := stores.Carts.Items(userID); err != nil || len(items) != 0 {
+			t.Errorf("cart after checkout = %v, %v, want it empty", items, err)
+		}
+		if stock := f.stock(product.Weights[1].ID); stock != 4 {
+			t.Errorf("stock = %d, want 4", stock)
+		}
+
+		// A cart holding more than is in stock is left as it was
+		if err := stores.Carts.AddItem(userID, product.Weights[0].ID, 4); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := checkout(addressID, paymentID); !errors.Is(err, store.ErrOutOfStock) {
+			t.Errorf("checking out more than is in stock = %v, want %v", err, store.ErrOutOfStock)
+		}
+		if items, err := stores.Carts.Items(userID); err != nil || len(items) != 1 {
+			t.Errorf("cart = %v, %v, want the refused checkout to leave it alone", items, err)
+		}
+	})
+}
+
+func TestPurchaseStatus(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		adminID := f.user("admin@example.com")
+		purchase := f.order(userID, f.product(5, 100), 1, "")
+
+		if err := stores.Orders.UpdateStatus(&models.PurchaseStatusChange{PurchaseID: purchase.ID, ToStatus: models.PurchaseStatusShipped}); !errors.Is(err, store.ErrInvalidTransition) {
+			t.Errorf("shipping an unpaid purchase = %v, want %v", err, store.ErrInvalidTransition)
+		}
+		if err := stores.Orders.UpdateStatus(&models.PurchaseStatusChange{PurchaseID: purchase.ID + 100, ToStatus: models.PurchaseStatusConfirmed}); err != store.ErrNotFound {
+			t.Errorf("confirming a missing purchase = %v, want %v", err, store.ErrNotFound)
+		}
+		change := &models.PurchaseStatusChange{PurchaseID: purchase.ID, ToStatus: models.PurchaseStatusConfirmed, ActorID: adminID, Note: "Paid"}
+		if err := stores.Orders.UpdateStatus(change); err != nil {
+			t.Fatal(err)
+		}
+		if change.ID == 0 || change.FromStatus != models.PurchaseStatusPendingPayment {
+			t.Errorf("change = %+v", change)
+		}
+
+		if confirmed, err := stores.Orders.List(models.PurchaseStatusConfirmed); err != nil || len(confirmed) != 1 || confirmed[0].ID != purchase.ID {
+			t.Errorf("confirmed purchases = %v, %v", confirmed, err)
+		}
+		if pending, err := stores.Orders.List(models.PurchaseStatusPendingPayment); err != nil || len(pending) != 0 {
+			t.Errorf("pending purchases = %v, %v, want none", pending, err)
+		}
+
+		history, err := stores.Orders.History(purchase.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 2 {
+			t.Fatalf("history = %+v, want the order and the confirmation", history)
+		}
+		if history[0].ToStatus != models.PurchaseStatusPendingPayment || history[0].ActorID != userID {
+			t.Errorf("first change = %+v", history[0])
+		}
+		if history[1].FromStatus != models.PurchaseStatusPendingPayment || history[1].ActorID != adminID || history[1].Note != "Paid" {
+			t.Errorf("second change = %+v", history[1])
+		}
+	})
+}
+
+func TestCancel(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		product := f.product(5, 100)
+		weightID := product.Weights[0].ID
+
+		// Cancelling an unpaid purchase restocks it and owes nothing
+		unpaid := f.order(userID, product, 2, "")
+		refunds, err := stores.Orders.Cancel(&models.PurchaseStatusChange{PurchaseID: unpaid.ID, ActorID: userID, Note: "Changed my mind"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(refunds) != 0 {
+			t.Errorf("refunds = %+v, want none for an unpaid purchase", refunds)
+		}
+		if stock := f.stock(weightID); stock != 5 {
+			t.Errorf("stock = %d, want 5", stock)
+		}
+		movements, err := stores.Inventory.Movements(weightID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last := movements[len(movements)-1]; last.MovementType != models.StockMovementReturn || last.Quantity != 2 || last.PurchaseID != unpaid.ID {
+			t.Errorf("last movement = %+v, want the cancelled items returned", last)
+		}
+		if _, err := stores.Orders.Cancel(&models.PurchaseStatusChange{PurchaseID: unpaid.ID}); !errors.Is(err, store.ErrInvalidTransition) {
+			t.Errorf("cancelling twice = %v, want %v", err, store.ErrInvalidTransition)
+		}
+
+		// Cancelling a paid purchase owes back what was paid
+		paid := f.order(userID, product, 1, "")
+		payment := f.capture(paid)
+		refunds, err = stores.Orders.Cancel(&models.PurchaseStatusChange{PurchaseID: paid.ID, ActorID: userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(refunds) != 1 || refunds[0].PaymentID != payment.ID || refunds[0].Amount != 100 || refunds[0].Status != models.RefundStatusPending {
+			t.Errorf("refunds = %+v", refunds)
+		}
+
+		// A shipped purchase can no longer be cancelled
+		shipped := f.order(userID, product, 1, "")
+		for _, status := range []string{models.PurchaseStatusConfirmed, models.PurchaseStatusPreparing, models.PurchaseStatusShipped} {
+			if err := stores.Orders.UpdateStatus(&models.PurchaseStatusChange{PurchaseID: shipped.ID, ToStatus: status}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := stores.Orders.Cancel(&models.PurchaseStatusChange{PurchaseID: shipped.ID}); !errors.Is(err, store.ErrInvalidTransition) {
+			t.Errorf("cancelling a shipped purchase = %v, want %v", err, store.ErrInvalidTransition)
+		}
+		if stock := f.stock(weightID); stock != 4 {
+			t.Errorf("stock = %d, want only the shipped unit out", stock)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// ErrLockedOut is returned when the OTP checks of a user are refused until a lockout ends
+var ErrLockedOut = errors.New("locked out of OTP checks")
+
+// OTPStore stores one-time codes and the per-user OTP lockout state
+type OTPStore interface {
+	// Issue stores a new code, assigning its ID, and invalidates the codes
+	// previously issued to the user for the same purpose
+	Issue(otp *models.OTP) error
+	// Latest returns the most recent unused code of the user for the purpose
+	Latest(userID int, purpose string) (*models.OTP, error)
+	// CountAttempt counts a guess at an unused code before it is compared, so that
+	// concurrent guesses cannot share one count. It reports false without counting
+	// when the code is used or has already had maxAttempts guesses.
+	CountAttempt(id, maxAttempts int) (bool, error)
+	// Consume marks a code used. It reports false when the code was already used.
+	Consume(id int) (bool, error)
+	// SendTimes returns when the latest codes were issued to the user for the purpose, newest first
+	SendTimes(userID int, purpose string, limit int) ([]time.Time, error)
+	// CountCheck counts an OTP check of the user as failed before the code is compared,
+	// so that concurrent checks cannot share one count, and returns the failures so far.
+	// The check reaching maxFailures locks the user out until lockUntil; counting starts
+	// over once the lockout ends. It returns ErrLockedOut while the user is locked out at now.
+	CountCheck(userID, maxFailures int, now, lockUntil time.Time) (int, error)
+	// ClearFailures forgets the failed OTP checks of the user after a successful one
+	ClearFailures(userID int) error
+}
+
+type sqlOTPStore struct {
+	db *db.Repository
+}
+
+func (s *sqlOTPStore) Issue(otp *models.OTP) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE otp SET consumed_at = ? WHERE user_id = ? AND purpose = ? AND consumed_at IS NULL`, otp.GeneratedAt, otp.UserID, otp.Purpose)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `INSERT INTO otp (user_id, otp_value, generated_at, purpose, expires_at) VALUES (?, ?, ?, ?, ?)`
+	id, err := tx.InsertReturningID(query, "id", otp.UserID, otp.Value, otp.GeneratedAt, otp.Purpose, otp.ExpiresAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	otp.ID = int(id)
+
+	return tx.Commit()
+}
+
+func (s *sqlOTPStore) Latest(userID int, purpose string) (*models.OTP, error) {
+	query := `SELECT id, user_id, otp_value, purpose, generated_at, expires_at, attempts FROM otp WHERE user_id = ? AND purpose = ? AND consumed_at IS NULL ORDER BY id DESC LIMIT 1`
+
+	otp := &models.OTP{}
+	var expiresAt sql.NullTime
+	err := s.db.QueryRow(query, userID, purpose).Scan(&otp.ID, &otp.UserID, &otp.Value, &otp.Purpose, &otp.GeneratedAt, &expiresAt, &otp.Attempts)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	otp.ExpiresAt = expiresAt.Time
+	return otp, nil
+}
+
+func (s *sqlOTPStore) CountAttempt(id, maxAttempts int) (bool, error) {
+	result, err := s.db.Exec(`UPDATE otp SET attempts = attempts + 1 WHERE id = ? AND consumed_at IS NULL AND attempts < ?`, id, maxAttempts)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (s *sqlOTPStore) Consume(id int) (bool, error) {
+	// Guard against the same code being redeemed twice concurrently
+	result, err := s.db.Exec(`UPDATE otp SET consumed_at = ? WHERE id = ? AND consumed_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (s *sqlOTPStore) SendTimes(userID int, purpose string, limit int) ([]time.Time, error) {
+	query := `SELECT generated_at FROM otp WHERE user_id = ? AND purpose = ? ORDER BY id DESC LIMIT ?`
+	rows, err := s.db.Query(query, userID, purpose, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sentAt []time.Time
+	for rows.Next() {
+		var generatedAt time.Time
+		if err := rows.Scan(&generatedAt); err != nil {
+			return nil, err
+		}
+		sentAt = append(sentAt, generatedAt)
+	}
+	return sentAt, rows.Err()
+}
+
+func (s *sqlOTPStore) CountCheck(userID, maxFailures int, now, lockUntil time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// The count and the lockout change in one transaction so that no check sees the
+	// limit reached without the lockout
+	query := `UPDATE users SET
+			otp_failed_attempts = CASE WHEN otp_locked_until IS NULL THEN otp_failed_attempts + 1 ELSE 1 END,
+			otp_locked_until = NULL
+		WHERE user_id = ? AND (otp_locked_until IS NULL OR otp_locked_until <= ?)`
+	result, err := tx.Exec(query, userID, now)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if rows == 0 {
+		var count int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE user_id = ?`, userID).Scan(&count)
+		tx.Rollback()
+		if err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			return 0, ErrNotFound
+		}
+		return 0, ErrLockedOut
+	}
+
+	_, err = tx.Exec(`UPDATE users SET otp_locked_until = ? WHERE user_id = ? AND otp_failed_attempts >= ?`, lockUntil, userID, maxFailures)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	var failures int
+	err = tx.QueryRow(`SELECT otp_failed_attempts FROM users WHERE user_id = ?`, userID).Scan(&failures)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return failures, tx.Commit()
+}
+
+func (s *sqlOTPStore) ClearFailures(userID int) error {
+	_, err := s.db.Exec(`UPDATE users SET otp_failed_attempts = 0, otp_locked_until = NULL WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,333 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// ErrModeInUse is returned when deleting a payment mode that purchases were made with
+var ErrModeInUse = errors.New("payment mode is in use")
+
+// PaymentStore stores the payment modes offered at checkout and the payments made for purchases
+type PaymentStore interface {
+	// ListModes returns every payment mode
+	ListModes() ([]*models.PaymentMode, error)
+	// GetMode returns a payment mode
+	GetMode(id int) (*models.PaymentMode, error)
+	// CreateMode stores a payment mode, assigning its ID
+	CreateMode(mode *models.PaymentMode) error
+	// UpdateMode changes a payment mode
+	UpdateMode(mode *models.PaymentMode) error
+	// DeleteMode removes a payment mode. It returns ErrModeInUse when purchases were made with it.
+	DeleteMode(id int) error
+
+	// Create stores a payment, assigning its ID. A payment collected offline
+	// (PaymentStatusPending) confirms its purchase at once, which must be awaiting
+	// payment; otherwise ErrInvalidTransition is returned and nothing is stored.
+	// When the purchase already has a payment with the same provider awaiting
+	// capture, nothing is stored, payment is set to that payment and Create reports false.
+	Create(payment *models.Payment) (bool, error)
+	// Get returns a payment
+	Get(id int) (*models.Payment, error)
+	// GetByProviderOrder returns the payment with the provider's order ID
+	GetByProviderOrder(provider, providerOrderID string) (*models.Payment, error)
+	// ListByPurchase returns the payments of a purchase, oldest first
+	ListByPurchase(purchaseID int) ([]*models.Payment, error)
+	// Capture marks a created or failed payment captured and confirms its purchase
+	// if it is awaiting payment. A purchase cancelled in the meantime, or already paid
+	// for by another payment, is owed a refund of the payment instead. It reports false
+	// when the payment was already captured or is not collected online.
+	Capture(id int, providerPaymentID string) (bool, error)
+	// Fail marks a created payment failed; its purchase stays awaiting payment so that
+	// the customer can try again. It reports false when the payment was not awaiting capture.
+	Fail(id int) (bool, error)
+}
+
+const modeColumns = `id, mode, is_active, provider, min_order_value, max_order_value, allowed_pincodes`
+
+const paymentColumns = `id, purchase_id, provider, provider_order_id, provider_payment_id, amount, currency, status, created_at, updated_at`
+
+type sqlPaymentStore struct {
+	db *db.Repository
+}
+
+func scanMode(row scanner) (*models.PaymentMode, error) {
+	mode := &models.PaymentMode{}
+	var isActive sql.NullBool
+	var allowedPincodes string
+	err := row.Scan(&mode.ID, &mode.Mode, &isActive, &mode.Provider, &mode.MinOrderValue, &mode.MaxOrderValue, &allowedPincodes)
+	if err != nil {
+		return nil, err
+	}
+	mode.IsActive = isActive.Bool
+
+	// Pincodes are stored comma-separated
+	mode.AllowedPincodes = []string{}
+	if allowedPincodes != "" {
+		mode.AllowedPincodes = strings.Split(allowedPincodes, ",")
+	}
+	return mode, nil
+}
+
+func (s *sqlPaymentStore) ListModes() ([]*models.PaymentMode, error) {
+	rows, err := s.db.Query(`SELECT ` + modeColumns + ` FROM payment_mode ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var modes []*models.PaymentMode
+	for rows.Next() {
+		mode, err := scanMode(rows)
+		if err != nil {
+			return nil, err
+		}
+		modes = append(modes, mode)
+	}
+	return modes, rows.Err()
+}
+
+func (s *sqlPaymentStore) GetMode(id int) (*models.PaymentMode, error) {
+	mode, err := scanMode(s.db.QueryRow(`SELECT `+modeColumns+` FROM payment_mode WHERE id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return mode, nil
+}
+
+func (s *sqlPaymentStore) CreateMode(mode *models.PaymentMode) error {
+	query := `INSERT INTO payment_mode (mode, is_active, provider, min_order_value, max_order_value, allowed_pincodes) VALUES (?, ?, ?, ?, ?, ?)`
+	id, err := s.db.InsertReturningID(query, "id", mode.Mode, mode.IsActive, mode.Provider, mode.MinOrderValue, mode.MaxOrderValue, strings.Join(mode.AllowedPincodes, ","))
+	if err != nil {
+		return err
+	}
+	mode.ID = int(id)
+	return nil
+}
+
+func (s *sqlPaymentStore) UpdateMode(mode *models.PaymentMode) error {
+	query := `UPDATE payment_mode SET mode = ?, is_active = ?, provider = ?, min_order_value = ?, max_order_value = ?, allowed_pincodes = ? WHERE id = ?`
+	result, err := s.db.Exec(query, mode.Mode, mode.IsActive, mode.Provider, mode.MinOrderValue, mode.MaxOrderValue, strings.Join(mode.AllowedPincodes, ","), mode.ID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlPaymentStore) DeleteMode(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM purchases WHERE payment_id = ?`, id).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return ErrModeInUse
+	}
+
+	result, err := tx.Exec(`DELETE FROM payment_mode WHERE id = ?`, id)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanPayment(row scanner) (*models.Payment, error) {
+	payment := &models.Payment{}
+	var providerPaymentID sql.NullString
+	err := row.Scan(&payment.ID, &payment.PurchaseID, &payment.Provider, &payment.ProviderOrderID, &providerPaymentID,
+		&payment.Amount, &payment.Currency, &payment.Status, &payment.CreatedAt, &payment.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	payment.ProviderPaymentID = providerPaymentID.String
+	return payment, nil
+}
+
+func (s *sqlPaymentStore) Create(payment *models.Payment) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	// Concurrent requests to pay for the same purchase must not both create a payment
+	if err := lockRow(tx, "purchases", "id", payment.PurchaseID); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if payment.Status == models.PaymentStatusCreated {
+		query := `SELECT ` + paymentColumns + ` FROM payments WHERE purchase_id = ? AND provider = ? AND status = ? ORDER BY id DESC LIMIT 1`
+		open, err := scanPayment(tx.QueryRow(query, payment.PurchaseID, payment.Provider, models.PaymentStatusCreated))
+		if err == nil {
+			tx.Rollback()
+			*payment = *open
+			return false, nil
+		}
+		if err != sql.ErrNoRows {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	query := `INSERT INTO payments (purchase_id, provider, provider_order_id, amount, currency, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := tx.InsertReturningID(query, "id", payment.PurchaseID, payment.Provider, payment.ProviderOrderID, payment.Amount, payment.Currency, payment.Status, payment.CreatedAt, payment.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if payment.Status == models.PaymentStatusPending {
+		err = updateStatus(tx, &models.PurchaseStatusChange{
+			PurchaseID: payment.PurchaseID,
+			ToStatus:   models.PurchaseStatusConfirmed,
+			Note:       "Payment collected on delivery",
+			CreatedAt:  payment.CreatedAt,
+		})
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	payment.ID = int(id)
+	return true, nil
+}
+
+func (s *sqlPaymentStore) Get(id int) (*models.Payment, error) {
+	payment, err := scanPayment(s.db.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return payment, nil
+}
+
+func (s *sqlPaymentStore) GetByProviderOrder(provider, providerOrderID string) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE provider = ? AND provider_order_id = ?`
+	payment, err := scanPayment(s.db.QueryRow(query, provider, providerOrderID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return payment, nil
+}
+
+func (s *sqlPaymentStore) ListByPurchase(purchaseID int) ([]*models.Payment, error) {
+	rows, err := s.db.Query(`SELECT `+paymentColumns+` FROM payments WHERE purchase_id = ? ORDER BY id`, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []*models.Payment
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+func (s *sqlPaymentStore) Capture(id int, providerPaymentID string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	// Gateways may report a failed attempt before a later attempt on the same order succeeds
+	now := time.Now()
+	result, err := tx.Exec(`UPDATE payments SET status = ?, provider_payment_id = ?, updated_at = ? WHERE id = ? AND status IN (?, ?)`,
+		models.PaymentStatusCaptured, providerPaymentID, now, id, models.PaymentStatusCreated, models.PaymentStatusFailed)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		tx.Rollback()
+		return false, err
+	}
+
+	payment, err := scanPayment(tx.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = ?`, id))
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	// Captures of two payments of the purchase must see each other
+	if err := lockRow(tx, "purchases", "id", payment.PurchaseID); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	var status string
+	err = tx.QueryRow(`SELECT status FROM purchases WHERE id = ?`, payment.PurchaseID).Scan(&status)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	switch status {
+	case models.PurchaseStatusPendingPayment:
+		err = updateStatus(tx, &models.PurchaseStatusChange{
+			PurchaseID: payment.PurchaseID,
+			ToStatus:   models.PurchaseStatusConfirmed,
+			Note:       "Payment captured",
+			CreatedAt:  now,
+		})
+	case models.PurchaseStatusCancelled:
+		err = insertRefund(tx, &models.Refund{
+			PurchaseID: payment.PurchaseID,
+			PaymentID:  payment.ID,
+			Amount:     payment.Amount,
+			Status:     models.RefundStatusPending,
+			Reason:     "Payment captured after the purchase was cancelled",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+	default:
+		// The purchase was already paid for, by another payment or on delivery
+		err = insertRefund(tx, &models.Refund{
+			PurchaseID: payment.PurchaseID,
+			PaymentID:  payment.ID,
+			Amount:     payment.Amount,
+			Status:     models.RefundStatusPending,
+			Reason:     "Purchase was already paid for",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (s *sqlPaymentStore) Fail(id int) (bool, error) {
+	result, err := s.db.Exec(`UPDATE payments SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		models.PaymentStatusFailed, time.Now(), id, models.PaymentStatusCreated)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,154 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+// payment returns an unsaved payment of the purchase's total through provider in status
+func payment(purchase *models.Purchase, provider, providerOrderID, status string) *models.Payment {
+	now := time.Now()
+	return &models.Payment{
+		PurchaseID:      purchase.ID,
+		Provider:        provider,
+		ProviderOrderID: providerOrderID,
+		Amount:          purchase.TotalPrice,
+		Currency:        "INR",
+		Status:          status,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+}
+
+func TestPayments(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		purchase := f.order(userID, f.product(5, 100), 1, "")
+
+		// A payment awaiting capture is reused rather than stored again
+		first := payment(purchase, "fake", "order_1", models.PaymentStatusCreated)
+		if created, err := stores.Payments.Create(first); err != nil || !created {
+			t.Fatalf("Create = %v, %v", created, err)
+		}
+		again := payment(purchase, "fake", "order_2", models.PaymentStatusCreated)
+		if created, err := stores.Payments.Create(again); err != nil || created || again.ID != first.ID || again.ProviderOrderID != "order_1" {
+			t.Errorf("creating a second open payment = %v, %v with %+v", created, err, again)
+		}
+
+		// A failed payment leaves the purchase awaiting payment for another try
+		if failed, err := stores.Payments.Fail(first.ID); err != nil || !failed {
+			t.Fatalf("Fail = %v, %v", failed, err)
+		}
+		if failed, err := stores.Payments.Fail(first.ID); err != nil || failed {
+			t.Errorf("failing a payment twice = %v, %v", failed, err)
+		}
+		if status := f.purchaseStatus(purchase.ID); status != models.PurchaseStatusPendingPayment {
+			t.Errorf("purchase is %s after a failed payment", status)
+		}
+		retry := payment(purchase, "fake", "order_3", models.PaymentStatusCreated)
+		if created, err := stores.Payments.Create(retry); err != nil || !created || retry.ID == first.ID {
+			t.Fatalf("retrying = %v, %v with %+v", created, err, retry)
+		}
+
+		if captured, err := stores.Payments.Capture(retry.ID, "pay_3"); err != nil || !captured {
+			t.Fatalf("Capture = %v, %v", captured, err)
+		}
+		if captured, err := stores.Payments.Capture(retry.ID, "pay_3"); err != nil || captured {
+			t.Errorf("capturing a payment twice = %v, %v", captured, err)
+		}
+		if status := f.purchaseStatus(purchase.ID); status != models.PurchaseStatusConfirmed {
+			t.Errorf("purchase is %s after its payment was captured", status)
+		}
+		got, err := stores.Payments.GetByProviderOrder("fake", "order_3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != retry.ID || got.Status != models.PaymentStatusCaptured || got.ProviderPaymentID != "pay_3" {
+			t.Errorf("payment = %+v", got)
+		}
+
+		// A late capture of the failed payment is owed back rather than paying twice
+		if captured, err := stores.Payments.Capture(first.ID, "pay_1"); err != nil || !captured {
+			t.Fatalf("capturing the failed payment = %v, %v", captured, err)
+		}
+		refunds, err := stores.Refunds.ListByPurchase(purchase.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(refunds) != 1 || refunds[0].PaymentID != first.ID || refunds[0].Amount != purchase.TotalPrice {
+			t.Errorf("refunds = %+v, want the second capture owed back", refunds)
+		}
+		if payments, err := stores.Payments.ListByPurchase(purchase.ID); err != nil || len(payments) != 2 || payments[0].ID != first.ID {
+			t.Errorf("payments = %v, %v", payments, err)
+		}
+	})
+}
+
+func TestOfflinePayments(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		purchase := f.order(userID, f.product(5, 100), 1, "")
+
+		// Cash on delivery confirms the purchase at once, and only once
+		cod := payment(purchase, "cod", "cod_1", models.PaymentStatusPending)
+		if created, err := stores.Payments.Create(cod); err != nil || !created {
+			t.Fatalf("Create = %v, %v", created, err)
+		}
+		if status := f.purchaseStatus(purchase.ID); status != models.PurchaseStatusConfirmed {
+			t.Errorf("purchase is %s after choosing cash on delivery", status)
+		}
+		if _, err := stores.Payments.Create(payment(purchase, "cod", "cod_2", models.PaymentStatusPending)); !errors.Is(err, store.ErrInvalidTransition) {
+			t.Errorf("paying a confirmed purchase on delivery = %v, want %v", err, store.ErrInvalidTransition)
+		}
+		if captured, err := stores.Payments.Capture(cod.ID, "pay_1"); err != nil || captured {
+			t.Errorf("capturing a payment collected offline = %v, %v", captured, err)
+		}
+	})
+}
+
+func TestPaymentModes(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+
+		mode := &models.PaymentMode{Mode: "Card", Provider: "fake", IsActive: true, MinOrderValue: 100, MaxOrderValue: 5000, AllowedPincodes: []string{"600001", "600002"}}
+		if err := stores.Payments.CreateMode(mode); err != nil {
+			t.Fatal(err)
+		}
+		mode.IsActive, mode.AllowedPincodes = false, []string{}
+		if err := stores.Payments.UpdateMode(mode); err != nil {
+			t.Fatal(err)
+		}
+		got, err := stores.Payments.GetMode(mode.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Mode != "Card" || got.IsActive || got.MinOrderValue != 100 || got.MaxOrderValue != 5000 || len(got.AllowedPincodes) != 0 {
+			t.Errorf("mode = %+v", got)
+		}
+		if err := stores.Payments.UpdateMode(&models.PaymentMode{ID: mode.ID + 100, Mode: "UPI"}); err != store.ErrNotFound {
+			t.Errorf("updating a missing mode = %v, want %v", err, store.ErrNotFound)
+		}
+
+		// A mode purchases were made with is kept
+		purchase := f.order(userID, f.product(5, 100), 1, "")
+		if err := stores.Payments.DeleteMode(purchase.PaymentID); err != store.ErrModeInUse {
+			t.Errorf("deleting a mode in use = %v, want %v", err, store.ErrModeInUse)
+		}
+		if err := stores.Payments.DeleteMode(mode.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Payments.GetMode(mode.ID); err != store.ErrNotFound {
+			t.Errorf("GetMode after DeleteMode = %v, want %v", err, store.ErrNotFound)
+		}
+		if modes, err := stores.Payments.ListModes(); err != nil || len(modes) != 1 || modes[0].ID != purchase.PaymentID {
+			t.Errorf("modes = %v, %v, want only the mode in use", modes, err)
+		}
+	})
+}
@@ -0,0 +1,320 @@
+package store
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// ProductStore stores products and their weight variants
+type ProductStore interface {
+	// List returns every product with its weights
+	List() ([]*models.Product, error)
+	// Get returns a product with its weights
+	Get(id int) (*models.Product, error)
+	// Create stores a product and its weights, assigning their IDs
+	Create(product *models.Product) error
+	// Update changes the product details and adds or updates the given weights, matched by weight
+	Update(product *models.Product) error
+	// Delete removes a product and its weights
+	Delete(id int) error
+
+	// GetWeight returns a single weight variant
+	GetWeight(id int) (*models.ProductWeight, error)
+	// CreateWeight stores a weight variant, assigning its ID
+	CreateWeight(weight *models.ProductWeight) error
+	// UpdateWeight changes a weight variant of weight.ProductID
+	UpdateWeight(weight *models.ProductWeight) error
+	// ReplaceWeight removes a weight variant and stores weight in its place under a new ID
+	ReplaceWeight(id int, weight *models.ProductWeight) error
+}
+
+const (
+	productColumns = `id, name, description, category, ingredients, nutritional_info, image_urls, created_at, updated_at,
+		(SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE reviews.product_id = products.id AND reviews.status = 'published'),
+		(SELECT COUNT(*) FROM reviews WHERE reviews.product_id = products.id AND reviews.status = 'published')`
+	weightColumns = `id, product_id, weight, price, stock, measurement, created_at, updated_at`
+)
+
+type sqlProductStore struct {
+	db *db.Repository
+}
+
+// scanner is satisfied by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProduct(row scanner) (*models.Product, error) {
+	product := &models.Product{}
+	var imageURLs string
+	err := row.Scan(&product.ID, &product.Name, &product.Description, &product.Category, &product.Ingredients, &product.NutritionalInfo, &imageURLs, &product.CreatedAt, &product.UpdatedAt,
+		&product.AverageRating, &product.ReviewCount)
+	if err != nil {
+		return nil, err
+	}
+	product.AverageRating = math.Round(product.AverageRating*100) / 100
+
+	// Image URLs are stored comma-separated
+	product.ImageURLs = strings.Split(imageURLs, ",")
+	return product, nil
+}
+
+func scanWeight(row scanner) (*models.ProductWeight, error) {
+	weight := &models.ProductWeight{}
+	err := row.Scan(&weight.ID, &weight.ProductID, &weight.Weight, &weight.Price, &weight.StockAvailability, &weight.Measurement, &weight.CreatedAt, &weight.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return weight, nil
+}
+
+func (s *sqlProductStore) List() ([]*models.Product, error) {
+	rows, err := s.db.Query(`SELECT ` + productColumns + ` FROM products`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []*models.Product
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, product := range products {
+		product.Weights, err = s.weights(product.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return products, nil
+}
+
+func (s *sqlProductStore) Get(id int) (*models.Product, error) {
+	product, err := scanProduct(s.db.QueryRow(`SELECT `+productColumns+` FROM products WHERE id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	product.Weights, err = s.weights(product.ID)
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// weights returns the weight variants of a product
+func (s *sqlProductStore) weights(productID int) ([]*models.ProductWeight, error) {
+	rows, err := s.db.Query(`SELECT `+weightColumns+` FROM product_weights WHERE product_id = ?`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var weights []*models.ProductWeight
+	for rows.Next() {
+		weight, err := scanWeight(rows)
+		if err != nil {
+			return nil, err
+		}
+		weights = append(weights, weight)
+	}
+	return weights, rows.Err()
+}
+
+func (s *sqlProductStore) Create(product *models.Product) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO products (name, description, category, ingredients, nutritional_info, image_urls, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	productID, err := tx.InsertReturningID(query, "id", product.Name, product.Description, product.Category, product.Ingredients, product.NutritionalInfo, strings.Join(product.ImageURLs, ","), product.CreatedAt, product.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	product.ID = int(productID)
+
+	for _, weight := range product.Weights {
+		weight.ProductID = product.ID
+		if err := insertWeight(tx, weight); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlProductStore) Update(product *models.Product) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE products SET name = ?, description = ?, category = ?, ingredients = ?, nutritional_info = ?, image_urls = ?, updated_at = ? WHERE id = ?`
+	result, err := tx.Exec(query, product.Name, product.Description, product.Category, product.Ingredients, product.NutritionalInfo, strings.Join(product.ImageURLs, ","), product.UpdatedAt, product.ID)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, weight := range product.Weights {
+		weight.ProductID = product.ID
+
+		var weightID int
+		err := tx.QueryRow(`SELECT id FROM product_weights WHERE product_id = ? AND weight = ?`, weight.ProductID, weight.Weight).Scan(&weightID)
+		if err == sql.ErrNoRows {
+			err = insertWeight(tx, weight)
+		} else if err == nil {
+			weight.ID = weightID
+			_, err = tx.Exec(`UPDATE product_weights SET price = ?, updated_at = ? WHERE id = ?`, weight.Price, weight.UpdatedAt, weight.ID)
+			if err == nil {
+				err = setStock(tx, weight.ID, weight.StockAvailability, "Stock set with the product")
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlProductStore) Delete(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Weights and reviews go first so the foreign keys hold
+	_, err = tx.Exec(`DELETE FROM product_weights WHERE product_id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM reviews WHERE product_id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM products WHERE id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlProductStore) GetWeight(id int) (*models.ProductWeight, error) {
+	weight, err := scanWeight(s.db.QueryRow(`SELECT `+weightColumns+` FROM product_weights WHERE id = ?`, id))
+	return weight, notFound(err)
+}
+
+func (s *sqlProductStore) CreateWeight(weight *models.ProductWeight) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := insertWeight(tx, weight); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlProductStore) UpdateWeight(weight *models.ProductWeight) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE product_weights SET weight = ?, price = ?, updated_at = ?, measurement = ? WHERE product_id = ? AND id = ?`
+	result, err := tx.Exec(query, weight.Weight, weight.Price, weight.UpdatedAt, weight.Measurement, weight.ProductID, weight.ID)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err == nil {
+		err = setStock(tx, weight.ID, weight.StockAvailability, "Stock set with the variant")
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlProductStore) ReplaceWeight(id int, weight *models.ProductWeight) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// The stock of the old variant leaves the ledger before it goes
+	err = setStock(tx, id, 0, "Variant replaced")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM product_weights WHERE id = ?`, id)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := insertWeight(tx, weight); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertWeight stores a weight variant within a transaction, assigns its ID and
+// records its stock as the opening movement
+func insertWeight(tx *db.Tx, weight *models.ProductWeight) error {
+	if weight.CreatedAt.IsZero() {
+		weight.CreatedAt = time.Now()
+	}
+	if weight.UpdatedAt.IsZero() {
+		weight.UpdatedAt = weight.CreatedAt
+	}
+
+	query := `INSERT INTO product_weights (product_id, weight, price, stock, created_at, updated_at, measurement) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	id, err := tx.InsertReturningID(query, "id", weight.ProductID, weight.Weight, weight.Price, weight.StockAvailability, weight.CreatedAt, weight.UpdatedAt, weight.Measurement)
+	if err != nil {
+		return err
+	}
+	weight.ID = int(id)
+
+	if weight.StockAvailability == 0 {
+		return nil
+	}
+	return insertMovement(tx, &models.StockMovement{
+		ProductWeightID: weight.ID,
+		MovementType:    models.StockMovementAdjustment,
+		Quantity:        weight.StockAvailability,
+		Note:            "Initial stock",
+		CreatedAt:       weight.CreatedAt,
+	})
+}
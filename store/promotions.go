@@ -0,0 +1,225 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+var (
+	// ErrInvalidPromotion is returned when a discount code cannot be applied to an order
+	ErrInvalidPromotion = errors.New("discount code cannot be applied")
+	// ErrPromotionInUse is returned when deleting a promotion that purchases were discounted with
+	ErrPromotionInUse = errors.New("promotion is in use")
+)
+
+// PromotionStore stores promotions
+type PromotionStore interface {
+	// Create stores a promotion, assigning its ID
+	Create(promotion *models.Promotion) error
+	// Get returns a promotion
+	Get(id int) (*models.Promotion, error)
+	// GetByCode returns the promotion with a discount code
+	GetByCode(code string) (*models.Promotion, error)
+	// List returns every promotion
+	List() ([]*models.Promotion, error)
+	// Update changes a promotion
+	Update(promotion *models.Promotion) error
+	// Delete removes a promotion. It returns ErrPromotionInUse when purchases were discounted with it.
+	Delete(id int) error
+	// Quote prices the discount a code gives on the items userID is about to buy, the
+	// way placing the order would. Only ProductID, ProductPrice and Quantity of the
+	// items are read. It returns ErrInvalidPromotion, with the reason, when the code
+	// cannot be applied.
+	Quote(userID int, code string, items []*models.PurchaseItem) (*models.PurchaseDiscount, error)
+}
+
+const promotionColumns = `promotion_id, discount_code, product_id, category, discount_type, discount_percentage, discount_amount,
+	min_order_value, usage_limit_per_user, start_date, end_date, is_active, created_at, updated_at`
+
+// queryRower runs single row queries, on the database or within a transaction
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type sqlPromotionStore struct {
+	db *db.Repository
+}
+
+func scanPromotion(row scanner) (*models.Promotion, error) {
+	promotion := &models.Promotion{}
+	var startDate, endDate sql.NullTime
+	err := row.Scan(&promotion.PromotionID, &promotion.DiscountCode, &promotion.ProductID, &promotion.Category,
+		&promotion.DiscountType, &promotion.DiscountPercentage, &promotion.DiscountAmount, &promotion.MinOrderValue,
+		&promotion.UsageLimitPerUser, &startDate, &endDate, &promotion.IsActive, &promotion.CreatedAt, &promotion.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	promotion.StartDate = startDate.Time
+	promotion.EndDate = endDate.Time
+	return promotion, nil
+}
+
+func (s *sqlPromotionStore) Create(promotion *models.Promotion) error {
+	query := `INSERT INTO promotions (discount_code, product_id, category, discount_type, discount_percentage, discount_amount,
+			min_order_value, usage_limit_per_user, start_date, end_date, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.db.InsertReturningID(query, "promotion_id", promotion.DiscountCode, promotion.ProductID, promotion.Category,
+		promotion.DiscountType, promotion.DiscountPercentage, promotion.DiscountAmount, promotion.MinOrderValue,
+		promotion.UsageLimitPerUser, nullTime(promotion.StartDate), nullTime(promotion.EndDate), promotion.IsActive,
+		promotion.CreatedAt, promotion.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	promotion.PromotionID = int(id)
+	return nil
+}
+
+func (s *sqlPromotionStore) Get(id int) (*models.Promotion, error) {
+	promotion, err := scanPromotion(s.db.QueryRow(`SELECT `+promotionColumns+` FROM promotions WHERE promotion_id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return promotion, nil
+}
+
+func (s *sqlPromotionStore) GetByCode(code string) (*models.Promotion, error) {
+	promotion, err := getPromotionByCode(s.db, code)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return promotion, nil
+}
+
+// getPromotionByCode returns the promotion with a discount code, in any case
+func getPromotionByCode(q queryRower, code string) (*models.Promotion, error) {
+	return scanPromotion(q.QueryRow(`SELECT `+promotionColumns+` FROM promotions WHERE discount_code = ?`, models.NormalizeDiscountCode(code)))
+}
+
+func (s *sqlPromotionStore) List() ([]*models.Promotion, error) {
+	rows, err := s.db.Query(`SELECT ` + promotionColumns + ` FROM promotions ORDER BY promotion_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []*models.Promotion
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+func (s *sqlPromotionStore) Update(promotion *models.Promotion) error {
+	query := `UPDATE promotions SET discount_code = ?, product_id = ?, category = ?, discount_type = ?, discount_percentage = ?,
+			discount_amount = ?, min_order_value = ?, usage_limit_per_user = ?, start_date = ?, end_date = ?, is_active = ?, updated_at = ?
+		WHERE promotion_id = ?`
+	result, err := s.db.Exec(query, promotion.DiscountCode, promotion.ProductID, promotion.Category, promotion.DiscountType,
+		promotion.DiscountPercentage, promotion.DiscountAmount, promotion.MinOrderValue, promotion.UsageLimitPerUser,
+		nullTime(promotion.StartDate), nullTime(promotion.EndDate), promotion.IsActive, promotion.UpdatedAt, promotion.PromotionID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlPromotionStore) Delete(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM purchase_discounts WHERE promotion_id = ?`, id).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return ErrPromotionInUse
+	}
+
+	result, err := tx.Exec(`DELETE FROM promotions WHERE promotion_id = ?`, id)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlPromotionStore) Quote(userID int, code string, items []*models.PurchaseItem) (*models.PurchaseDiscount, error) {
+	return priceDiscount(s.db, userID, code, items, time.Now())
+}
+
+// priceDiscount checks that a discount code can be applied to an order of items by
+// userID at now and returns the discount line it gives
+func priceDiscount(q queryRower, userID int, code string, items []*models.PurchaseItem, now time.Time) (*models.PurchaseDiscount, error) {
+	promotion, err := getPromotionByCode(q, code)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if promotion == nil || !promotion.IsActive {
+		return nil, fmt.Errorf("%w: unknown discount code %s", ErrInvalidPromotion, code)
+	}
+	if !promotion.StartDate.IsZero() && now.Before(promotion.StartDate) {
+		return nil, fmt.Errorf("%w: %s is not valid yet", ErrInvalidPromotion, promotion.DiscountCode)
+	}
+	if !promotion.EndDate.IsZero() && now.After(promotion.EndDate) {
+		return nil, fmt.Errorf("%w: %s has expired", ErrInvalidPromotion, promotion.DiscountCode)
+	}
+
+	subtotal, eligible := 0.0, 0.0
+	for _, item := range items {
+		price := item.ProductPrice * float64(item.Quantity)
+		subtotal += price
+
+		// Products removed since have no category
+		var category string
+		err := q.QueryRow(`SELECT category FROM products WHERE id = ?`, item.ProductID).Scan(&category)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if promotion.Applies(item.ProductID, category) {
+			eligible += price
+		}
+	}
+	if subtotal < promotion.MinOrderValue {
+		return nil, fmt.Errorf("%w: %s needs an order of at least %.2f", ErrInvalidPromotion, promotion.DiscountCode, promotion.MinOrderValue)
+	}
+	if eligible == 0 {
+		return nil, fmt.Errorf("%w: %s does not apply to these items", ErrInvalidPromotion, promotion.DiscountCode)
+	}
+
+	if promotion.UsageLimitPerUser > 0 {
+		// Cancelled and refunded orders give the use back
+		var used int
+		query := `SELECT COUNT(*) FROM purchase_discounts JOIN purchases ON purchases.id = purchase_discounts.purchase_id
+			WHERE purchase_discounts.promotion_id = ? AND purchases.user_id = ? AND purchases.status NOT IN (?, ?)`
+		err := q.QueryRow(query, promotion.PromotionID, userID, models.PurchaseStatusCancelled, models.PurchaseStatusRefunded).Scan(&used)
+		if err != nil {
+			return nil, err
+		}
+		if used >= promotion.UsageLimitPerUser {
+			return nil, fmt.Errorf("%w: %s was already used", ErrInvalidPromotion, promotion.DiscountCode)
+		}
+	}
+
+	return &models.PurchaseDiscount{
+		PromotionID:  promotion.PromotionID,
+		DiscountCode: promotion.DiscountCode,
+		Description:  promotion.Description(),
+		Amount:       promotion.DiscountOn(eligible),
+	}, nil
+}
@@ -0,0 +1,148 @@
+package store_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+func TestPromotionPricing(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		sweets := f.product(10, 100)
+		savouries := &models.Product{Name: "Murukku", Category: "savouries", Weights: []*models.ProductWeight{{Weight: 250, Price: 80, StockAvailability: 10, Measurement: "g"}}}
+		if err := stores.Products.Create(savouries); err != nil {
+			t.Fatal(err)
+		}
+		items := []*models.PurchaseItem{
+			{ProductID: sweets.ID, ProductPrice: 100, Quantity: 2},
+			{ProductID: savouries.ID, ProductPrice: 80, Quantity: 1},
+		}
+
+		now := time.Now()
+		promotions := []*models.Promotion{
+			{DiscountCode: "TENPERCENT", DiscountType: models.DiscountTypePercentage, DiscountPercentage: 10, IsActive: true},
+			{DiscountCode: "SAVOURY", Category: "savouries", DiscountType: models.DiscountTypeFixed, DiscountAmount: 100, IsActive: true},
+			{DiscountCode: "BIGORDER", DiscountType: models.DiscountTypeFixed, DiscountAmount: 50, MinOrderValue: 500, IsActive: true},
+			{DiscountCode: "OLD", DiscountType: models.DiscountTypeFixed, DiscountAmount: 50, EndDate: now.Add(-time.Hour), IsActive: true},
+			{DiscountCode: "SOON", DiscountType: models.DiscountTypeFixed, DiscountAmount: 50, StartDate: now.Add(time.Hour), IsActive: true},
+			{DiscountCode: "OFF", DiscountType: models.DiscountTypeFixed, DiscountAmount: 50},
+		}
+		for _, promotion := range promotions {
+			promotion.CreatedAt, promotion.UpdatedAt = now, now
+			if err := stores.Promotions.Create(promotion); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			code   string
+			amount float64
+			valid  bool
+		}{
+			{"TENPERCENT", 28, true},
+			// Codes are matched whatever their case, and fixed amounts never exceed the eligible items
+			{" savoury ", 80, true},
+			{"BIGORDER", 0, false},
+			{"OLD", 0, false},
+			{"SOON", 0, false},
+			{"OFF", 0, false},
+			{"NOSUCHCODE", 0, false},
+		}
+		for _, test := range tests {
+			discount, err := stores.Promotions.Quote(userID, test.code, items)
+			if !test.valid {
+				if !errors.Is(err, store.ErrInvalidPromotion) {
+					t.Errorf("Quote(%q) = %v, want %v", test.code, err, store.ErrInvalidPromotion)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Quote(%q): %v", test.code, err)
+				continue
+			}
+			if discount.Amount != test.amount {
+				t.Errorf("Quote(%q) = %v off, want %v", test.code, discount.Amount, test.amount)
+			}
+		}
+
+		// The order is discounted as quoted, and an invalid code stores nothing
+		purchase := f.order(userID, sweets, 2, "tenpercent")
+		if purchase.Discount != 20 || purchase.TotalPrice != 180 || len(purchase.Discounts) != 1 || purchase.Discounts[0].DiscountCode != "TENPERCENT" {
+			t.Errorf("purchase = %+v", purchase)
+		}
+		order := &models.Purchase{UserID: userID, AddressID: purchase.AddressID, PaymentID: purchase.PaymentID, DiscountCode: "OLD", Items: []*models.PurchaseItem{{ProductID: sweets.ID, ProductWeightID: sweets.Weights[0].ID, Quantity: 1}}}
+		if err := stores.Orders.Create(order); !errors.Is(err, store.ErrInvalidPromotion) {
+			t.Errorf("ordering with an expired code = %v, want %v", err, store.ErrInvalidPromotion)
+		}
+		if stock := f.stock(sweets.Weights[0].ID); stock != 8 {
+			t.Errorf("stock = %d, want the refused order to leave it at 8", stock)
+		}
+	})
+}
+
+func TestPromotionUsageLimit(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		otherID := f.user("ravi@example.com")
+		product := f.product(50, 100)
+		f.promotion("WELCOME", 10, 1)
+		addressID := f.address(userID)
+		paymentID := f.paymentMode("cod")
+
+		// Orders placed at the same time all count against the limit
+		const orders = 8
+		errs := make(chan error, orders)
+		var wg sync.WaitGroup
+		for i := 0; i < orders; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- stores.Orders.Create(&models.Purchase{
+					UserID:       userID,
+					AddressID:    addressID,
+					PaymentID:    paymentID,
+					DiscountCode: "WELCOME",
+					Items:        []*models.PurchaseItem{{ProductID: product.ID, ProductWeightID: product.Weights[0].ID, Quantity: 1}},
+				})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		placed := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				placed++
+			case !errors.Is(err, store.ErrInvalidPromotion):
+				t.Errorf("placing an order: %v", err)
+			}
+		}
+		if placed != 1 {
+			t.Fatalf("%d orders used a code limited to one use", placed)
+		}
+		if stock := f.stock(product.Weights[0].ID); stock != 49 {
+			t.Errorf("stock = %d, want only the order placed taken out", stock)
+		}
+
+		// The limit is per user, and a cancelled order gives the use back
+		f.order(otherID, product, 1, "WELCOME")
+		purchases, err := stores.Orders.ListByUser(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Orders.Cancel(&models.PurchaseStatusChange{PurchaseID: purchases[0].ID, Note: "Changed my mind"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Promotions.Quote(userID, "WELCOME", []*models.PurchaseItem{{ProductID: product.ID, ProductPrice: 100, Quantity: 1}}); err != nil {
+			t.Errorf("quoting after cancelling the order that used the code: %v", err)
+		}
+	})
+}
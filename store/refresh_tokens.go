@@ -0,0 +1,74 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// RefreshTokenStore stores the hashes of issued refresh tokens
+type RefreshTokenStore interface {
+	// Create stores a refresh token, assigning its ID
+	Create(token *models.RefreshToken) error
+	// Get returns the refresh token with the hash
+	Get(tokenHash string) (*models.RefreshToken, error)
+	// MarkRotated records that a token was exchanged for its successor. It reports
+	// false when the token was already rotated or revoked.
+	MarkRotated(id int) (bool, error)
+	// RevokeFamily revokes every token rotated from the same login
+	RevokeFamily(familyID string) error
+	// RevokeUser revokes every token of the user
+	RevokeUser(userID int) error
+}
+
+type sqlRefreshTokenStore struct {
+	db *db.Repository
+}
+
+func (s *sqlRefreshTokenStore) Create(token *models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`
+	id, err := s.db.InsertReturningID(query, "id", token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return err
+	}
+	token.ID = int(id)
+	return nil
+}
+
+func (s *sqlRefreshTokenStore) Get(tokenHash string) (*models.RefreshToken, error) {
+	query := `SELECT id, user_id, token_hash, family_id, expires_at, created_at, rotated_at, revoked_at FROM refresh_tokens WHERE token_hash = ?`
+
+	token := &models.RefreshToken{}
+	var rotatedAt, revokedAt sql.NullTime
+	err := s.db.QueryRow(query, tokenHash).Scan(&token.ID, &token.UserID, &token.TokenHash, &token.FamilyID, &token.ExpiresAt, &token.CreatedAt, &rotatedAt, &revokedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	token.RotatedAt = timePtr(rotatedAt)
+	token.RevokedAt = timePtr(revokedAt)
+	return token, nil
+}
+
+func (s *sqlRefreshTokenStore) MarkRotated(id int) (bool, error) {
+	result, err := s.db.Exec(`UPDATE refresh_tokens SET rotated_at = ? WHERE id = ? AND rotated_at IS NULL AND revoked_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (s *sqlRefreshTokenStore) RevokeFamily(familyID string) error {
+	_, err := s.db.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`, time.Now(), familyID)
+	return err
+}
+
+func (s *sqlRefreshTokenStore) RevokeUser(userID int) error {
+	_, err := s.db.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, time.Now(), userID)
+	return err
+}
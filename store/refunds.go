@@ -0,0 +1,336 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+var (
+	// ErrOverRefund is returned when a refund is for more than is left to refund
+	ErrOverRefund = errors.New("refund exceeds the amount left to refund")
+	// ErrFullRefund is returned when a refund would repay in full a purchase that
+	// cannot move to refunded yet
+	ErrFullRefund = errors.New("only delivered or cancelled purchases are refunded in full")
+)
+
+// refundTolerance absorbs the rounding of amounts summed from prices
+const refundTolerance = 0.005
+
+// RefundStore stores the refunds of purchases
+type RefundStore interface {
+	// Create stores a pending refund of refund.PurchaseID, assigning its ID, and adds
+	// it to the refunded total of the purchase. When Items are given only their
+	// PurchaseItemID and Quantity are read, and the amount is what was paid for them
+	// after their share of the purchase's discount (see models.RefundItemAmount);
+	// otherwise a zero Amount refunds the rest of a payment. The refund is returned
+	// through a single paid payment, which is filled in: a captured payment, or one
+	// collected on delivery once the purchase is delivered. It returns ErrInvalidItem
+	// for items not in the purchase or refunded beyond the quantity bought,
+	// ErrOverRefund when no payment has the amount left to refund, and ErrFullRefund
+	// when it would repay everything paid for a purchase that is not delivered or
+	// cancelled.
+	Create(refund *models.Refund) error
+	// Get returns a refund with its items
+	Get(id int) (*models.Refund, error)
+	// ListByPurchase returns the refunds of a purchase with their items, oldest first
+	ListByPurchase(purchaseID int) ([]*models.Refund, error)
+	// StartProcessing claims a pending refund for sending to its payment provider. It
+	// reports false when the refund is not pending, such as when it is already being sent.
+	StartProcessing(id int) (bool, error)
+	// Release puts a refund that failed to process back to pending so that it can be retried
+	Release(id int) error
+	// Complete marks a refund being processed as processed with the provider's refund
+	// ID. A purchase whose payments have been refunded in full moves to refunded when
+	// its status allows. It returns ErrNotFound when the refund is not being processed.
+	Complete(id int, providerRefundID string) error
+}
+
+const refundColumns = `id, purchase_id, COALESCE(payment_id, 0), COALESCE(provider_refund_id, ''), amount, status, COALESCE(reason, ''), created_at, updated_at`
+
+// paidPayments matches the payments of a purchase that were paid, joined with the purchase
+const paidPayments = `payments.purchase_id = purchases.id AND (payments.status = 'captured' OR (payments.status = 'pending' AND purchases.status IN ('delivered', 'refunded')))`
+
+type sqlRefundStore struct {
+	db *db.Repository
+}
+
+func scanRefund(row scanner) (*models.Refund, error) {
+	refund := &models.Refund{}
+	err := row.Scan(&refund.ID, &refund.PurchaseID, &refund.PaymentID, &refund.ProviderRefundID, &refund.Amount,
+		&refund.Status, &refund.Reason, &refund.CreatedAt, &refund.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (s *sqlRefundStore) Create(refund *models.Refund) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := createRefund(tx, refund); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// createRefund prices a refund, picks the payment it is returned through and stores it
+func createRefund(tx *db.Tx, refund *models.Refund) error {
+	// Writing to the purchase first makes concurrent refunds of it wait for each other
+	result, err := tx.Exec(`UPDATE purchases SET refunded_amount = refunded_amount WHERE id = ?`, refund.PurchaseID)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(result); err != nil {
+		return err
+	}
+
+	if len(refund.Items) > 0 {
+		if err := priceRefundItems(tx, refund); err != nil {
+			return err
+		}
+	}
+
+	query := `SELECT payments.id, payments.amount - COALESCE((SELECT SUM(refunds.amount) FROM refunds WHERE refunds.payment_id = payments.id), 0)
+		FROM payments JOIN purchases ON ` + paidPayments + `
+		WHERE payments.purchase_id = ?
+		ORDER BY payments.id`
+	rows, err := tx.Query(query, refund.PurchaseID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var paymentID int
+		var left float64
+		if err := rows.Scan(&paymentID, &left); err != nil {
+			rows.Close()
+			return err
+		}
+		if refund.PaymentID != 0 || left < refundTolerance {
+			continue
+		}
+		if refund.Amount == 0 {
+			refund.Amount = left
+		}
+		if refund.Amount <= left+refundTolerance {
+			refund.PaymentID = paymentID
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if refund.PaymentID == 0 {
+		return fmt.Errorf("%w: purchase %d", ErrOverRefund, refund.PurchaseID)
+	}
+
+	// A purchase repaid in full that cannot move to refunded could still be shipped;
+	// cancelling it restocks the items and refunds it instead
+	var status string
+	var paid, refunded float64
+	query = `SELECT purchases.status, (SELECT COALESCE(SUM(payments.amount), 0) FROM payments WHERE ` + paidPayments + `), purchases.refunded_amount
+		FROM purchases
+		WHERE purchases.id = ?`
+	err = tx.QueryRow(query, refund.PurchaseID).Scan(&status, &paid, &refunded)
+	if err != nil {
+		return err
+	}
+	if refunded+refund.Amount >= paid-refundTolerance && !models.CanTransitionPurchase(status, models.PurchaseStatusRefunded) {
+		return fmt.Errorf("%w: purchase %d is %s", ErrFullRefund, refund.PurchaseID, status)
+	}
+
+	refund.Status = models.RefundStatusPending
+	if refund.CreatedAt.IsZero() {
+		refund.CreatedAt = time.Now()
+	}
+	refund.UpdatedAt = refund.CreatedAt
+	return insertRefund(tx, refund)
+}
+
+// priceRefundItems fills in what was paid for the items of a refund, with their share of
+// the purchase's discount taken off, and totals them into the refund's amount
+func priceRefundItems(tx *db.Tx, refund *models.Refund) error {
+	var discount float64
+	err := tx.QueryRow(`SELECT discount FROM purchases WHERE id = ?`, refund.PurchaseID).Scan(&discount)
+	if err != nil {
+		return notFound(err)
+	}
+	items, err := purchaseItems(tx, refund.PurchaseID)
+	if err != nil {
+		return err
+	}
+	bought := map[int]int{}
+	for _, item := range items {
+		bought[item.ID] = item.Quantity
+	}
+
+	refunded := map[int]int{}
+	query := `SELECT refund_items.purchase_item_id, SUM(refund_items.quantity)
+		FROM refund_items JOIN purchase_items ON refund_items.purchase_item_id = purchase_items.id
+		WHERE purchase_items.purchase_id = ?
+		GROUP BY refund_items.purchase_item_id`
+	rows, err := tx.Query(query, refund.PurchaseID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var itemID, quantity int
+		if err := rows.Scan(&itemID, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		refunded[itemID] = quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	refund.Amount = 0
+	for _, item := range refund.Items {
+		quantity, ok := bought[item.PurchaseItemID]
+		if !ok {
+			return fmt.Errorf("%w: purchase %d has no item %d", ErrInvalidItem, refund.PurchaseID, item.PurchaseItemID)
+		}
+		if item.Quantity <= 0 || refunded[item.PurchaseItemID]+item.Quantity > quantity {
+			return fmt.Errorf("%w: %d of item %d refunded, %d more requested, %d bought", ErrInvalidItem, refunded[item.PurchaseItemID], item.PurchaseItemID, item.Quantity, quantity)
+		}
+
+		item.Amount = models.RefundItemAmount(items, discount, item.PurchaseItemID, refunded[item.PurchaseItemID], item.Quantity)
+		refunded[item.PurchaseItemID] += item.Quantity
+		refund.Amount += item.Amount
+	}
+	refund.Amount = math.Round(refund.Amount*100) / 100
+	return nil
+}
+
+func (s *sqlRefundStore) Get(id int) (*models.Refund, error) {
+	refund, err := scanRefund(s.db.QueryRow(`SELECT `+refundColumns+` FROM refunds WHERE id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	refund.Items, err = s.items(refund.ID)
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (s *sqlRefundStore) ListByPurchase(purchaseID int) ([]*models.Refund, error) {
+	rows, err := s.db.Query(`SELECT `+refundColumns+` FROM refunds WHERE purchase_id = ? ORDER BY id`, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []*models.Refund
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, refund := range refunds {
+		refund.Items, err = s.items(refund.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refunds, nil
+}
+
+// items returns the purchase items returned in a refund
+func (s *sqlRefundStore) items(refundID int) ([]*models.RefundItem, error) {
+	rows, err := s.db.Query(`SELECT purchase_item_id, quantity, amount FROM refund_items WHERE refund_id = ? ORDER BY id`, refundID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.RefundItem
+	for rows.Next() {
+		item := &models.RefundItem{}
+		if err := rows.Scan(&item.PurchaseItemID, &item.Quantity, &item.Amount); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlRefundStore) StartProcessing(id int) (bool, error) {
+	result, err := s.db.Exec(`UPDATE refunds SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		models.RefundStatusProcessing, time.Now(), id, models.RefundStatusPending)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (s *sqlRefundStore) Release(id int) error {
+	result, err := s.db.Exec(`UPDATE refunds SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		models.RefundStatusPending, time.Now(), id, models.RefundStatusProcessing)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlRefundStore) Complete(id int, providerRefundID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(`UPDATE refunds SET status = ?, provider_refund_id = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		models.RefundStatusProcessed, providerRefundID, now, id, models.RefundStatusProcessing)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var purchaseID int
+	var status string
+	var paid, refunded float64
+	query := `SELECT purchases.id, purchases.status,
+			(SELECT COALESCE(SUM(payments.amount), 0) FROM payments WHERE ` + paidPayments + `),
+			(SELECT COALESCE(SUM(refunds.amount), 0) FROM refunds WHERE refunds.purchase_id = purchases.id AND refunds.status = ?)
+		FROM purchases JOIN refunds ON refunds.purchase_id = purchases.id
+		WHERE refunds.id = ?`
+	err = tx.QueryRow(query, models.RefundStatusProcessed, id).Scan(&purchaseID, &status, &paid, &refunded)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if paid > 0 && refunded >= paid-refundTolerance && models.CanTransitionPurchase(status, models.PurchaseStatusRefunded) {
+		err = updateStatus(tx, &models.PurchaseStatusChange{
+			PurchaseID: purchaseID,
+			ToStatus:   models.PurchaseStatusRefunded,
+			Note:       "Refunded in full",
+			CreatedAt:  now,
+		})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
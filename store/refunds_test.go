@@ -0,0 +1,162 @@
+package store_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+func TestRefundItemsShareTheDiscount(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		f.promotion("TENOFF", 10, 0)
+		purchase := f.order(userID, f.product(10, 100, 50), 3, "TENOFF")
+		if purchase.TotalPrice != 440 || purchase.Discount != 10 {
+			t.Fatalf("purchase total = %v with %v off, want 440 with 10 off", purchase.TotalPrice, purchase.Discount)
+		}
+		f.capture(purchase)
+		f.deliver(purchase.ID)
+
+		// Refunding every unit one at a time returns exactly what was paid
+		total := 0.0
+		for i := 0; i < 3; i++ {
+			for _, item := range purchase.Items {
+				refund := &models.Refund{
+					PurchaseID: purchase.ID,
+					Reason:     "Damaged",
+					Items:      []*models.RefundItem{{PurchaseItemID: item.ID, Quantity: 1}},
+				}
+				if err := stores.Refunds.Create(refund); err != nil {
+					t.Fatalf("refunding a unit of item %d: %v", item.ID, err)
+				}
+				if refund.Amount >= item.ProductPrice || refund.Amount != refund.Items[0].Amount {
+					t.Errorf("unit of item %d priced at %v refunded %v", item.ID, item.ProductPrice, refund.Amount)
+				}
+				total += refund.Amount
+			}
+		}
+		if math.Abs(total-purchase.TotalPrice) > 0.001 {
+			t.Errorf("refunded %v in all, want %v", total, purchase.TotalPrice)
+		}
+
+		// Nothing more can be refunded
+		more := &models.Refund{PurchaseID: purchase.ID, Reason: "Again", Items: []*models.RefundItem{{PurchaseItemID: purchase.Items[0].ID, Quantity: 1}}}
+		if err := stores.Refunds.Create(more); !errors.Is(err, store.ErrInvalidItem) {
+			t.Errorf("refunding an item beyond the quantity bought = %v, want %v", err, store.ErrInvalidItem)
+		}
+		if err := stores.Refunds.Create(&models.Refund{PurchaseID: purchase.ID, Amount: 0.01, Reason: "Again"}); !errors.Is(err, store.ErrOverRefund) {
+			t.Errorf("refunding a fully refunded payment = %v, want %v", err, store.ErrOverRefund)
+		}
+	})
+}
+
+func TestRefundCaps(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		purchase := f.order(userID, f.product(10, 100), 2, "")
+
+		// Nothing is paid yet, so nothing can be refunded
+		if err := stores.Refunds.Create(&models.Refund{PurchaseID: purchase.ID, Amount: 10, Reason: "Early"}); !errors.Is(err, store.ErrOverRefund) {
+			t.Errorf("refunding an unpaid purchase = %v, want %v", err, store.ErrOverRefund)
+		}
+		payment := f.capture(purchase)
+
+		if err := stores.Refunds.Create(&models.Refund{PurchaseID: purchase.ID, Amount: 200.01, Reason: "Too much"}); !errors.Is(err, store.ErrOverRefund) {
+			t.Errorf("refunding more than was paid = %v, want %v", err, store.ErrOverRefund)
+		}
+		other := &models.Refund{PurchaseID: purchase.ID, Reason: "Not ours", Items: []*models.RefundItem{{PurchaseItemID: purchase.Items[0].ID + 100, Quantity: 1}}}
+		if err := stores.Refunds.Create(other); !errors.Is(err, store.ErrInvalidItem) {
+			t.Errorf("refunding an item of another purchase = %v, want %v", err, store.ErrInvalidItem)
+		}
+
+		partial := &models.Refund{PurchaseID: purchase.ID, Amount: 50, Reason: "Late"}
+		if err := stores.Refunds.Create(partial); err != nil {
+			t.Fatal(err)
+		}
+		if partial.PaymentID != payment.ID || partial.Status != models.RefundStatusPending {
+			t.Errorf("refund = %+v", partial)
+		}
+
+		// The rest is only refunded once the purchase is delivered; before that it could
+		// still ship, so it is cancelled instead
+		if err := stores.Refunds.Create(&models.Refund{PurchaseID: purchase.ID, Reason: "Cancelled"}); !errors.Is(err, store.ErrFullRefund) {
+			t.Errorf("refunding an undelivered purchase in full = %v, want %v", err, store.ErrFullRefund)
+		}
+		f.deliver(purchase.ID)
+
+		// A zero amount refunds the rest of the payment
+		rest := &models.Refund{PurchaseID: purchase.ID, Reason: "Cancelled"}
+		if err := stores.Refunds.Create(rest); err != nil {
+			t.Fatal(err)
+		}
+		if rest.Amount != 150 {
+			t.Errorf("rest of the payment refunded = %v, want 150", rest.Amount)
+		}
+
+		refunds, err := stores.Refunds.ListByPurchase(purchase.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(refunds) != 2 || refunds[0].ID != partial.ID || refunds[1].ID != rest.ID {
+			t.Errorf("refunds = %+v", refunds)
+		}
+	})
+}
+
+func TestRefundProcessing(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		purchase := f.order(userID, f.product(10, 100), 1, "")
+		f.capture(purchase)
+		f.deliver(purchase.ID)
+
+		refund := &models.Refund{PurchaseID: purchase.ID, Reason: "Returned"}
+		if err := stores.Refunds.Create(refund); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only a refund being processed can be completed or released
+		if err := stores.Refunds.Complete(refund.ID, "rfnd_1"); err != store.ErrNotFound {
+			t.Errorf("completing a pending refund = %v, want %v", err, store.ErrNotFound)
+		}
+		if err := stores.Refunds.Release(refund.ID); err != store.ErrNotFound {
+			t.Errorf("releasing a pending refund = %v, want %v", err, store.ErrNotFound)
+		}
+
+		if claimed, err := stores.Refunds.StartProcessing(refund.ID); err != nil || !claimed {
+			t.Fatalf("StartProcessing = %v, %v", claimed, err)
+		}
+		if claimed, err := stores.Refunds.StartProcessing(refund.ID); err != nil || claimed {
+			t.Errorf("claiming a refund twice = %v, %v", claimed, err)
+		}
+		if err := stores.Refunds.Release(refund.ID); err != nil {
+			t.Fatal(err)
+		}
+		if claimed, err := stores.Refunds.StartProcessing(refund.ID); err != nil || !claimed {
+			t.Fatalf("StartProcessing after Release = %v, %v", claimed, err)
+		}
+		if err := stores.Refunds.Complete(refund.ID, "rfnd_1"); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := stores.Refunds.Get(refund.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != models.RefundStatusProcessed || got.ProviderRefundID != "rfnd_1" {
+			t.Errorf("refund = %+v", got)
+		}
+		if status := f.purchaseStatus(purchase.ID); status != models.PurchaseStatusRefunded {
+			t.Errorf("purchase refunded in full is %s, want %s", status, models.PurchaseStatusRefunded)
+		}
+		if err := stores.Refunds.Complete(refund.ID, "rfnd_2"); err != store.ErrNotFound {
+			t.Errorf("completing a processed refund = %v, want %v", err, store.ErrNotFound)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// ReviewStore stores the reviews of products
+type ReviewStore interface {
+	// Create stores a review, assigning its ID. It reports false without storing
+	// anything when the user already reviewed the product.
+	Create(review *models.Review) (bool, error)
+	// Get returns a review
+	Get(id int) (*models.Review, error)
+	// ListByProduct returns the reviews of a product, newest first. An empty status returns every review.
+	ListByProduct(productID int, status string) ([]*models.Review, error)
+	// List returns the reviews of every product, newest first. An empty status returns every review.
+	List(status string) ([]*models.Review, error)
+	// Update changes the rating, text, status and moderation note of a review
+	Update(review *models.Review) error
+	// Delete removes a review
+	Delete(id int) error
+	// HasPurchased reports whether the user received the product in a delivered purchase
+	HasPurchased(userID, productID int) (bool, error)
+}
+
+const reviewColumns = `review_id, product_id, user_id, rating, review_text, status, moderation_note, created_at, updated_at`
+
+type sqlReviewStore struct {
+	db *db.Repository
+}
+
+func scanReview(row scanner) (*models.Review, error) {
+	review := &models.Review{}
+	err := row.Scan(&review.ReviewID, &review.ProductID, &review.UserID, &review.Rating, &review.ReviewText,
+		&review.Status, &review.ModerationNote, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+func (s *sqlReviewStore) Create(review *models.Review) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	// A concurrent review of the same product by the user makes this insert a no-op rather than an error
+	query := `INSERT INTO reviews (product_id, user_id, rating, review_text, status, moderation_note, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (product_id, user_id) DO NOTHING`
+	result, err := tx.Exec(query, review.ProductID, review.UserID, review.Rating, review.ReviewText,
+		review.Status, review.ModerationNote, review.CreatedAt, review.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil || inserted == 0 {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = tx.QueryRow(`SELECT review_id FROM reviews WHERE product_id = ? AND user_id = ?`, review.ProductID, review.UserID).Scan(&review.ReviewID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *sqlReviewStore) Get(id int) (*models.Review, error) {
+	review, err := scanReview(s.db.QueryRow(`SELECT `+reviewColumns+` FROM reviews WHERE review_id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return review, nil
+}
+
+func (s *sqlReviewStore) ListByProduct(productID int, status string) ([]*models.Review, error) {
+	if status == "" {
+		return s.list(`SELECT `+reviewColumns+` FROM reviews WHERE product_id = ? ORDER BY created_at DESC, review_id DESC`, productID)
+	}
+	return s.list(`SELECT `+reviewColumns+` FROM reviews WHERE product_id = ? AND status = ? ORDER BY created_at DESC, review_id DESC`, productID, status)
+}
+
+func (s *sqlReviewStore) List(status string) ([]*models.Review, error) {
+	if status == "" {
+		return s.list(`SELECT ` + reviewColumns + ` FROM reviews ORDER BY created_at DESC, review_id DESC`)
+	}
+	return s.list(`SELECT `+reviewColumns+` FROM reviews WHERE status = ? ORDER BY created_at DESC, review_id DESC`, status)
+}
+
+// list returns the reviews a query selects
+func (s *sqlReviewStore) list(query string, args ...interface{}) ([]*models.Review, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []*models.Review
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+func (s *sqlReviewStore) Update(review *models.Review) error {
+	query := `UPDATE reviews SET rating = ?, review_text = ?, status = ?, moderation_note = ?, updated_at = ? WHERE review_id = ?`
+	result, err := s.db.Exec(query, review.Rating, review.ReviewText, review.Status, review.ModerationNote, review.UpdatedAt, review.ReviewID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlReviewStore) Delete(id int) error {
+	result, err := s.db.Exec(`DELETE FROM reviews WHERE review_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlReviewStore) HasPurchased(userID, productID int) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM purchase_items JOIN purchases ON purchases.id = purchase_items.purchase_id
+		WHERE purchases.user_id = ? AND purchase_items.product_id = ? AND purchases.status = ?`
+	err := s.db.QueryRow(query, userID, productID, models.PurchaseStatusDelivered).Scan(&count)
+	return count > 0, err
+}
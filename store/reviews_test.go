@@ -0,0 +1,104 @@
+package store_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+)
+
+func TestReviews(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		product := f.product(10, 100)
+
+		// Only a delivered purchase counts as having bought the product
+		purchase := f.order(userID, product, 1, "")
+		if bought, err := stores.Reviews.HasPurchased(userID, product.ID); err != nil || bought {
+			t.Errorf("HasPurchased before delivery = %v, %v", bought, err)
+		}
+		f.deliver(purchase.ID)
+		if bought, err := stores.Reviews.HasPurchased(userID, product.ID); err != nil || !bought {
+			t.Errorf("HasPurchased after delivery = %v, %v", bought, err)
+		}
+
+		now := time.Now()
+		review := &models.Review{ProductID: product.ID, UserID: userID, Rating: 4, ReviewText: "Fresh", Status: models.ReviewStatusPublished, CreatedAt: now, UpdatedAt: now}
+		if created, err := stores.Reviews.Create(review); err != nil || !created || review.ReviewID == 0 {
+			t.Fatalf("Create = %v, %v with ID %d", created, err, review.ReviewID)
+		}
+		again := &models.Review{ProductID: product.ID, UserID: userID, Rating: 1, Status: models.ReviewStatusPublished, CreatedAt: now, UpdatedAt: now}
+		if created, err := stores.Reviews.Create(again); err != nil || created {
+			t.Errorf("reviewing a product twice = %v, %v", created, err)
+		}
+
+		review.Status, review.ModerationNote = models.ReviewStatusHidden, "Spam"
+		if err := stores.Reviews.Update(review); err != nil {
+			t.Fatal(err)
+		}
+		if published, err := stores.Reviews.ListByProduct(product.ID, models.ReviewStatusPublished); err != nil || len(published) != 0 {
+			t.Errorf("published reviews = %v, %v, want none", published, err)
+		}
+		reviews, err := stores.Reviews.List("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reviews) != 1 || reviews[0].Rating != 4 || reviews[0].ModerationNote != "Spam" {
+			t.Errorf("reviews = %+v", reviews)
+		}
+
+		if err := stores.Reviews.Delete(review.ReviewID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Reviews.Get(review.ReviewID); err != store.ErrNotFound {
+			t.Errorf("Get after Delete = %v, want %v", err, store.ErrNotFound)
+		}
+	})
+}
+
+func TestReviewsCreatedConcurrently(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+		product := f.product(10, 100)
+
+		// Reviews of the same product by the same user sent at the same time store only one
+		const reviews = 8
+		type result struct {
+			created bool
+			err     error
+		}
+		results := make(chan result, reviews)
+		var wg sync.WaitGroup
+		for i := 0; i < reviews; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				now := time.Now()
+				created, err := stores.Reviews.Create(&models.Review{ProductID: product.ID, UserID: userID, Rating: 5, Status: models.ReviewStatusPublished, CreatedAt: now, UpdatedAt: now})
+				results <- result{created, err}
+			}()
+		}
+		wg.Wait()
+		close(results)
+
+		created := 0
+		for result := range results {
+			if result.err != nil {
+				t.Errorf("creating a review: %v", result.err)
+			}
+			if result.created {
+				created++
+			}
+		}
+		if created != 1 {
+			t.Errorf("%d reviews were created, want 1", created)
+		}
+		if stored, err := stores.Reviews.ListByProduct(product.ID, ""); err != nil || len(stored) != 1 {
+			t.Errorf("reviews = %v, %v, want 1", stored, err)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// Package store defines the storage interfaces used by the services, one per
+// aggregate, together with their SQL implementations. In-memory implementations
+// for tests live in the memstore sub-package.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = errors.New("not found")
+
+// Stores bundles every store so that services can be wired from a single value
+type Stores struct {
+	Products      ProductStore
+	Carts         CartStore
+	Orders        OrderStore
+	Payments      PaymentStore
+	Refunds       RefundStore
+	Promotions    PromotionStore
+	Offers        OfferStore
+	Reviews       ReviewStore
+	Suppliers     SupplierStore
+	Inventory     InventoryStore
+	Users         UserStore
+	Addresses     AddressStore
+	Wishlists     WishlistStore
+	OTPs          OTPStore
+	RefreshTokens RefreshTokenStore
+	Idempotency   IdempotencyStore
+}
+
+// NewSQLStores creates stores backed by the given database
+func NewSQLStores(repo *db.Repository) *Stores {
+	return &Stores{
+		Products:      &sqlProductStore{db: repo},
+		Carts:         &sqlCartStore{db: repo},
+		Orders:        &sqlOrderStore{db: repo},
+		Payments:      &sqlPaymentStore{db: repo},
+		Refunds:       &sqlRefundStore{db: repo},
+		Promotions:    &sqlPromotionStore{db: repo},
+		Offers:        &sqlOfferStore{db: repo},
+		Reviews:       &sqlReviewStore{db: repo},
+		Suppliers:     &sqlSupplierStore{db: repo},
+		Inventory:     &sqlInventoryStore{db: repo},
+		Users:         &sqlUserStore{db: repo},
+		Addresses:     &sqlAddressStore{db: repo},
+		Wishlists:     &sqlWishlistStore{db: repo},
+		OTPs:          &sqlOTPStore{db: repo},
+		RefreshTokens: &sqlRefreshTokenStore{db: repo},
+		Idempotency:   &sqlIdempotencyStore{db: repo},
+	}
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// checkAffected returns ErrNotFound when a statement changed no rows
+func checkAffected(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// lockRow takes the write lock of a row for the rest of the transaction, so that
+// transactions that read and then change what belongs to the row run one after the
+// other. The no-op update locks the row on PostgreSQL and the database on SQLite.
+// It returns ErrNotFound when there is no such row.
+func lockRow(tx *db.Tx, table, idColumn string, id int) error {
+	result, err := tx.Exec(`UPDATE `+table+` SET `+idColumn+` = `+idColumn+` WHERE `+idColumn+` = ?`, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// timePtr converts a nullable column to a pointer that is nil for NULL
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// nullTime converts a time to a nullable column value that is NULL for the zero time
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// nullInt converts an ID to a nullable column value that is NULL for zero
+func nullInt(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
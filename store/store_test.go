@@ -0,0 +1,247 @@
+package store_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/db/dbtest"
+	"github.com/gklps/mittai-backend/models"
+	"github.com/gklps/mittai-backend/store"
+	"github.com/gklps/mittai-backend/store/memstore"
+	"github.com/gklps/mittai-backend/utils"
+)
+
+// runStores runs test against the in-memory stores and the SQL stores of every
+// available dialect, so that both implementations are held to the same behaviour
+func runStores(t *testing.T, test func(t *testing.T, stores *store.Stores)) {
+	t.Run("memstore", func(t *testing.T) {
+		test(t, memstore.New())
+	})
+	dbtest.RunMigrated(t, func(t *testing.T, repo *db.Repository) {
+		test(t, store.NewSQLStores(repo))
+	})
+}
+
+// fixtures creates the records most tests start from
+type fixtures struct {
+	t      *testing.T
+	stores *store.Stores
+}
+
+// user stores a customer and returns their ID
+func (f fixtures) user(email string) int {
+	f.t.Helper()
+	user := &models.User{FirstName: "Test", Email: email, ContactNumber: email, Password: "hash"}
+	if err := f.stores.Users.Create(user); err != nil {
+		f.t.Fatal(err)
+	}
+	return user.UserID
+}
+
+// product stores a product with one weight variant per price, each with stock in hand
+func (f fixtures) product(stock int, prices ...float64) *models.Product {
+	f.t.Helper()
+	now := time.Now()
+	product := &models.Product{Name: "Laddu", ImageURLs: []string{"laddu.jpg"}, CreatedAt: now, UpdatedAt: now}
+	for i, price := range prices {
+		product.Weights = append(product.Weights, &models.ProductWeight{
+			Weight:            250 * (i + 1),
+			Price:             price,
+			StockAvailability: stock,
+			Measurement:       "g",
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		})
+	}
+	if err := f.stores.Products.Create(product); err != nil {
+		f.t.Fatal(err)
+	}
+	return product
+}
+
+// address stores an address of the user and returns its ID
+func (f fixtures) address(userID int) int {
+	f.t.Helper()
+	address := &models.Address{UserID: userID, AddressLine1: "1 Main Road", City: "Chennai", ZipCode: "600001"}
+	if err := f.stores.Addresses.Create(address); err != nil {
+		f.t.Fatal(err)
+	}
+	return address.AddressID
+}
+
+// paymentMode stores an active payment mode collected by provider and returns its ID
+func (f fixtures) paymentMode(provider string) int {
+	f.t.Helper()
+	mode := &models.PaymentMode{Mode: provider, Provider: provider, IsActive: true}
+	if err := f.stores.Payments.CreateMode(mode); err != nil {
+		f.t.Fatal(err)
+	}
+	return mode.ID
+}
+
+// order places an order of the weight variants of product, quantity units of each, with the discount code
+func (f fixtures) order(userID int, product *models.Product, quantity int, code string) *models.Purchase {
+	f.t.Helper()
+	now := time.Now()
+	purchase := &models.Purchase{
+		UserID:       userID,
+		AddressID:    f.address(userID),
+		PaymentID:    f.paymentMode("fake"),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		DiscountCode: code,
+	}
+	for _, weight := range product.Weights {
+		purchase.Items = append(purchase.Items, &models.PurchaseItem{ProductID: product.ID, ProductWeightID: weight.ID, Quantity: quantity})
+	}
+	if err := f.stores.Orders.Create(purchase); err != nil {
+		f.t.Fatal(err)
+	}
+	return purchase
+}
+
+// capture stores a payment of the purchase's total and captures it
+func (f fixtures) capture(purchase *models.Purchase) *models.Payment {
+	f.t.Helper()
+	now := time.Now()
+	payment := &models.Payment{
+		PurchaseID:      purchase.ID,
+		Provider:        "fake",
+		ProviderOrderID: fmt.Sprintf("order_%d", purchase.ID),
+		Amount:          purchase.TotalPrice,
+		Currency:        "INR",
+		Status:          models.PaymentStatusCreated,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if _, err := f.stores.Payments.Create(payment); err != nil {
+		f.t.Fatal(err)
+	}
+	if captured, err := f.stores.Payments.Capture(payment.ID, fmt.Sprintf("pay_%d", payment.ID)); err != nil || !captured {
+		f.t.Fatalf("Capture = %v, %v", captured, err)
+	}
+	return payment
+}
+
+// promotion stores an active promotion with the code taking amount off every order
+func (f fixtures) promotion(code string, amount float64, usageLimit int) *models.Promotion {
+	f.t.Helper()
+	now := time.Now()
+	promotion := &models.Promotion{
+		DiscountCode:      code,
+		DiscountType:      models.DiscountTypeFixed,
+		DiscountAmount:    amount,
+		UsageLimitPerUser: usageLimit,
+		IsActive:          true,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if err := f.stores.Promotions.Create(promotion); err != nil {
+		f.t.Fatal(err)
+	}
+	return promotion
+}
+
+// purchaseStatus returns the status of a stored purchase
+func (f fixtures) purchaseStatus(purchaseID int) string {
+	f.t.Helper()
+	purchase, err := f.stores.Orders.Get(purchaseID)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return purchase.Status
+}
+
+// stock returns the stock in hand of a weight variant
+func (f fixtures) stock(productWeightID int) int {
+	f.t.Helper()
+	weight, err := f.stores.Products.GetWeight(productWeightID)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return weight.StockAvailability
+}
+
+func TestProducts(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		product := f.product(4, 100, 190)
+		if product.ID == 0 || product.Weights[0].ID == 0 || product.Weights[1].ID == product.Weights[0].ID {
+			t.Fatalf("IDs were not assigned: %+v", product)
+		}
+
+		got, err := stores.Products.Get(product.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "Laddu" || len(got.Weights) != 2 || got.Weights[1].Price != 190 || got.Weights[1].StockAvailability != 4 {
+			t.Errorf("product = %+v", got)
+		}
+
+		if err := stores.Products.Delete(product.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Products.Get(product.ID); err != store.ErrNotFound {
+			t.Errorf("Get after Delete = %v, want %v", err, store.ErrNotFound)
+		}
+		if _, err := stores.Products.GetWeight(product.Weights[0].ID); err != store.ErrNotFound {
+			t.Errorf("GetWeight after Delete = %v, want %v", err, store.ErrNotFound)
+		}
+	})
+}
+
+func TestUsers(t *testing.T) {
+	runStores(t, func(t *testing.T, stores *store.Stores) {
+		f := fixtures{t, stores}
+		userID := f.user("asha@example.com")
+
+		user, err := stores.Users.GetByEmail("asha@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.UserID != userID || user.Password != "hash" || user.VerifiedAccount || user.Role != utils.RoleCustomer {
+			t.Errorf("user = %+v", user)
+		}
+		if exists, err := stores.Users.ContactNumberExists("asha@example.com"); err != nil || !exists {
+			t.Errorf("ContactNumberExists = %v, %v", exists, err)
+		}
+
+		if err := stores.Users.SetVerified(userID, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Users.SetRole(userID, utils.RoleStaff); err != nil {
+			t.Fatal(err)
+		}
+		if role, err := stores.Users.Role(userID); err != nil || role != utils.RoleStaff {
+			t.Errorf("Role = %q, %v", role, err)
+		}
+		if err := stores.Users.SetRole(userID+100, utils.RoleStaff); err != store.ErrNotFound {
+			t.Errorf("SetRole of a missing user = %v, want %v", err, store.ErrNotFound)
+		}
+
+		if err := stores.Users.Delete(userID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Users.Get(userID); err != store.ErrNotFound {
+			t.Errorf("Get after Delete = %v, want %v", err, store.ErrNotFound)
+		}
+	})
+}
+
+// deliver moves a purchase through every status after its current one up to delivered
+func (f fixtures) deliver(purchaseID int) {
+	f.t.Helper()
+	current := f.purchaseStatus(purchaseID)
+	statuses := []string{models.PurchaseStatusConfirmed, models.PurchaseStatusPreparing, models.PurchaseStatusShipped, models.PurchaseStatusDelivered}
+	for _, status := range statuses {
+		if !models.CanTransitionPurchase(current, status) {
+			continue
+		}
+		if err := f.stores.Orders.UpdateStatus(&models.PurchaseStatusChange{PurchaseID: purchaseID, ToStatus: status}); err != nil {
+			f.t.Fatalf("moving purchase %d to %s: %v", purchaseID, status, err)
+		}
+		current = status
+	}
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// ErrSupplierInUse is returned when deleting a supplier that weight variants are reordered from
+var ErrSupplierInUse = errors.New("supplier is in use")
+
+// SupplierStore stores the suppliers stock is reordered from
+type SupplierStore interface {
+	// Create stores a supplier, assigning its ID
+	Create(supplier *models.Supplier) error
+	// Get returns a supplier
+	Get(id int) (*models.Supplier, error)
+	// List returns every supplier by name
+	List() ([]*models.Supplier, error)
+	// Update changes a supplier
+	Update(supplier *models.Supplier) error
+	// Delete removes a supplier. It returns ErrSupplierInUse when weight variants are reordered from it.
+	Delete(id int) error
+}
+
+const supplierColumns = `supplier_id, name, contact_number, email, created_at, updated_at`
+
+type sqlSupplierStore struct {
+	db *db.Repository
+}
+
+func scanSupplier(row scanner) (*models.Supplier, error) {
+	supplier := &models.Supplier{}
+	err := row.Scan(&supplier.SupplierID, &supplier.Name, &supplier.ContactNumber, &supplier.Email, &supplier.CreatedAt, &supplier.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return supplier, nil
+}
+
+func (s *sqlSupplierStore) Create(supplier *models.Supplier) error {
+	query := `INSERT INTO suppliers (name, contact_number, email, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
+	id, err := s.db.InsertReturningID(query, "supplier_id", supplier.Name, supplier.ContactNumber, supplier.Email, supplier.CreatedAt, supplier.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	supplier.SupplierID = int(id)
+	return nil
+}
+
+func (s *sqlSupplierStore) Get(id int) (*models.Supplier, error) {
+	supplier, err := scanSupplier(s.db.QueryRow(`SELECT `+supplierColumns+` FROM suppliers WHERE supplier_id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return supplier, nil
+}
+
+func (s *sqlSupplierStore) List() ([]*models.Supplier, error) {
+	rows, err := s.db.Query(`SELECT ` + supplierColumns + ` FROM suppliers ORDER BY name, supplier_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suppliers []*models.Supplier
+	for rows.Next() {
+		supplier, err := scanSupplier(rows)
+		if err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+	return suppliers, rows.Err()
+}
+
+func (s *sqlSupplierStore) Update(supplier *models.Supplier) error {
+	query := `UPDATE suppliers SET name = ?, contact_number = ?, email = ?, updated_at = ? WHERE supplier_id = ?`
+	result, err := s.db.Exec(query, supplier.Name, supplier.ContactNumber, supplier.Email, supplier.UpdatedAt, supplier.SupplierID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlSupplierStore) Delete(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM product_weights WHERE supplier_id = ?`, id).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return ErrSupplierInUse
+	}
+
+	result, err := tx.Exec(`DELETE FROM suppliers WHERE supplier_id = ?`, id)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// UserStore stores user accounts. User.Password always holds the stored
+// password hash, never the clear text password.
+type UserStore interface {
+	// Create stores a user and the addresses given with it, assigning their IDs
+	Create(user *models.User) error
+	// Get returns a user with their addresses
+	Get(id int) (*models.User, error)
+	// GetByEmail returns the user registered with the email address
+	GetByEmail(email string) (*models.User, error)
+	// GetByContactNumber returns the user registered with the phone number
+	GetByContactNumber(contactNumber string) (*models.User, error)
+	// ContactNumberExists reports whether a user is registered with the phone number
+	ContactNumberExists(contactNumber string) (bool, error)
+	// Update changes the name, email and contact number of user.UserID and replaces
+	// their addresses. Verification is only changed through SetVerified.
+	Update(user *models.User) error
+	// UpdatePassword stores a new password hash for the user
+	UpdatePassword(id int, passwordHash string) error
+	// SetVerified marks the user's account as verified or not
+	SetVerified(id int, verified bool) error
+	// SetRole changes the role of the user
+	SetRole(id int, role string) error
+	// Role returns the role of the user
+	Role(id int) (string, error)
+	// Delete removes the user together with everything that belongs to them
+	Delete(id int) error
+}
+
+const userColumns = `user_id, first_name, last_name, email, contact_number, verified_account, hashed_password, role`
+
+type sqlUserStore struct {
+	db *db.Repository
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(&user.UserID, &user.FirstName, &user.LastName, &user.Email, &user.ContactNumber, &user.VerifiedAccount, &user.Password, &user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *sqlUserStore) Create(user *models.User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO users (first_name, last_name, email, contact_number, verified_account, hashed_password) VALUES (?, ?, ?, ?, ?, ?)`
+	userID, err := tx.InsertReturningID(query, "user_id", user.FirstName, user.LastName, user.Email, user.ContactNumber, user.VerifiedAccount, user.Password)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	user.UserID = int(userID)
+
+	if err := insertUserAddresses(tx, user); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertUserAddresses stores the addresses given with a user
+func insertUserAddresses(tx *db.Tx, user *models.User) error {
+	if user.Address == nil {
+		return nil
+	}
+	for _, address := range *user.Address {
+		address.UserID = user.UserID
+		if err := insertAddress(tx.InsertReturningID, address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlUserStore) Get(id int) (*models.User, error) {
+	user, err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE user_id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	addresses, err := listAddresses(s.db, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) > 0 {
+		user.Address = &addresses
+	}
+	return user, nil
+}
+
+func (s *sqlUserStore) GetByEmail(email string) (*models.User, error) {
+	user, err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = ?`, email))
+	return user, notFound(err)
+}
+
+func (s *sqlUserStore) GetByContactNumber(contactNumber string) (*models.User, error) {
+	user, err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE contact_number = ?`, contactNumber))
+	return user, notFound(err)
+}
+
+func (s *sqlUserStore) ContactNumberExists(contactNumber string) (bool, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM users WHERE contact_number = ?`, contactNumber).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *sqlUserStore) Update(user *models.User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET first_name = ?, last_name = ?, email = ?, contact_number = ? WHERE user_id = ?`
+	result, err := tx.Exec(query, user.FirstName, user.LastName, user.Email, user.ContactNumber, user.UserID)
+	if err == nil {
+		err = checkAffected(result)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM addresses WHERE user_id = ?`, user.UserID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := insertUserAddresses(tx, user); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlUserStore) UpdatePassword(id int, passwordHash string) error {
+	_, err := s.db.Exec(`UPDATE users SET hashed_password = ? WHERE user_id = ?`, passwordHash, id)
+	return err
+}
+
+func (s *sqlUserStore) SetVerified(id int, verified bool) error {
+	_, err := s.db.Exec(`UPDATE users SET verified_account = ? WHERE user_id = ?`, verified, id)
+	return err
+}
+
+func (s *sqlUserStore) SetRole(id int, role string) error {
+	result, err := s.db.Exec(`UPDATE users SET role = ? WHERE user_id = ?`, role, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlUserStore) Role(id int) (string, error) {
+	var role string
+	err := s.db.QueryRow(`SELECT role FROM users WHERE user_id = ?`, id).Scan(&role)
+	return role, notFound(err)
+}
+
+func (s *sqlUserStore) Delete(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Rows referencing the user go first so that foreign keys hold on databases enforcing them
+	queries := []string{
+		`DELETE FROM refresh_tokens WHERE user_id = ?`,
+		`DELETE FROM otp WHERE user_id = ?`,
+		`DELETE FROM cart WHERE user_id = ?`,
+		`DELETE FROM wishlist WHERE user_id = ?`,
+		`DELETE FROM addresses WHERE user_id = ?`,
+		`DELETE FROM users WHERE user_id = ?`,
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query, id)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"github.com/gklps/mittai-backend/db"
+	"github.com/gklps/mittai-backend/models"
+)
+
+// WishlistStore stores the products users saved for later
+type WishlistStore interface {
+	// Add stores a wishlist entry, assigning its ID. It reports false without
+	// storing anything when the product is already in the user's wishlist.
+	Add(item *models.Wishlist) (bool, error)
+	// Remove takes a product out of the user's wishlist
+	Remove(userID, productID int) error
+	// ListByUser returns the wishlist of a user
+	ListByUser(userID int) ([]*models.Wishlist, error)
+	// Contains reports whether the product is in the user's wishlist
+	Contains(userID, productID int) (bool, error)
+}
+
+type sqlWishlistStore struct {
+	db *db.Repository
+}
+
+func (s *sqlWishlistStore) Add(item *models.Wishlist) (bool, error) {
+	exists, err := s.Contains(item.UserID, item.ProductID)
+	if err != nil || exists {
+		return false, err
+	}
+
+	query := `INSERT INTO wishlist (user_id, product_id, created_at, updated_at) VALUES (?, ?, ?, ?)`
+	id, err := s.db.InsertReturningID(query, "id", item.UserID, item.ProductID, item.CreatedAt, item.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	item.ID = int(id)
+	return true, nil
+}
+
+func (s *sqlWishlistStore) Remove(userID, productID int) error {
+	_, err := s.db.Exec(`DELETE FROM wishlist WHERE user_id = ? AND product_id = ?`, userID, productID)
+	return err
+}
+
+func (s *sqlWishlistStore) ListByUser(userID int) ([]*models.Wishlist, error) {
+	rows, err := s.db.Query(`SELECT id, user_id, product_id, created_at, updated_at FROM wishlist WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.Wishlist
+	for rows.Next() {
+		item := &models.Wishlist{}
+		if err := rows.Scan(&item.ID, &item.UserID, &item.ProductID, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlWishlistStore) Contains(userID, productID int) (bool, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM wishlist WHERE user_id = ? AND product_id = ?`, userID, productID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
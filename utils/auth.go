@@ -1,10 +1,89 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// RoleCustomer is the role carried by tokens of regular shop customers
+	RoleCustomer = "customer"
+	// RoleStaff is the role of shop staff managing the catalog and stock
+	RoleStaff = "staff"
+	// RoleAdmin is the role allowed to act on resources owned by any user
+	RoleAdmin = "admin"
 )
 
+// IsValidRole reports whether role is one of the known user roles
+func IsValidRole(role string) bool {
+	return role == RoleCustomer || role == RoleStaff || role == RoleAdmin
+}
+
+// Principal is the authenticated caller attached to the request context
+type Principal struct {
+	UserID int
+	Role   string
+}
+
+// Claims represents the JWT claims carried by access tokens
+type Claims struct {
+	Role string `json:"role"`
+	jwt.StandardClaims
+}
+
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+var (
+	jwtSecret      []byte
+	jwtIssuer      = "mittai-backend"
+	accessTokenTTL = 15 * time.Minute
+)
+
+// ConfigureJWT sets the secret, issuer and lifetime used for access tokens
+func ConfigureJWT(secret []byte, issuer string, ttl time.Duration) {
+	jwtSecret = secret
+	if issuer != "" {
+		jwtIssuer = issuer
+	}
+	if ttl > 0 {
+		accessTokenTTL = ttl
+	}
+}
+
+// GenerateAccessToken issues a signed access token for the given user and role
+func GenerateAccessToken(userID int, role string) (string, time.Time, error) {
+	if len(jwtSecret) == 0 {
+		return "", time.Time{}, errors.New("jwt secret is not configured")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(accessTokenTTL)
+	claims := Claims{
+		Role: role,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.Itoa(userID),
+			Issuer:    jwtIssuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
 // Middleware to authenticate requests using JWT token
 func Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -12,16 +91,42 @@ func Authenticate(next http.Handler) http.Handler {
 		token := extractToken(r)
 
 		// Validate and verify the token
-		if !validateToken(token) {
+		principal, err := validateToken(token)
+		if err != nil {
 			SendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		// If token is valid, proceed with the next handler
-		next.ServeHTTP(w, r)
+		// If token is valid, proceed with the principal attached to the request
+		ctx := context.WithValue(r.Context(), principalKey, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// AuthenticateFunc wraps a handler function with Authenticate
+func AuthenticateFunc(next http.HandlerFunc) http.HandlerFunc {
+	return Authenticate(next).ServeHTTP
+}
+
+// PrincipalFromRequest returns the authenticated caller of the request, if any
+func PrincipalFromRequest(r *http.Request) (*Principal, bool) {
+	principal, ok := r.Context().Value(principalKey).(*Principal)
+	return principal, ok
+}
+
+// PrincipalFromToken returns the caller identified by the request's access token
+// for code running before Authenticate. A missing or invalid token yields false.
+func PrincipalFromToken(r *http.Request) (*Principal, bool) {
+	if principal, ok := PrincipalFromRequest(r); ok {
+		return principal, true
+	}
+	principal, err := validateToken(extractToken(r))
+	if err != nil {
+		return nil, false
+	}
+	return principal, true
+}
+
 // Function to extract JWT token from request header
 func extractToken(r *http.Request) string {
 	// Extract token from Authorization header
@@ -36,8 +141,40 @@ func extractToken(r *http.Request) string {
 }
 
 // Function to validate and verify the JWT token
-func validateToken(token string) bool {
-	// Implement token validation logic
-	// Return true if token is valid, false otherwise
-	return true
+func validateToken(token string) (*Principal, error) {
+	if token == "" {
+		return nil, errors.New("missing token")
+	}
+	if len(jwtSecret) == 0 {
+		return nil, errors.New("jwt secret is not configured")
+	}
+
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return jwtSecret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	// ParseWithClaims only checks expiry when present; expiry and issuer are required here
+	if claims.ExpiresAt == 0 {
+		return nil, errors.New("token has no expiry")
+	}
+	if !claims.VerifyIssuer(jwtIssuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 {
+		return nil, errors.New("invalid token subject")
+	}
+
+	return &Principal{UserID: userID, Role: claims.Role}, nil
 }
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// useJWT configures the access token settings for a test and restores them afterwards
+func useJWT(t *testing.T, secret, issuer string, ttl time.Duration) {
+	t.Helper()
+	savedSecret, savedIssuer, savedTTL := jwtSecret, jwtIssuer, accessTokenTTL
+	t.Cleanup(func() {
+		jwtSecret, jwtIssuer, accessTokenTTL = savedSecret, savedIssuer, savedTTL
+	})
+	ConfigureJWT([]byte(secret), issuer, ttl)
+}
+
+func TestAccessToken(t *testing.T) {
+	useJWT(t, "a secret of enough length", "mittai-backend", time.Hour)
+
+	token, expiresAt, err := GenerateAccessToken(7, RoleStaff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiresAt); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("token expires in %v, want an hour", d)
+	}
+	principal, err := validateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.UserID != 7 || principal.Role != RoleStaff {
+		t.Errorf("principal = %+v, want user 7 with role %s", principal, RoleStaff)
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	useJWT(t, "a secret of enough length", "mittai-backend", time.Hour)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(change func(claims *Claims)) *Claims {
+		claims := &Claims{
+			Role: RoleCustomer,
+			StandardClaims: jwt.StandardClaims{
+				Subject:   "7",
+				Issuer:    "mittai-backend",
+				IssuedAt:  now.Unix(),
+				ExpiresAt: now.Add(time.Hour).Unix(),
+			},
+		}
+		if change != nil {
+			change(claims)
+		}
+		return claims
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, claims *Claims) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	secret := []byte("a secret of enough length")
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"HS256", sign(jwt.SigningMethodHS256, secret, claims(nil)), true},
+		{"empty", "", false},
+		{"malformed", "not.a.token", false},
+		{"other secret", sign(jwt.SigningMethodHS256, []byte("another secret of enough length"), claims(nil)), false},
+		{"HS384", sign(jwt.SigningMethodHS384, secret, claims(nil)), false},
+		{"none", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(nil)), false},
+		{"RS256", sign(jwt.SigningMethodRS256, key, claims(nil)), false},
+		{"expired", sign(jwt.SigningMethodHS256, secret, claims(func(c *Claims) { c.ExpiresAt = now.Add(-time.Minute).Unix() })), false},
+		{"no expiry", sign(jwt.SigningMethodHS256, secret, claims(func(c *Claims) { c.ExpiresAt = 0 })), false},
+		{"other issuer", sign(jwt.SigningMethodHS256, secret, claims(func(c *Claims) { c.Issuer = "someone-else" })), false},
+		{"no issuer", sign(jwt.SigningMethodHS256, secret, claims(func(c *Claims) { c.Issuer = "" })), false},
+		{"bad subject", sign(jwt.SigningMethodHS256, secret, claims(func(c *Claims) { c.Subject = "asha" })), false},
+		{"zero subject", sign(jwt.SigningMethodHS256, secret, claims(func(c *Claims) { c.Subject = "0" })), false},
+	}
+	for _, test := range tests {
+		principal, err := validateToken(test.token)
+		if test.valid && (err != nil || principal.UserID != 7 || principal.Role != RoleCustomer) {
+			t.Errorf("%s token: principal = %+v, %v, want user 7", test.name, principal, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s token was accepted for %+v", test.name, principal)
+		}
+	}
+}
+
+func TestUnconfiguredSecret(t *testing.T) {
+	useJWT(t, "a secret of enough length", "mittai-backend", time.Hour)
+	token, _, err := GenerateAccessToken(7, RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtSecret = nil
+	if _, _, err := GenerateAccessToken(7, RoleCustomer); err == nil {
+		t.Error("a token was issued without a secret")
+	}
+	if _, err := validateToken(token); err == nil {
+		t.Error("a token was accepted without a secret")
+	}
+}
@@ -0,0 +1,74 @@
+package utils
+
+import "net/http"
+
+// CanAccessUser reports whether the authenticated caller may act on resources owned by ownerID
+func CanAccessUser(r *http.Request, ownerID int) bool {
+	principal, ok := PrincipalFromRequest(r)
+	if !ok {
+		return false
+	}
+	return principal.UserID == ownerID || principal.Role == RoleAdmin
+}
+
+// AuthorizeUser checks that the caller may act on resources owned by ownerID.
+// It writes a 403 response and returns false when access is denied.
+func AuthorizeUser(w http.ResponseWriter, r *http.Request, ownerID int) bool {
+	if !CanAccessUser(r, ownerID) {
+		SendErrorResponse(w, http.StatusForbidden, "Forbidden")
+		return false
+	}
+	return true
+}
+
+// ActingUserID resolves the user a request acts on behalf of. A zero requestedID
+// means the authenticated caller; any other ID must pass AuthorizeUser. It writes
+// the error response and returns false when the request must be rejected.
+func ActingUserID(w http.ResponseWriter, r *http.Request, requestedID int) (int, bool) {
+	principal, ok := PrincipalFromRequest(r)
+	if !ok {
+		SendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, false
+	}
+	if requestedID == 0 {
+		return principal.UserID, true
+	}
+	if !AuthorizeUser(w, r, requestedID) {
+		return 0, false
+	}
+	return requestedID, true
+}
+
+// RequireRole authenticates the request and only lets it through when the caller
+// has one of the given roles. Admins are always allowed.
+func RequireRole(next http.Handler, roles ...string) http.Handler {
+	return Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromRequest(r)
+		if !hasRole(principal, roles) {
+			SendErrorResponse(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequireRoleFunc wraps a handler function with RequireRole
+func RequireRoleFunc(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return RequireRole(next, roles...).ServeHTTP
+}
+
+// hasRole reports whether the principal has any of the roles
+func hasRole(principal *Principal, roles []string) bool {
+	if principal == nil {
+		return false
+	}
+	if principal.Role == RoleAdmin {
+		return true
+	}
+	for _, role := range roles {
+		if principal.Role == role {
+			return true
+		}
+	}
+	return false
+}